@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Creates a pod from a previewed or edited YAML file and attaches to it.",
+	Long: `apply feeds a file written by --preview (or edited by hand) back into the
+usual session: the pod is created, kmime waits for it, attaches, and deletes it
+when the session ends.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		fromFile, _ := cmd.Flags().GetString("from-file")
+		namespace, _ := cmd.Flags().GetString("namespace")
+		validate, _ := cmd.Flags().GetBool("validate")
+		schemaFile, _ := cmd.Flags().GetString("schema-file")
+		cfg, history := loadCommandConfig(cmd)
+
+		pod, secret, script, err := readPreviewFile(fromFile)
+		if err != nil {
+			log.Fatalf("Could not read pod from file: %v", err)
+		}
+		if namespace != "" {
+			pod.Namespace = namespace
+		}
+		if secret != nil {
+			secret.Namespace = pod.Namespace
+		}
+		if pod.Namespace == "" {
+			log.Fatalf("The pod in %s has no namespace; pass -n", fromFile)
+		}
+		var user string
+		if skip, _ := cmd.Flags().GetBool("skip-identification"); !skip {
+			user, err = getUserIdentifier()
+			if err != nil {
+				log.Fatalf("Error getting user identifier: %v", err)
+			}
+		}
+
+		params := newDefaultParams(cfg)
+		params.sourcePod = fromFile
+		params.commandToRun = pod.Spec.Containers[0].Command
+		params.namespace = pod.Namespace
+		params.labels = pod.Labels
+		params.user = user
+		params.history = history
+		params.podSpec = pod
+		params.envSecret = secret
+		params.script = script
+		params.noValidate = !validate
+		params.onFailure = onFailureAsk
+		params.schemaFile = schemaFile
+		// The mutation plugins already ran when --preview wrote the file,
+		// and running them again on their own output is not safe.
+		params.mutationPlugins = nil
+
+		initial := NewModel(params)
+		stopCleanup := initial.cleanup.cleanupOnSignals(params)
+		p := tea.NewProgram(initial)
+		final, err := p.Run()
+		stopCleanup()
+		initial.cleanup.cleanup(params)
+		printFailureLogs(final)
+		if err != nil {
+			fmt.Printf("An error occurred during execution: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// readPreviewFile loads a file written by --preview: a pod, optionally
+// preceded by the Secret holding its resolved env secrets and the ConfigMap
+// holding its --script. The masked values --preview writes by default are
+// rejected, as they would otherwise end up in the pod.
+func readPreviewFile(path string) (*v1.Pod, *v1.Secret, *localScript, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	docs, err := splitDocuments(data)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid YAML in %s: %w", path, err)
+	}
+
+	var pod *v1.Pod
+	var secret *v1.Secret
+	var scriptMap *v1.ConfigMap
+	for _, doc := range docs {
+		var meta metav1.TypeMeta
+		if err := yaml.Unmarshal(doc, &meta); err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid YAML in %s: %w", path, err)
+		}
+		switch meta.Kind {
+		case "", "Pod":
+			if pod != nil {
+				return nil, nil, nil, fmt.Errorf("%s contains more than one pod", path)
+			}
+			pod = &v1.Pod{}
+			if err := yaml.UnmarshalStrict(doc, pod); err != nil {
+				return nil, nil, nil, fmt.Errorf("invalid pod YAML in %s: %w", path, err)
+			}
+		case "Secret":
+			if secret != nil {
+				return nil, nil, nil, fmt.Errorf("%s contains more than one secret", path)
+			}
+			secret = &v1.Secret{}
+			if err := yaml.UnmarshalStrict(doc, secret); err != nil {
+				return nil, nil, nil, fmt.Errorf("invalid secret YAML in %s: %w", path, err)
+			}
+		case "ConfigMap":
+			if scriptMap != nil {
+				return nil, nil, nil, fmt.Errorf("%s contains more than one configmap", path)
+			}
+			scriptMap = &v1.ConfigMap{}
+			if err := yaml.UnmarshalStrict(doc, scriptMap); err != nil {
+				return nil, nil, nil, fmt.Errorf("invalid configmap YAML in %s: %w", path, err)
+			}
+		default:
+			return nil, nil, nil, fmt.Errorf("%s contains a %s, kmime only creates pods, their env secret and script", path, meta.Kind)
+		}
+	}
+	if pod == nil {
+		return nil, nil, nil, fmt.Errorf("%s contains no pod", path)
+	}
+	if err := validateEditedPod(pod); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid pod in %s: %w", path, err)
+	}
+
+	for _, containers := range [][]v1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, c := range containers {
+			for _, env := range c.Env {
+				if env.Value == maskedValue {
+					return nil, nil, nil, fmt.Errorf("%s contains masked values (e.g. %s in container %s); regenerate the preview with --show-secrets", path, env.Name, c.Name)
+				}
+			}
+		}
+	}
+	pod.ResourceVersion = ""
+	pod.UID = ""
+
+	if secret != nil {
+		if secret.Name != envSecretName(pod.Name) {
+			return nil, nil, nil, fmt.Errorf("secret %s in %s is not the env secret of pod %s", secret.Name, path, pod.Name)
+		}
+		for key, value := range secret.StringData {
+			if value == maskedValue {
+				return nil, nil, nil, fmt.Errorf("%s contains masked values (e.g. %s in secret %s); regenerate the preview with --show-secrets", path, key, secret.Name)
+			}
+		}
+		secret.ResourceVersion = ""
+		secret.UID = ""
+	}
+
+	var script *localScript
+	if scriptMap != nil {
+		if scriptMap.Name != scriptConfigMapName(pod.Name) {
+			return nil, nil, nil, fmt.Errorf("configmap %s in %s is not the script of pod %s", scriptMap.Name, path, pod.Name)
+		}
+		if len(scriptMap.Data)+len(scriptMap.BinaryData) != 1 {
+			return nil, nil, nil, fmt.Errorf("configmap %s in %s must hold exactly one script", scriptMap.Name, path)
+		}
+		for name, data := range scriptMap.Data {
+			script = &localScript{name: name, data: []byte(data)}
+		}
+		for name, data := range scriptMap.BinaryData {
+			script = &localScript{name: name, data: data}
+		}
+	}
+	return pod, secret, script, nil
+}
+
+// splitDocuments splits a YAML stream into its non-empty documents.
+func splitDocuments(data []byte) ([][]byte, error) {
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	var docs [][]byte
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(doc)) > 0 {
+			docs = append(docs, doc)
+		}
+	}
+}
+
+func init() {
+	applyCmd.Flags().StringP("from-file", "f", "", "Pod YAML to create, e.g. kmime-preview.yaml (required)")
+	applyCmd.MarkFlagRequired("from-file")
+	applyCmd.Flags().StringP("namespace", "n", "", "Namespace to create the pod in (defaults to the file's namespace)")
+	applyCmd.Flags().Bool("validate", true, "Validate the pod against the cluster's OpenAPI schema before creating it")
+	applyCmd.Flags().String("schema-file", "", "Validate against this core/v1 OpenAPI v3 document instead of fetching the cluster's")
+	applyCmd.Flags().Bool("skip-identification", false, "Do not record the user identifier in the history")
+}
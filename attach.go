@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+)
+
+var attachCmd = &cobra.Command{
+	Use:   "attach [clone-pod] [command]",
+	Short: "Reattaches to a running kmime clone.",
+	Long: `attach reconnects a terminal to a clone whose session was lost, for example
+after the laptop slept or the connection dropped. The clone is removed when the
+shell exits, like at the end of a normal session; if the connection drops
+again it is left running so you can reattach once more.
+
+Clones started with --keepalive get a new shell, or the given command, exec'd
+into them instead, so several people can work in one clone. Those clones are
+left to the session that created them. -c does the same for another container
+of the clone, such as a sidecar.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		namespace, _ := cmd.Flags().GetString("namespace")
+		keep, _ := cmd.Flags().GetBool("keep")
+		detachKeysStr, _ := cmd.Flags().GetString("detach-keys")
+		recordPath, _ := cmd.Flags().GetString("record")
+		logPath, _ := cmd.Flags().GetString("log-output")
+		container, _ := cmd.Flags().GetString("container")
+		cfg, _ := loadCommandConfig(cmd)
+		detachKeys, err := parseDetachKeys(detachKeysStr)
+		if err != nil {
+			log.Fatalf("Error processing detach keys: %v", err)
+		}
+
+		clientset, config, err := getKubeConfig()
+		if err != nil {
+			log.Fatalf("Could not get Kubernetes config: %v", err)
+		}
+		pod, err := getPod(clientset, namespace, args[0])
+		if err != nil {
+			log.Fatalf("Could not get clone pod: %v", err)
+		}
+		if err := checkAttachable(pod); err != nil {
+			log.Fatalf("Cannot attach: %v", err)
+		}
+		if err := checkContainer(pod, container); err != nil {
+			log.Fatalf("Cannot attach: %v", err)
+		}
+		target := pod.Spec.Containers[0].Name
+		if container == "" {
+			container = target
+		}
+
+		session := sessionOptions{detachKeys: detachKeys}
+		if recordPath != "" {
+			command := []string{"kmime", "attach", pod.Name}
+			session.recorder, err = startRecording(recordPath, command)
+			if err != nil {
+				log.Fatalf("Error processing --record: %v", err)
+			}
+			defer session.recorder.Close()
+		}
+		if logPath != "" {
+			outputLog, err := openOutputLog(logPath)
+			if err != nil {
+				log.Fatalf("Error processing --log-output: %v", err)
+			}
+			defer outputLog.Close()
+			session.outputLog = outputLog
+		}
+
+		keepalive := pod.Annotations[keepaliveAnnotation] == "true"
+		if keepalive || container != target {
+			command := shellCommand(cfg.ShellFallback)
+			if len(args) > 1 {
+				command = args[1:]
+			}
+			if pod.Annotations[tmuxAnnotation] == "true" && container == target {
+				command = tmuxCommand(command)
+			}
+			err = execInteractive(clientset, config, pod.Namespace, pod.Name, container, command, session)
+		} else {
+			fmt.Printf("Attached to pod '%s'. Press Enter if no prompt appears.\n", pod.Name)
+			err = attachToPod(clientset, config, pod.Namespace, pod.Name, target, session)
+		}
+		if errors.Is(err, errDetached) {
+			fmt.Printf("\nDetached.\n%s\n", reattachHint(pod.Namespace, pod.Name))
+			return
+		}
+		if !sessionEnded(err) {
+			fmt.Printf("The connection was lost: %v\n%s\n", err, reattachHint(pod.Namespace, pod.Name))
+			os.Exit(1)
+		}
+		if keep || keepalive {
+			fmt.Printf("Session finished. Pod '%s' was kept.\n", pod.Name)
+			return
+		}
+		if err := deletePod(clientset, pod.Namespace, pod.Name, pod.Spec.TerminationGracePeriodSeconds); err != nil {
+			log.Fatalf("Could not clean up pod: %v", err)
+		}
+		fmt.Printf("Session finished. Pod '%s' removed successfully.\n", pod.Name)
+	},
+}
+
+// checkAttachable makes sure the pod is a kmime clone whose shell is still
+// running with a terminal.
+func checkAttachable(pod *v1.Pod) error {
+	if pod.Labels[cloneLabel] != "true" {
+		return fmt.Errorf("pod %s was not created by kmime", pod.Name)
+	}
+	if pod.Status.Phase != v1.PodRunning || !containerStarted(pod) {
+		return fmt.Errorf("pod %s is not running (phase %s)", pod.Name, pod.Status.Phase)
+	}
+	if len(pod.Spec.Containers) > 0 && !pod.Spec.Containers[0].TTY && pod.Annotations[keepaliveAnnotation] != "true" {
+		return fmt.Errorf("pod %s has no terminal to attach to, it was started without one", pod.Name)
+	}
+	return nil
+}
+
+// checkContainer makes sure a --container, if given, is in the pod.
+func checkContainer(pod *v1.Pod, name string) error {
+	if name == "" {
+		return nil
+	}
+	for _, c := range pod.Spec.Containers {
+		if c.Name == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("container %q not found in pod %s, expected one of: %s", name, pod.Name, containerNames(pod.Spec.Containers))
+}
+
+// reattachHint tells how to get back into a clone left running after its
+// session was lost.
+func reattachHint(namespace, podName string) string {
+	return fmt.Sprintf("The clone is still running; reattach with: kmime attach %s -n %s", podName, namespace)
+}
+
+func init() {
+	attachCmd.Flags().StringP("namespace", "n", "", "Namespace of the clone pod (required)")
+	attachCmd.MarkFlagRequired("namespace")
+	attachCmd.Flags().String("detach-keys", defaultDetachKeys, "Key sequence that detaches from the session without ending it, empty to disable")
+	attachCmd.Flags().String("record", "", "Record the session to this file in asciinema v2 format")
+	attachCmd.Flags().String("log-output", "", "Append everything written to the terminal during the session to this file")
+	attachCmd.Flags().StringP("container", "c", "", "Container to open the session in; containers other than the clone's main one get a shell exec'd into them")
+	attachCmd.Flags().Bool("keep", false, "Keep the clone when the session ends instead of removing it")
+}
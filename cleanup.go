@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// creationGrace is how long cleanup waits for a creation request that was
+// in flight when kmime was interrupted, so its pod is not missed.
+const creationGrace = 10 * time.Second
+
+// cleanupAttempts is how often a cleanup delete is tried, waiting
+// cleanupBackoff after the first failure and twice as long after each next
+// one.
+const (
+	cleanupAttempts = 4
+	cleanupBackoff  = time.Second
+)
+
+// retryCleanup runs op until it succeeds or cleanupAttempts are used up,
+// and returns how many attempts it took. Denied requests are not retried.
+func retryCleanup(op func() error) (int, error) {
+	backoff := cleanupBackoff
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || attempt == cleanupAttempts || k8serrors.IsForbidden(err) || k8serrors.IsUnauthorized(err) {
+			return attempt, err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// leftoverError reports an object cleanup could not remove, with the
+// command that removes it by hand.
+type leftoverError struct {
+	kind      string
+	namespace string
+	name      string
+	attempts  int
+	command   string
+	err       error
+}
+
+func (e *leftoverError) Error() string {
+	owned := ""
+	if isCloneKind(e.kind) {
+		owned = ", and the objects it owns"
+	}
+	return fmt.Sprintf("%v (after %d attempt(s))\nLeftover resources:\n  %s/%s in namespace %s%s\nRemove them with: %s",
+		e.err, e.attempts, e.kind, e.name, e.namespace, owned, e.command)
+}
+
+func (e *leftoverError) Unwrap() error { return e.err }
+
+// trackedObject is an object a session created. Kinds are named like
+// kubectl names them, so leftovers can be reported as commands.
+type trackedObject struct {
+	kind      string
+	namespace string
+	name      string
+}
+
+// isCloneKind reports whether the kind is the clone itself rather than an
+// object created alongside it.
+func isCloneKind(kind string) bool {
+	return kind == "pod" || kind == "job.batch"
+}
+
+// deleteAuxiliaryObject removes a Secret, ConfigMap or Lease created for a
+// clone, retrying failed deletes.
+func deleteAuxiliaryObject(clientset *kubernetes.Clientset, obj trackedObject) error {
+	attempts, err := retryCleanup(func() error {
+		var err error
+		switch obj.kind {
+		case "secret":
+			err = clientset.CoreV1().Secrets(obj.namespace).Delete(context.TODO(), obj.name, metav1.DeleteOptions{})
+		case "configmap":
+			err = clientset.CoreV1().ConfigMaps(obj.namespace).Delete(context.TODO(), obj.name, metav1.DeleteOptions{})
+		case "lease":
+			err = clientset.CoordinationV1().Leases(obj.namespace).Delete(context.TODO(), obj.name, metav1.DeleteOptions{})
+		default:
+			return fmt.Errorf("unexpected kind %q", obj.kind)
+		}
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return &leftoverError{kind: obj.kind, namespace: obj.namespace, name: obj.name, attempts: attempts, command: fmt.Sprintf("kubectl delete %s %s -n %s", obj.kind, obj.name, obj.namespace), err: err}
+	}
+	return nil
+}
+
+// deleteJob removes a --as-job Job and its pods, retrying failed deletes.
+func deleteJob(clientset *kubernetes.Clientset, namespace, name string) error {
+	propagation := metav1.DeletePropagationBackground
+	attempts, err := retryCleanup(func() error {
+		err := clientset.BatchV1().Jobs(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+		if k8serrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return &leftoverError{kind: "job.batch", namespace: namespace, name: name, attempts: attempts, command: fmt.Sprintf("kubectl delete job %s -n %s", name, namespace), err: err}
+	}
+	return nil
+}
+
+// cleanupTracker keeps the manifest of everything a session created: the
+// pod or Job, and the Secrets, ConfigMaps and Lease made for it. Until the
+// session removes the clone, keeps it or hands it over, all of it can still
+// be removed when kmime is interrupted or killed at any other point.
+type cleanupTracker struct {
+	mu sync.Mutex
+	// creating counts the creation requests in flight, and settled is
+	// closed once the last of them ends while cleanup waits for it.
+	creating  int
+	settled   chan struct{}
+	clientset *kubernetes.Clientset
+	// objects lists the created objects in creation order.
+	objects []trackedObject
+	done    bool
+}
+
+// begin marks a creation request in flight; end must follow it. It has to
+// be called before the request is handed to another goroutine, so cleanup
+// cannot miss it.
+func (t *cleanupTracker) begin() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.creating++
+}
+
+func (t *cleanupTracker) end() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.creating--
+	if t.creating == 0 && t.settled != nil {
+		close(t.settled)
+		t.settled = nil
+	}
+}
+
+// waitForCreation waits up to creationGrace for the creation requests in
+// flight to end.
+func (t *cleanupTracker) waitForCreation() {
+	t.mu.Lock()
+	if t.creating == 0 {
+		t.mu.Unlock()
+		return
+	}
+	if t.settled == nil {
+		t.settled = make(chan struct{})
+	}
+	settled := t.settled
+	t.mu.Unlock()
+	select {
+	case <-settled:
+	case <-time.After(creationGrace):
+	}
+}
+
+// track adds a created object to the manifest.
+func (t *cleanupTracker) track(clientset *kubernetes.Clientset, kind, namespace, name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.clientset = clientset
+	t.objects = append(t.objects, trackedObject{kind: kind, namespace: namespace, name: name})
+}
+
+// forget drops an object the session removed itself.
+func (t *cleanupTracker) forget(kind, namespace, name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, obj := range t.objects {
+		if obj == (trackedObject{kind: kind, namespace: namespace, name: name}) {
+			t.objects = append(t.objects[:i], t.objects[i+1:]...)
+			return
+		}
+	}
+}
+
+// clone returns the tracked pod or Job; t.mu must be held.
+func (t *cleanupTracker) clone() (trackedObject, bool) {
+	for _, obj := range t.objects {
+		if isCloneKind(obj.kind) {
+			return obj, true
+		}
+	}
+	return trackedObject{}, false
+}
+
+// release stops tracking once the session kept the clone or handed it
+// over; the objects created for it stay with it.
+func (t *cleanupTracker) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.done = true
+}
+
+// keep stops tracking because the user chose to keep the clone, and
+// releases its lease so it is not taken for an abandoned one.
+func (t *cleanupTracker) keep() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if clone, ok := t.clone(); ok && clone.kind == "pod" && !t.done {
+		releaseLease(t.clientset, clone.namespace, clone.name)
+	}
+	t.done = true
+}
+
+// pending reports whether a created clone is still tracked.
+func (t *cleanupTracker) pending() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.clone()
+	return ok && !t.done
+}
+
+// cleanup removes every tracked object, newest first, unless the session
+// released them, or tells where the clone is with keep. It is safe to call
+// more than once.
+func (t *cleanupTracker) cleanup(params *kmimeParams) {
+	t.waitForCreation()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.objects) == 0 || t.done {
+		return
+	}
+	t.done = true
+	clone, hasClone := t.clone()
+	if params.keep && hasClone {
+		if clone.kind == "pod" {
+			releaseLease(t.clientset, clone.namespace, clone.name)
+		}
+		fmt.Fprintln(os.Stderr, keptMessage(clone.namespace, clone.name))
+		return
+	}
+	if hasClone {
+		fmt.Fprintf(os.Stderr, "Cleaning up %s '%s'...\n", clone.kind, clone.name)
+	}
+	for i := len(t.objects) - 1; i >= 0; i-- {
+		obj := t.objects[i]
+		var err error
+		switch obj.kind {
+		case "pod":
+			err = deleteClone(t.clientset, obj.namespace, obj.name, params)
+		case "job.batch":
+			err = deleteJob(t.clientset, obj.namespace, obj.name)
+		default:
+			err = deleteAuxiliaryObject(t.clientset, obj)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not clean up %s '%s': %v\n", obj.kind, obj.name, err)
+		}
+	}
+}
+
+// cleanupOnSignals removes the tracked object and exits when kmime is
+// terminated or its terminal hangs up, whatever the session is doing at the
+// time. The TUI handles ctrl-c itself. The returned function stops it.
+func (t *cleanupTracker) cleanupOnSignals(params *kmimeParams) func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGHUP)
+	var state *term.State
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		state, _ = term.GetState(int(os.Stdin.Fd()))
+	}
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			// The TUI or the session may hold the terminal; leave it
+			// usable, off the alternate screen and with a cursor.
+			if state != nil {
+				term.Restore(int(os.Stdin.Fd()), state)
+			}
+			fmt.Fprint(os.Stdout, "\x1b[?1049l\x1b[?25h\r\n")
+			t.cleanup(params)
+			code := 128 + 15
+			if sig == syscall.SIGHUP {
+				code = 128 + 1
+			}
+			os.Exit(code)
+		case <-stop:
+		}
+	}()
+	return func() {
+		signal.Stop(signals)
+		close(stop)
+	}
+}
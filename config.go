@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+const configEnvVar = "KMIME_CONFIG"
+
+type kmimeConfig struct {
+	DefaultLabels      map[string]string `json:"defaultLabels,omitempty"`
+	DefaultAnnotations map[string]string `json:"defaultAnnotations,omitempty"`
+	HistoryKeyFile     string            `json:"historyKeyFile,omitempty"`
+	DisableHistory     bool              `json:"disableHistory,omitempty"`
+	// HistoryFile overrides where the history is written; $KMIME_HISTORY
+	// takes precedence.
+	HistoryFile string `json:"historyFile,omitempty"`
+	// AllowedCapabilities limits what --add-capabilities may request.
+	AllowedCapabilities []string `json:"allowedCapabilities,omitempty"`
+	// DebugNamespace is offered as an alternative when the source
+	// namespace's ResourceQuota cannot fit the clone.
+	DebugNamespace string `json:"debugNamespace,omitempty"`
+	// DefaultPriorityClass replaces the source pod's priority class unless
+	// --priority-class is given.
+	DefaultPriorityClass string `json:"defaultPriorityClass,omitempty"`
+	// MountServiceAccountToken sets automountServiceAccountToken on every
+	// clone unless --mount-sa-token is given.
+	MountServiceAccountToken *bool `json:"mountServiceAccountToken,omitempty"`
+	// DebugSidecarImage is used by --debug-sidecar when no image is given.
+	DebugSidecarImage string `json:"debugSidecarImage,omitempty"`
+	// DebugSidecarShareProcesses enables shareProcessNamespace whenever
+	// --debug-sidecar is given, unless --share-process-namespace is.
+	DebugSidecarShareProcesses bool `json:"debugSidecarShareProcesses,omitempty"`
+	// ShellFallback is the list of shells probed, in order, when no
+	// command is given.
+	ShellFallback []string `json:"shellFallback,omitempty"`
+	// NameTemplate is the default for --name-template.
+	NameTemplate string `json:"nameTemplate,omitempty"`
+	// Spot holds the scheduling constraints applied by --spot.
+	Spot *spotConfig `json:"spot,omitempty"`
+	// Small overrides the resources applied by --small.
+	Small *smallProfile `json:"small,omitempty"`
+	// SecretProviders maps extra env-file reference schemes to shell
+	// commands that print the secret for $KMIME_SECRET_REF.
+	SecretProviders map[string]string `json:"secretProviders,omitempty"`
+	// MutationPlugins are commands that receive the generated pod as JSON
+	// on stdin and print the pod to create.
+	MutationPlugins []string `json:"mutationPlugins,omitempty"`
+	// IdleTimeout is the default for --idle-timeout, as a duration such
+	// as "2h".
+	IdleTimeout string `json:"idleTimeout,omitempty"`
+	// StartupTimeout is the default for --timeout, as a duration such as
+	// "10m".
+	StartupTimeout string `json:"startupTimeout,omitempty"`
+	// LogsDir turns on --save-logs for every clone, saving to this
+	// directory.
+	LogsDir string `json:"logsDir,omitempty"`
+}
+
+// smallProfile is the CPU and memory every container gets with --small.
+type smallProfile struct {
+	CPU    string `json:"cpu,omitempty"`
+	Memory string `json:"memory,omitempty"`
+}
+
+// spotConfig describes how to land a clone on cheap spot or preemptible
+// nodes. Tolerations use the --toleration syntax.
+type spotConfig struct {
+	Tolerations  []string          `json:"tolerations,omitempty"`
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+}
+
+const defaultDebugSidecarImage = "nicolaka/netshoot"
+
+// debugSidecarFromConfig is what --debug-sidecar without an image stands
+// for: debugSidecarImage from the config, or defaultDebugSidecarImage. It
+// cannot be an image reference, so an image given explicitly always wins.
+const debugSidecarFromConfig = "(default)"
+
+var defaultSmallProfile = smallProfile{CPU: "100m", Memory: "128Mi"}
+
+var defaultAllowedCapabilities = []string{"NET_ADMIN", "NET_RAW", "SYS_PTRACE"}
+
+func configFilePath(override string) (string, error) {
+	if override != "" {
+		return override, nil
+	}
+	if path := os.Getenv(configEnvVar); path != "" {
+		return path, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user config directory: %w", err)
+	}
+	return filepath.Join(configDir, "kmime", "config.yaml"), nil
+}
+
+func loadConfig(override string) (*kmimeConfig, error) {
+	path, err := configFilePath(override)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &kmimeConfig{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) && override == "" {
+			return cfg, nil
+		}
+		return nil, fmt.Errorf("could not read config file %s: %w", path, err)
+	}
+
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("could not parse config file %s: %w", path, err)
+	}
+	if cfg.StartupTimeout != "" {
+		if _, err := time.ParseDuration(cfg.StartupTimeout); err != nil {
+			return nil, fmt.Errorf("invalid startupTimeout in config file %s: %w", path, err)
+		}
+	}
+	return cfg, nil
+}
+
+func mergeStringMaps(maps ...map[string]string) map[string]string {
+	merged := make(map[string]string)
+	for _, m := range maps {
+		for k, v := range m {
+			merged[k] = v
+		}
+	}
+	return merged
+}
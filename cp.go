@@ -0,0 +1,206 @@
+package main
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+var cpCmd = &cobra.Command{
+	Use:   "cp [src] [dst]",
+	Short: "Copies files and directories between the local machine and a kmime clone.",
+	Long: `cp copies a file or directory to or from a clone, with one side written as
+<pod>:<path>, like kubectl cp:
+
+  kmime cp ./fixtures my-app-kmime-4f2a:/tmp/fixtures -n production
+  kmime cp my-app-kmime-4f2a:/tmp/report.html ./report.html -n production
+
+The files are sent as a tar stream over exec, so the container needs tar.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		namespace, _ := cmd.Flags().GetString("namespace")
+		container, _ := cmd.Flags().GetString("container")
+
+		srcPod, srcPath := parseCopyArg(args[0])
+		dstPod, dstPath := parseCopyArg(args[1])
+		if (srcPod == "") == (dstPod == "") {
+			log.Fatalf("Error processing arguments: exactly one of src and dst must be <pod>:<path>")
+		}
+
+		clientset, config, err := getKubeConfig()
+		if err != nil {
+			log.Fatalf("Could not get Kubernetes config: %v", err)
+		}
+		if container == "" {
+			pod, err := getPod(clientset, namespace, srcPod+dstPod)
+			if err != nil {
+				log.Fatalf("Could not get pod: %v", err)
+			}
+			container = pod.Spec.Containers[0].Name
+		}
+		if srcPod != "" {
+			err = copyFromPod(clientset, config, namespace, srcPod, container, srcPath, dstPath)
+		} else {
+			err = copyToPod(clientset, config, namespace, dstPod, container, srcPath, dstPath)
+		}
+		if err != nil {
+			log.Fatalf("Copy failed: %v", err)
+		}
+	},
+}
+
+// parseCopyArg splits <pod>:<path>. Arguments without a colon, or whose
+// part before it looks like a local path, are local.
+func parseCopyArg(arg string) (pod, p string) {
+	pod, p, ok := strings.Cut(arg, ":")
+	if !ok || pod == "" || strings.ContainsAny(pod, `/\`) || strings.HasPrefix(pod, ".") {
+		return "", arg
+	}
+	return pod, p
+}
+
+// copyToPod copies the local file or directory to remotePath in the
+// container, creating its parent directories.
+func copyToPod(clientset *kubernetes.Clientset, config *rest.Config, namespace, podName, container, localPath, remotePath string) error {
+	if _, err := os.Stat(localPath); err != nil {
+		return err
+	}
+	remotePath = path.Clean(remotePath)
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeTar(writer, localPath, path.Base(remotePath)))
+	}()
+
+	var stderr strings.Builder
+	dir := path.Dir(remotePath)
+	command := []string{"sh", "-c", `mkdir -p "$1" && tar xf - -C "$1"`, "sh", dir}
+	if err := execInPod(clientset, config, namespace, podName, container, command, reader, io.Discard, &stderr); err != nil {
+		return fmt.Errorf("could not copy to %s:%s: %w: %s", podName, remotePath, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// copyFromPod copies the file or directory at remotePath in the container
+// to localPath.
+func copyFromPod(clientset *kubernetes.Clientset, config *rest.Config, namespace, podName, container, remotePath, localPath string) error {
+	remotePath = path.Clean(remotePath)
+	reader, writer := io.Pipe()
+	var stderr strings.Builder
+	go func() {
+		command := []string{"tar", "cf", "-", "-C", path.Dir(remotePath), path.Base(remotePath)}
+		err := execInPod(clientset, config, namespace, podName, container, command, nil, writer, &stderr)
+		if err != nil {
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		writer.CloseWithError(err)
+	}()
+
+	if err := readTar(reader, path.Base(remotePath), localPath); err != nil {
+		return fmt.Errorf("could not copy from %s:%s: %w", podName, remotePath, err)
+	}
+	return nil
+}
+
+// writeTar archives localPath with its entries renamed under name.
+func writeTar(w io.Writer, localPath, name string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.Walk(localPath, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localPath, file)
+		if err != nil {
+			return err
+		}
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(file); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = path.Join(name, filepath.ToSlash(rel))
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// readTar extracts an archive whose entries are under name into localPath.
+// Entries escaping localPath and links are skipped, since the archive comes
+// from the container.
+func readTar(r io.Reader, name, localPath string) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(name, filepath.FromSlash(path.Clean(header.Name)))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			log.Printf("Warning: skipping %s, it is outside of %s", header.Name, name)
+			continue
+		}
+		target := filepath.Join(localPath, rel)
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode).Perm())
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		default:
+			log.Printf("Warning: skipping %s, only files and directories are copied", header.Name)
+		}
+	}
+}
+
+func init() {
+	cpCmd.Flags().StringP("namespace", "n", "", "Namespace of the clone pod (required)")
+	cpCmd.MarkFlagRequired("namespace")
+	cpCmd.Flags().StringP("container", "c", "", "Container to copy to or from (defaults to the first container)")
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// createdClone is the pod or Job createClone made for a session.
+type createdClone struct {
+	kind      string
+	name      string
+	namespace string
+	// pod is the created pod, nil for a Job.
+	pod *v1.Pod
+	// adjustments describe the objects created alongside the clone, for
+	// the history.
+	adjustments []string
+}
+
+// finalizePod runs the mutation plugins from the config on the pod, once
+// patches, overrides, the env editor and --edit are done, so none of them
+// can undo the plugins' changes. It then points the pod at the Secret
+// holding its env secrets and mounts the ConfigMap holding its --script,
+// both named after the final pod. Every path that creates or shows a
+// clone calls it exactly once.
+func finalizePod(pod *v1.Pod, params *kmimeParams) (*v1.Pod, error) {
+	pod, err := runMutationPlugins(pod.DeepCopy(), params.mutationPlugins, params.sourcePod)
+	if err != nil {
+		return nil, err
+	}
+	if len(pod.Spec.Containers) == 0 {
+		return pod, nil
+	}
+	pod.Spec.Containers[0].Env = mergeEnv(pod.Spec.Containers[0].Env, secretRefEnvVars(pod.Name, params.secretRefs))
+	if params.script != nil {
+		addScriptVolume(pod)
+	}
+	return pod, nil
+}
+
+// createClone finalizes the pod and creates the clone, a pod or with
+// --as-job a Job, together with the Secret and ConfigMap it references.
+// Every object is added to tracker as soon as it exists, so it can be
+// removed if a later step fails; the Secret and ConfigMap are then owned
+// by the clone. It is the create path of the TUI, kmime each and kmime
+// serve.
+func createClone(clientset *kubernetes.Clientset, pod *v1.Pod, params *kmimeParams, tracker *cleanupTracker) (*createdClone, error) {
+	pod, err := finalizePod(pod, params)
+	if err != nil {
+		return nil, fmt.Errorf("could not customize pod spec: %w", err)
+	}
+
+	var envSecret *v1.Secret
+	switch {
+	case len(params.secretRefs) > 0:
+		secret, err := createEnvSecret(clientset, pod, params.secretRefs)
+		if err != nil {
+			return nil, err
+		}
+		envSecret = secret
+	case params.envSecret != nil:
+		// The quota prompt may have moved the pod to the debug namespace.
+		desired := params.envSecret.DeepCopy()
+		desired.Namespace = pod.Namespace
+		secret, err := createSecret(clientset, desired)
+		if err != nil {
+			return nil, err
+		}
+		envSecret = secret
+	}
+	if envSecret != nil {
+		tracker.track(clientset, "secret", envSecret.Namespace, envSecret.Name)
+	}
+	var scriptMap *v1.ConfigMap
+	if params.script != nil {
+		cm, err := createConfigMap(clientset, scriptConfigMap(pod, params.script))
+		if err != nil {
+			return nil, err
+		}
+		scriptMap = cm
+		tracker.track(clientset, "configmap", cm.Namespace, cm.Name)
+	}
+
+	clone := &createdClone{}
+	var owner metav1.OwnerReference
+	if params.asJob {
+		createdJob, err := createJob(clientset, jobForPod(pod, params))
+		if err != nil {
+			return nil, err
+		}
+		clone.kind, clone.name, clone.namespace = "job.batch", createdJob.Name, createdJob.Namespace
+		owner = jobOwnerReference(createdJob)
+	} else {
+		createdPod, err := createPod(clientset, pod)
+		if err != nil {
+			return nil, err
+		}
+		clone.kind, clone.name, clone.namespace = "pod", createdPod.Name, createdPod.Namespace
+		clone.pod = createdPod
+		owner = podOwnerReference(createdPod)
+	}
+	tracker.track(clientset, clone.kind, clone.namespace, clone.name)
+
+	if envSecret != nil {
+		if err := adoptSecret(clientset, envSecret, owner); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+		clone.adjustments = append(clone.adjustments, fmt.Sprintf("secret %s holds %s", envSecret.Name, strings.Join(sortedKeys(envSecret.Data), ", ")))
+	}
+	if scriptMap != nil {
+		if err := adoptConfigMap(clientset, scriptMap, owner); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+	return clone, nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ephemeralContainerAdjustment starts the adjustment recorded for a debug
+// session, which tells history entries of kmime debug apart.
+const ephemeralContainerAdjustment = "ephemeral container"
+
+var debugCmd = &cobra.Command{
+	Use:   "debug [pod] [command]",
+	Short: "Injects an ephemeral debug container into a running pod and attaches to it.",
+	Long: `debug adds an ephemeral container to the live source pod instead of creating
+a clone, in the style of kubectl debug. Use it when a bug only reproduces in the
+running instance.
+
+Ephemeral containers cannot be removed from a pod; the container stops when
+the session ends and disappears together with the pod.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		namespace, _ := cmd.Flags().GetString("namespace")
+		image, _ := cmd.Flags().GetString("image")
+		target, _ := cmd.Flags().GetString("target")
+		cfg, history := loadCommandConfig(cmd)
+
+		if image == "" {
+			image = defaultDebugSidecarImage
+			if cfg.DebugSidecarImage != "" {
+				image = cfg.DebugSidecarImage
+			}
+		}
+
+		commandToRun := shellCommand(cfg.ShellFallback)
+		if len(args) > 1 {
+			commandToRun = args[1:]
+		}
+
+		clientset, config, err := getKubeConfig()
+		if err != nil {
+			log.Fatalf("Could not get Kubernetes config: %v", err)
+		}
+		pod, err := getPod(clientset, namespace, args[0])
+		if err != nil {
+			log.Fatalf("Could not get source pod: %v", err)
+		}
+		if target == "" && len(pod.Spec.Containers) > 0 {
+			target = pod.Spec.Containers[0].Name
+		}
+
+		fmt.Printf("Adding ephemeral container to pod '%s'...\n", pod.Name)
+		containerName, err := addEphemeralContainer(clientset, pod, image, target, commandToRun)
+		if err != nil {
+			log.Fatalf("Could not add ephemeral container: %v", err)
+		}
+
+		var user string
+		if skip, _ := cmd.Flags().GetBool("skip-identification"); !skip {
+			user, err = getUserIdentifier()
+			if err != nil {
+				log.Fatalf("Error getting user identifier: %v", err)
+			}
+		}
+		entry := newLogEntry(&kmimeParams{
+			sourcePod:    pod.Name,
+			namespace:    namespace,
+			user:         user,
+			commandToRun: commandToRun,
+		}, pod.Name)
+		entry.Adjustments = []string{fmt.Sprintf("%s %s (%s) targeting %s", ephemeralContainerAdjustment, containerName, image, target)}
+		if err := history.append(entry); err != nil {
+			log.Printf("Warning: could not write to log file: %v", err)
+		}
+
+		fmt.Printf("Waiting for ephemeral container '%s' to start...\n", containerName)
+		if err := waitForEphemeralContainer(clientset, namespace, pod.Name, containerName, time.Minute*2); err != nil {
+			log.Fatalf("Ephemeral container did not start: %v", err)
+		}
+
+		err = attachToPod(clientset, config, namespace, pod.Name, containerName, sessionOptions{})
+		if !sessionEnded(err) {
+			fmt.Printf("An error occurred during execution: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Session finished. Ephemeral container '%s' remains in the pod's spec until the pod is replaced.\n", containerName)
+	},
+}
+
+func addEphemeralContainer(clientset *kubernetes.Clientset, pod *v1.Pod, image, target string, command []string) (string, error) {
+	name := fmt.Sprintf("kmime-debug-%d", time.Now().UnixNano()%100000)
+	updated := pod.DeepCopy()
+	updated.Spec.EphemeralContainers = append(updated.Spec.EphemeralContainers, v1.EphemeralContainer{
+		EphemeralContainerCommon: v1.EphemeralContainerCommon{
+			Name:    name,
+			Image:   image,
+			Command: command,
+			Stdin:   true,
+			TTY:     true,
+		},
+		TargetContainerName: target,
+	})
+
+	_, err := clientset.CoreV1().Pods(pod.Namespace).UpdateEphemeralContainers(context.TODO(), pod.Name, updated, metav1.UpdateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to update ephemeral containers of pod '%s': %w", pod.Name, err)
+	}
+	return name, nil
+}
+
+func waitForEphemeralContainer(clientset *kubernetes.Clientset, namespace, podName, containerName string, timeout time.Duration) error {
+	watcher, err := clientset.CoreV1().Pods(namespace).Watch(context.TODO(), metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("metadata.name=%s", podName),
+	})
+	if err != nil {
+		return fmt.Errorf("could not watch pod %s: %w", podName, err)
+	}
+	defer watcher.Stop()
+
+	deadline := time.After(timeout)
+	for {
+		select {
+		case event := <-watcher.ResultChan():
+			if event.Type == watch.Error {
+				return fmt.Errorf("watch error: %v", event.Object)
+			}
+			pod, ok := event.Object.(*v1.Pod)
+			if !ok {
+				return fmt.Errorf("unexpected object type in watch: %T", event.Object)
+			}
+			for _, status := range pod.Status.EphemeralContainerStatuses {
+				if status.Name != containerName {
+					continue
+				}
+				if status.State.Running != nil {
+					return nil
+				}
+				if status.State.Terminated != nil {
+					return fmt.Errorf("container terminated: %s", status.State.Terminated.Reason)
+				}
+			}
+		case <-deadline:
+			return fmt.Errorf("timeout waiting for ephemeral container %s to be running", containerName)
+		}
+	}
+}
+
+func init() {
+	debugCmd.Flags().StringP("namespace", "n", "", "Namespace of the pod (required)")
+	debugCmd.MarkFlagRequired("namespace")
+	debugCmd.Flags().String("image", "", "Image for the ephemeral container (defaults to the debug sidecar image)")
+	debugCmd.Flags().String("target", "", "Container whose process namespace the debug container joins (defaults to the first container)")
+	debugCmd.Flags().Bool("skip-identification", false, "Do not record the user identifier in the history")
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// defaultDetachKeys is docker's detach sequence.
+const defaultDetachKeys = "ctrl-p,ctrl-q"
+
+// errDetached is returned when the user typed the detach sequence. The
+// session keeps running in the pod.
+var errDetached = errors.New("detached from the session")
+
+// parseDetachKeys parses a docker-style sequence such as "ctrl-p,ctrl-q":
+// comma-separated keys, each a single character or ctrl-<key>. An empty
+// sequence disables detaching.
+func parseDetachKeys(spec string) ([]byte, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	var keys []byte
+	for _, key := range strings.Split(spec, ",") {
+		if letter, ok := strings.CutPrefix(key, "ctrl-"); ok && len(letter) == 1 {
+			switch c := letter[0]; {
+			case c >= 'a' && c <= 'z':
+				keys = append(keys, c-'a'+1)
+				continue
+			case c >= '@' && c <= '_':
+				keys = append(keys, c-'@')
+				continue
+			}
+		}
+		if len(key) != 1 {
+			return nil, fmt.Errorf("invalid detach key %q, expected a single character or ctrl-<key>", key)
+		}
+		keys = append(keys, key[0])
+	}
+	return keys, nil
+}
+
+// detachReader passes input through until the detach sequence is typed,
+// then calls detach and stops. Keys that start the sequence are held back
+// until it is clear they do not complete it.
+type detachReader struct {
+	r       io.Reader
+	keys    []byte
+	matched int
+	detach  func()
+}
+
+func (d *detachReader) Read(p []byte) (int, error) {
+	if len(d.keys) == 0 {
+		return d.r.Read(p)
+	}
+	buf := make([]byte, max(len(p)-len(d.keys), 1))
+	n, err := d.r.Read(buf)
+	out := p[:0]
+	for _, b := range buf[:n] {
+		if b == d.keys[d.matched] {
+			d.matched++
+			if d.matched == len(d.keys) {
+				d.detach()
+				return len(out), errDetached
+			}
+			continue
+		}
+		out = append(out, d.keys[:d.matched]...)
+		d.matched = 0
+		if b == d.keys[0] {
+			d.matched = 1
+			continue
+		}
+		out = append(out, b)
+	}
+	if err != nil {
+		out = append(out, d.keys[:d.matched]...)
+		d.matched = 0
+	}
+	return len(out), err
+}
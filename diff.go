@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	v1 "k8s.io/api/core/v1"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [source-pod] [command]",
+	Short: "Shows a unified diff between the source pod and the pod kmime would create.",
+	Long: `diff builds the clone exactly as kmime would with the same flags and prints a
+unified diff against the source pod's spec, so every modification (command,
+probes, labels, env, restartPolicy, ...) can be reviewed without creating
+anything. Status and server-managed metadata are left out.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		showSecrets, _ := cmd.Flags().GetBool("show-secrets")
+		context, _ := cmd.Flags().GetInt("context")
+		params := paramsFromFlags(cmd, args)
+
+		clientset, _, err := getKubeConfig()
+		if err != nil {
+			log.Fatalf("Could not get Kubernetes config: %v", err)
+		}
+		originalPod, err := getPod(clientset, params.namespace, args[0])
+		if err != nil {
+			log.Fatalf("Could not get source pod: %v", err)
+		}
+
+		clone, err := clonePod(originalPod, params)
+		if err != nil {
+			log.Fatalf("Could not clone pod: %v", err)
+		}
+		clone, err = customizePod(clone, params)
+		if err != nil {
+			log.Fatalf("Could not customize pod spec: %v", err)
+		}
+		for _, warning := range sanitizeClone(clientset, originalPod, clone, params) {
+			log.Printf("Warning: %s", warning)
+		}
+		clone, err = finalizePod(clone, params)
+		if err != nil {
+			log.Fatalf("Could not customize pod spec: %v", err)
+		}
+
+		source := comparablePod(originalPod)
+		if !showSecrets {
+			source, clone = maskSecrets(source), maskSecrets(clone)
+		}
+		diff, err := unifiedPodDiff(source, clone, context)
+		if err != nil {
+			log.Fatalf("Could not diff pods: %v", err)
+		}
+		if diff == "" {
+			fmt.Println("No differences.")
+			return
+		}
+		fmt.Print(diff)
+	},
+}
+
+// comparablePod drops the status and the metadata the API server manages,
+// which a clone never carries and would only add noise to the diff.
+func comparablePod(pod *v1.Pod) *v1.Pod {
+	stripped := pod.DeepCopy()
+	stripped.Status = v1.PodStatus{}
+	stripped.ManagedFields = nil
+	stripped.ResourceVersion = ""
+	stripped.UID = ""
+	stripped.Generation = 0
+	stripped.CreationTimestamp.Reset()
+	return stripped
+}
+
+func unifiedPodDiff(source, clone *v1.Pod, context int) (string, error) {
+	sourceYAML, err := podYAML(source)
+	if err != nil {
+		return "", err
+	}
+	cloneYAML, err := podYAML(clone)
+	if err != nil {
+		return "", err
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(sourceYAML)),
+		B:        difflib.SplitLines(string(cloneYAML)),
+		FromFile: fmt.Sprintf("%s/%s", source.Namespace, source.Name),
+		ToFile:   fmt.Sprintf("%s/%s", clone.Namespace, clone.Name),
+		Context:  context,
+	})
+}
+
+// previewOnlyFlags are root flags that make no sense for diff.
+var previewOnlyFlags = map[string]bool{
+	"preview":     true,
+	"force":       true,
+	"output":      true,
+	"dry-run":     true,
+	"edit":        true,
+	"edit-env":    true,
+	"confirm":     true,
+	"quiet":       true,
+	"validate":    true,
+	"schema-file": true,
+}
+
+// addCloneFlags shares the root command's clone flags with cmd, so it builds
+// the same pod as a real run. It must run after the root flags are defined.
+func addCloneFlags(cmd *cobra.Command) {
+	rootCmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if !previewOnlyFlags[f.Name] {
+			cmd.Flags().AddFlag(f)
+		}
+	})
+}
+
+func init() {
+	diffCmd.Flags().IntP("context", "U", 3, "Number of context lines around each change")
+}
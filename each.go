@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+var eachCmd = &cobra.Command{
+	Use:   "each -l [selector] -- [command]",
+	Short: "Runs a command in a clone of every pod matching a label selector.",
+	Long: `each clones every running pod matching the selector, runs the command in the
+clones in parallel and prints each pod's output and exit code, for fleet-wide
+diagnostics:
+
+  kmime each -n production -l app=worker -- cat /proc/loadavg
+
+The clones are removed once their command exits. With --exec the command runs
+in the matching pods themselves, like kubectl exec, which is faster but shares
+them with live traffic. kmime exits non-zero if the command failed on any pod.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		namespace, _ := cmd.Flags().GetString("namespace")
+		selector, _ := cmd.Flags().GetString("selector")
+		parallel, _ := cmd.Flags().GetInt("parallel")
+		inPlace, _ := cmd.Flags().GetBool("exec")
+		container, _ := cmd.Flags().GetString("container")
+		cfg, history := loadCommandConfig(cmd)
+		if parallel < 1 {
+			log.Fatalf("Error processing --parallel: must be at least 1")
+		}
+
+		clientset, config, err := getKubeConfig()
+		if err != nil {
+			log.Fatalf("Could not get Kubernetes config: %v", err)
+		}
+		pods, err := eachTargets(clientset, namespace, selector)
+		if err != nil {
+			log.Fatalf("Could not list pods: %v", err)
+		}
+		if len(pods) == 0 {
+			log.Fatalf("No running pods match %q in namespace %s", selector, namespace)
+		}
+
+		params := newDefaultParams(cfg)
+		params.namespace = namespace
+		params.commandToRun = args
+		params.noAttach = true
+		params.history = history
+		if skip, _ := cmd.Flags().GetBool("skip-identification"); !skip {
+			params.user, err = getUserIdentifier()
+			if err != nil {
+				log.Fatalf("Error getting user identifier: %v", err)
+			}
+		}
+
+		// An interrupt stops the runs that have not started; the clones
+		// already created are still removed.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		results := make([]eachResult, len(pods))
+		sem := make(chan struct{}, parallel)
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for i := range pods {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+
+				pod := &pods[i]
+				result := eachResult{pod: pod.Name}
+				var output lockedBuffer
+				switch {
+				case ctx.Err() != nil:
+					result.err = errors.New("interrupted")
+				case inPlace:
+					result.exitCode, result.err = execEach(clientset, config, pod, container, args, &output)
+				default:
+					result.exitCode, result.err = cloneEach(ctx, clientset, pod, params, &output)
+				}
+				result.output = output.buf.Bytes()
+				results[i] = result
+
+				mu.Lock()
+				defer mu.Unlock()
+				printEachResult(os.Stdout, result)
+			}()
+		}
+		wg.Wait()
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "POD\tEXIT CODE\tERROR")
+		failed := false
+		for _, result := range results {
+			errText := "-"
+			if result.err != nil {
+				errText = result.err.Error()
+			}
+			if result.err != nil || result.exitCode != 0 {
+				failed = true
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\n", result.pod, result.exitCode, errText)
+		}
+		w.Flush()
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// eachResult is the outcome of the command on one pod.
+type eachResult struct {
+	pod      string
+	output   []byte
+	exitCode int
+	err      error
+}
+
+// lockedBuffer collects stdout and stderr, which are written concurrently.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// eachTargets lists the running pods matching selector, leaving out kmime
+// clones, which inherit the labels of their source.
+func eachTargets(clientset *kubernetes.Clientset, namespace, selector string) ([]v1.Pod, error) {
+	list, err := clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	var pods []v1.Pod
+	for _, pod := range list.Items {
+		if pod.Labels[cloneLabel] == "true" || pod.Status.Phase != v1.PodRunning {
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	return pods, nil
+}
+
+// execEach runs command in the pod's container, or its first container.
+func execEach(clientset *kubernetes.Clientset, config *rest.Config, pod *v1.Pod, container string, command []string, output io.Writer) (int, error) {
+	if container == "" {
+		container = pod.Spec.Containers[0].Name
+	}
+	err := execInPod(clientset, config, pod.Namespace, pod.Name, container, command, nil, output, output)
+	var exitErr utilexec.CodeExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Code, nil
+	}
+	return 0, err
+}
+
+// cloneEach runs the command in a clone of pod, like kmime run, and removes
+// the clone afterwards.
+func cloneEach(ctx context.Context, clientset *kubernetes.Clientset, pod *v1.Pod, template *kmimeParams, output io.Writer) (int, error) {
+	params := *template
+	params.sourcePod = pod.Name
+	newPod, err := clonePod(pod, &params)
+	if err != nil {
+		return 0, err
+	}
+	newPod, err = customizePod(newPod, &params)
+	if err != nil {
+		return 0, err
+	}
+	for _, warning := range sanitizeClone(clientset, pod, newPod, &params) {
+		log.Printf("Warning: %s: %s", pod.Name, warning)
+	}
+
+	tracker := &cleanupTracker{}
+	clone, err := createClone(clientset, newPod, &params, tracker)
+	if err != nil {
+		tracker.cleanup(&params)
+		return 0, err
+	}
+	created := clone.pod
+	defer func() {
+		if err := deleteClone(clientset, created.Namespace, created.Name, &params); err != nil {
+			log.Printf("Warning: failed to clean up pod '%s': %v", created.Name, err)
+		}
+	}()
+	leaseCtx, stopLease := context.WithCancel(ctx)
+	defer stopLease()
+	if _, err := startLease(leaseCtx, clientset, created); err != nil {
+		log.Printf("Warning: %s: %v", pod.Name, err)
+	}
+	if params.logsDir != "" {
+		params.logFile = savedLogPath(params.logsDir, created.Name, time.Now())
+	}
+	if err := params.history.append(newLogEntry(&params, created.Name)); err != nil {
+		log.Printf("Warning: could not write to log file: %v", err)
+	}
+
+	if err := waitForPodStarted(clientset, created.Namespace, created.Name, params.startupTimeout); err != nil {
+		return 0, err
+	}
+	if err := followPodLogs(ctx, clientset, created.Namespace, created.Name, output); err != nil {
+		if ctx.Err() != nil {
+			return 0, errors.New("interrupted")
+		}
+		return 0, err
+	}
+	return containerExitCode(clientset, created.Namespace, created.Name)
+}
+
+// printEachResult prints a pod's output under a header with its exit code.
+func printEachResult(w io.Writer, result eachResult) {
+	status := fmt.Sprintf("exit code %d", result.exitCode)
+	if result.err != nil {
+		status = fmt.Sprintf("error: %v", result.err)
+	}
+	fmt.Fprintf(w, "=== %s (%s)\n", result.pod, status)
+	w.Write(result.output)
+	if len(result.output) > 0 && result.output[len(result.output)-1] != '\n' {
+		fmt.Fprintln(w)
+	}
+}
+
+func init() {
+	eachCmd.Flags().StringP("namespace", "n", "", "Namespace of the pods (required)")
+	eachCmd.MarkFlagRequired("namespace")
+	eachCmd.Flags().StringP("selector", "l", "", "Label selector of the pods to run the command on (required)")
+	eachCmd.MarkFlagRequired("selector")
+	eachCmd.Flags().Int("parallel", 5, "Pods to run the command on at the same time")
+	eachCmd.Flags().Bool("exec", false, "Run the command in the matching pods themselves instead of in clones")
+	eachCmd.Flags().StringP("container", "c", "", "Container to run the command in with --exec (defaults to the first container)")
+	eachCmd.Flags().Bool("skip-identification", false, "Skip appending user identification to the clone names")
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const editHeader = `# Edit the pod kmime is about to create. Lines beginning with '#' are
+# ignored; an empty file aborts the session.
+#
+`
+
+// editorCommand opens path in $KUBE_EDITOR or $EDITOR, falling back to vi.
+func editorCommand(path string) *exec.Cmd {
+	editor := os.Getenv("KUBE_EDITOR")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	args := strings.Fields(editor)
+	return exec.Command(args[0], append(args[1:], path)...)
+}
+
+// podYAML renders the pod for editing.
+func podYAML(pod *v1.Pod) ([]byte, error) {
+	withType := pod.DeepCopy()
+	withType.APIVersion = "v1"
+	withType.Kind = "Pod"
+	data, err := yaml.Marshal(withType)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal pod spec to YAML: %w", err)
+	}
+	return data, nil
+}
+
+// writeEditFile writes the YAML to a temporary file, prefixed with the
+// error from the previous attempt, if any.
+func writeEditFile(body []byte, previousErr error) (string, error) {
+	var b bytes.Buffer
+	b.WriteString(editHeader)
+	if previousErr != nil {
+		for _, line := range strings.Split(previousErr.Error(), "\n") {
+			b.WriteString("# error: " + line + "\n")
+		}
+		b.WriteString("#\n")
+	}
+	b.Write(body)
+
+	file, err := os.CreateTemp("", "kmime-edit-*.yaml")
+	if err != nil {
+		return "", fmt.Errorf("could not create temporary file: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(b.Bytes()); err != nil {
+		return "", fmt.Errorf("could not write temporary file: %w", err)
+	}
+	return file.Name(), nil
+}
+
+// errEditAborted is returned when the user empties the file.
+var errEditAborted = fmt.Errorf("edit aborted: the file was emptied")
+
+// loadEditedPod reads and validates the edited file. It also returns the
+// content without comments so an invalid edit can be reopened as is.
+func loadEditedPod(path string) (*v1.Pod, []byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read edited file: %w", err)
+	}
+
+	var content []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "#") {
+			content = append(content, line)
+		}
+	}
+	body := []byte(strings.Join(content, "\n"))
+	if strings.TrimSpace(string(body)) == "" {
+		return nil, nil, errEditAborted
+	}
+
+	var pod v1.Pod
+	if err := yaml.UnmarshalStrict(body, &pod); err != nil {
+		return nil, body, fmt.Errorf("invalid pod YAML: %w", err)
+	}
+	if err := validateEditedPod(&pod); err != nil {
+		return nil, body, err
+	}
+	return &pod, body, nil
+}
+
+func validateEditedPod(pod *v1.Pod) error {
+	if pod.Kind != "" && pod.Kind != "Pod" {
+		return fmt.Errorf("kind must be Pod, got %s", pod.Kind)
+	}
+	if pod.Name == "" && pod.GenerateName == "" {
+		return fmt.Errorf("metadata.name is required")
+	}
+	if len(pod.Spec.Containers) == 0 {
+		return fmt.Errorf("spec.containers must not be empty")
+	}
+	for i, c := range pod.Spec.Containers {
+		if c.Name == "" || c.Image == "" {
+			return fmt.Errorf("spec.containers[%d] needs a name and an image", i)
+		}
+	}
+	return nil
+}
+
+// editPod runs the editor in the foreground until the result is valid or
+// the user aborts, like kubectl edit.
+func editPod(pod *v1.Pod) (*v1.Pod, error) {
+	body, err := podYAML(pod)
+	if err != nil {
+		return nil, err
+	}
+	var previousErr error
+	for {
+		path, err := writeEditFile(body, previousErr)
+		if err != nil {
+			return nil, err
+		}
+		cmd := editorCommand(path)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			os.Remove(path)
+			return nil, fmt.Errorf("editor failed: %w", err)
+		}
+		edited, editedBody, err := loadEditedPod(path)
+		os.Remove(path)
+		if err == nil || err == errEditAborted {
+			return edited, err
+		}
+		body, previousErr = editedBody, err
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const historyKeyEnvVar = "KMIME_HISTORY_KEY"
+
+// encryptedHistoryHeader marks a history file whose contents are sealed with
+// AES-256-GCM under a key derived with scrypt from the passphrase and the
+// random salt that follows the header. Files without a header are treated
+// as plain JSON so existing histories keep working and are encrypted on the
+// next write.
+var encryptedHistoryHeader = []byte("KMIME-ENCRYPTED-V2\n")
+
+// scrypt parameters for the history key, the interactive-login cost
+// recommended by the scrypt paper.
+const (
+	historySaltSize = 16
+	scryptN         = 1 << 15
+	scryptR         = 8
+	scryptP         = 1
+)
+
+// loadHistoryKey returns the passphrase the history is encrypted with, or
+// nil when encryption is not configured. Keys are derived from it per file.
+func loadHistoryKey(cfg *kmimeConfig) ([]byte, error) {
+	if passphrase := os.Getenv(historyKeyEnvVar); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+	if cfg.HistoryKeyFile == "" {
+		return nil, nil
+	}
+
+	keyFile := expandHome(cfg.HistoryKeyFile)
+	data, err := os.ReadFile(keyFile)
+	if os.IsNotExist(err) {
+		data, err = generateKeyFile(keyFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read history key file %s: %w", keyFile, err)
+	}
+	return []byte(strings.TrimSpace(string(data))), nil
+}
+
+func generateKeyFile(path string) ([]byte, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	data := []byte(base64.StdEncoding.EncodeToString(raw) + "\n")
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// deriveKey stretches the passphrase into an AES-256 key with scrypt.
+func deriveKey(passphrase, salt []byte) ([]byte, error) {
+	return scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, 32)
+}
+
+func encryptHistory(passphrase, plaintext []byte) ([]byte, error) {
+	salt := make([]byte, historySaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	out := append([]byte{}, encryptedHistoryHeader...)
+	out = append(out, salt...)
+	out = append(out, nonce...)
+	// The header and salt are authenticated along with the contents.
+	return gcm.Seal(out, nonce, plaintext, out[:len(encryptedHistoryHeader)+historySaltSize]), nil
+}
+
+func decryptHistory(passphrase, data []byte) ([]byte, error) {
+	if !isEncryptedHistory(data) {
+		return data, nil
+	}
+	if passphrase == nil {
+		return nil, fmt.Errorf("history file is encrypted; set %s or historyKeyFile in the config", historyKeyEnvVar)
+	}
+
+	payload := data[len(encryptedHistoryHeader):]
+	if len(payload) < historySaltSize {
+		return nil, errors.New("encrypted history file is truncated")
+	}
+	key, err := deriveKey(passphrase, payload[:historySaltSize])
+	if err != nil {
+		return nil, err
+	}
+	additional := data[:len(encryptedHistoryHeader)+historySaltSize]
+	payload = payload[historySaltSize:]
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) < gcm.NonceSize() {
+		return nil, errors.New("encrypted history file is truncated")
+	}
+	nonce, ciphertext := payload[:gcm.NonceSize()], payload[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, additional)
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt history file (wrong key?): %w", err)
+	}
+	return plaintext, nil
+}
+
+func isEncryptedHistory(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedHistoryHeader)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
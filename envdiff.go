@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+)
+
+var envDiffCmd = &cobra.Command{
+	Use:   "env-diff [source-pod]",
+	Short: "Shows how the clone's environment differs from the source pod's.",
+	Long: `env-diff builds the clone with the given --env-file, -e and --env-from flags
+and lists the variables that would be added, overridden or removed in the
+target container, without creating anything.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		namespace, _ := cmd.Flags().GetString("namespace")
+		showSecrets, _ := cmd.Flags().GetBool("show-secrets")
+		cfg, _ := loadCommandConfig(cmd)
+		envs, envFrom, secretRefs := parseEnvFlags(cmd, cfg)
+		noInheritEnvFrom, _ := cmd.Flags().GetBool("no-inherit-env-from")
+		dropEnvFrom, _ := cmd.Flags().GetStringArray("drop-env-from")
+
+		clientset, _, err := getKubeConfig()
+		if err != nil {
+			log.Fatalf("Could not get Kubernetes config: %v", err)
+		}
+		originalPod, err := getPod(clientset, namespace, args[0])
+		if err != nil {
+			log.Fatalf("Could not get source pod: %v", err)
+		}
+		if len(originalPod.Spec.Containers) == 0 {
+			log.Fatalf("Source pod '%s' has no containers", originalPod.Name)
+		}
+
+		params := newDefaultParams(cfg)
+		params.sourcePod = args[0]
+		params.namespace = namespace
+		params.envs = envs
+		params.envFrom = envFrom
+		params.secretRefs = secretRefs
+		params.noInheritEnvFrom = noInheritEnvFrom
+		params.dropEnvFrom = dropEnvFrom
+		clone, err := clonePod(originalPod, params)
+		if err != nil {
+			log.Fatalf("Could not clone pod: %v", err)
+		}
+		clone, err = finalizePod(clone, params)
+		if err != nil {
+			log.Fatalf("Could not customize pod spec: %v", err)
+		}
+
+		changes := diffEnv(originalPod.Spec.Containers[0], clone.Spec.Containers[0])
+		if len(changes) == 0 {
+			fmt.Println("No environment changes.")
+			return
+		}
+		for _, c := range changes {
+			fmt.Println(c.format(!showSecrets))
+		}
+	},
+}
+
+type envChangeKind string
+
+const (
+	envAdded      envChangeKind = "+"
+	envOverridden envChangeKind = "~"
+	envRemoved    envChangeKind = "-"
+)
+
+// envChange is one difference between the source and clone environments.
+// Variables and envFrom sources are both reported; for a source, name holds
+// its kind/name and the values are empty.
+type envChange struct {
+	kind     envChangeKind
+	name     string
+	oldValue string
+	newValue string
+	envFrom  bool
+}
+
+func (c envChange) format(mask bool) string {
+	oldValue, newValue := c.oldValue, c.newValue
+	if mask && looksSecret(c.name, oldValue) {
+		oldValue = maskedValue
+	}
+	if mask && looksSecret(c.name, newValue) {
+		newValue = maskedValue
+	}
+
+	switch {
+	case c.envFrom:
+		return fmt.Sprintf("%s envFrom %s", c.kind, c.name)
+	case c.kind == envAdded:
+		return fmt.Sprintf("%s %s=%s", c.kind, c.name, newValue)
+	case c.kind == envRemoved:
+		return fmt.Sprintf("%s %s=%s", c.kind, c.name, oldValue)
+	}
+	return fmt.Sprintf("%s %s: %s -> %s", c.kind, c.name, oldValue, newValue)
+}
+
+// diffEnv compares the env and envFrom of two versions of a container, in
+// the clone's order followed by removed entries.
+func diffEnv(source, clone v1.Container) []envChange {
+	sourceEnv := make(map[string]v1.EnvVar)
+	for _, env := range source.Env {
+		sourceEnv[env.Name] = env
+	}
+
+	var changes []envChange
+	seen := make(map[string]bool)
+	for _, env := range clone.Env {
+		seen[env.Name] = true
+		old, existed := sourceEnv[env.Name]
+		switch {
+		case !existed:
+			changes = append(changes, envChange{kind: envAdded, name: env.Name, newValue: envDisplayValue(env)})
+		case envDisplayValue(old) != envDisplayValue(env):
+			changes = append(changes, envChange{kind: envOverridden, name: env.Name, oldValue: envDisplayValue(old), newValue: envDisplayValue(env)})
+		}
+	}
+	for _, env := range source.Env {
+		if !seen[env.Name] {
+			changes = append(changes, envChange{kind: envRemoved, name: env.Name, oldValue: envDisplayValue(env)})
+		}
+	}
+
+	sourceFrom := make(map[string]bool)
+	for _, from := range source.EnvFrom {
+		sourceFrom[envFromName(from)] = true
+	}
+	cloneFrom := make(map[string]bool)
+	for _, from := range clone.EnvFrom {
+		name := envFromName(from)
+		cloneFrom[name] = true
+		if !sourceFrom[name] {
+			changes = append(changes, envChange{kind: envAdded, name: name, envFrom: true})
+		}
+	}
+	for _, from := range source.EnvFrom {
+		if name := envFromName(from); !cloneFrom[name] {
+			changes = append(changes, envChange{kind: envRemoved, name: name, envFrom: true})
+		}
+	}
+	return changes
+}
+
+func envFromName(from v1.EnvFromSource) string {
+	var name string
+	switch {
+	case from.ConfigMapRef != nil:
+		name = "configmap/" + from.ConfigMapRef.Name
+	case from.SecretRef != nil:
+		name = "secret/" + from.SecretRef.Name
+	}
+	if from.Prefix != "" {
+		name += " (prefix " + from.Prefix + ")"
+	}
+	return name
+}
+
+// formatEnvDiff renders changes one per line for the TUI pane.
+func formatEnvDiff(changes []envChange) string {
+	if len(changes) == 0 {
+		return "   (no changes)\n"
+	}
+	var b strings.Builder
+	for _, c := range changes {
+		b.WriteString("   " + c.format(false) + "\n")
+	}
+	return b.String()
+}
+
+func init() {
+	envDiffCmd.Flags().StringP("namespace", "n", "", "Namespace of the source pod (required)")
+	envDiffCmd.MarkFlagRequired("namespace")
+	envDiffCmd.Flags().StringArray("env-file", []string{}, "Path to a file with environment variables, or - for stdin (can be repeated)")
+	envDiffCmd.Flags().StringArrayP("env", "e", []string{}, "Set an environment variable, applied after --env-file")
+	envDiffCmd.Flags().StringArray("env-from", []string{}, "Load environment variables from a ConfigMap or Secret")
+	envDiffCmd.Flags().Bool("no-inherit-env-from", false, "Do not inherit envFrom sources from the source container")
+	envDiffCmd.Flags().StringArray("drop-env-from", []string{}, "Drop an inherited envFrom source by name or kind/name")
+	envDiffCmd.Flags().Bool("show-secrets", false, "Do not mask secret-looking values")
+}
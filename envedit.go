@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	v1 "k8s.io/api/core/v1"
+)
+
+var (
+	cursorStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("69")).Bold(true)
+	disabledStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("8")).Strikethrough(true)
+	helpStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+)
+
+// envEditorHeight is the number of variables shown at once.
+const envEditorHeight = 15
+
+type envEntry struct {
+	env      v1.EnvVar
+	enabled  bool
+	original string
+	added    bool
+}
+
+// envEditor lets the user review and change the target container's
+// environment before the clone is created.
+type envEditor struct {
+	entries []envEntry
+	removed []string
+	cursor  int
+	offset  int
+
+	// source and envFrom feed the diff pane toggled with "v".
+	source   v1.Container
+	envFrom  []v1.EnvFromSource
+	showDiff bool
+
+	// editing is set while the input line is active; adding distinguishes
+	// a new KEY=value entry from editing the value under the cursor.
+	editing bool
+	adding  bool
+	input   string
+	err     string
+}
+
+func newEnvEditor(source, clone v1.Container) *envEditor {
+	e := &envEditor{source: source, envFrom: clone.EnvFrom}
+	for _, env := range clone.Env {
+		e.entries = append(e.entries, envEntry{env: env, enabled: true, original: env.Value})
+	}
+	return e
+}
+
+// update handles a key press and reports whether the user finished (done)
+// or aborted the editor.
+func (e *envEditor) update(msg tea.KeyMsg) (done, aborted bool) {
+	if e.editing {
+		e.updateInput(msg)
+		return false, false
+	}
+
+	e.err = ""
+	switch msg.String() {
+	case "up", "k":
+		if e.cursor > 0 {
+			e.cursor--
+		}
+	case "down", "j":
+		if e.cursor < len(e.entries)-1 {
+			e.cursor++
+		}
+	case " ", "t":
+		if len(e.entries) > 0 {
+			e.entries[e.cursor].enabled = !e.entries[e.cursor].enabled
+		}
+	case "enter", "e":
+		if len(e.entries) == 0 {
+			break
+		}
+		if e.entries[e.cursor].env.ValueFrom != nil {
+			e.err = "values from references can only be toggled or deleted"
+			break
+		}
+		e.editing = true
+		e.input = e.entries[e.cursor].env.Value
+	case "a":
+		e.editing = true
+		e.adding = true
+		e.input = ""
+	case "d", "delete":
+		if len(e.entries) == 0 {
+			break
+		}
+		if entry := e.entries[e.cursor]; !entry.added {
+			e.removed = append(e.removed, entry.env.Name)
+		}
+		e.entries = append(e.entries[:e.cursor], e.entries[e.cursor+1:]...)
+		if e.cursor >= len(e.entries) && e.cursor > 0 {
+			e.cursor--
+		}
+	case "v":
+		e.showDiff = !e.showDiff
+	case "c":
+		return true, false
+	case "q", "esc":
+		return false, true
+	}
+	e.scroll()
+	return false, false
+}
+
+func (e *envEditor) updateInput(msg tea.KeyMsg) {
+	switch msg.Type {
+	case tea.KeyEsc:
+		e.editing, e.adding = false, false
+	case tea.KeyEnter:
+		if e.adding {
+			envs, err := parseEnvVars([]string{e.input})
+			if err != nil {
+				e.err = err.Error()
+				return
+			}
+			e.entries = append(e.entries, envEntry{env: envs[0], enabled: true, added: true})
+			e.cursor = len(e.entries) - 1
+			e.scroll()
+		} else {
+			e.entries[e.cursor].env.Value = e.input
+		}
+		e.editing, e.adding, e.err = false, false, ""
+	case tea.KeyBackspace:
+		if runes := []rune(e.input); len(runes) > 0 {
+			e.input = string(runes[:len(runes)-1])
+		}
+	case tea.KeySpace:
+		e.input += " "
+	case tea.KeyRunes:
+		e.input += string(msg.Runes)
+	}
+}
+
+func (e *envEditor) scroll() {
+	if e.cursor < e.offset {
+		e.offset = e.cursor
+	}
+	if e.cursor >= e.offset+envEditorHeight {
+		e.offset = e.cursor - envEditorHeight + 1
+	}
+}
+
+// result returns the edited environment and a summary of the changes. Only
+// names are summarized so values never end up in the history.
+func (e *envEditor) result() ([]v1.EnvVar, []string) {
+	var envs []v1.EnvVar
+	var disabled, changed, added []string
+	for _, entry := range e.entries {
+		switch {
+		case !entry.enabled:
+			disabled = append(disabled, entry.env.Name)
+			continue
+		case entry.added:
+			added = append(added, entry.env.Name)
+		case entry.env.Value != entry.original:
+			changed = append(changed, entry.env.Name)
+		}
+		envs = append(envs, entry.env)
+	}
+
+	var summary []string
+	for _, change := range []struct {
+		verb  string
+		names []string
+	}{{"disabled", disabled}, {"changed", changed}, {"added", added}, {"removed", e.removed}} {
+		if len(change.names) > 0 {
+			summary = append(summary, fmt.Sprintf("env editor %s %s", change.verb, strings.Join(change.names, ", ")))
+		}
+	}
+	return envs, summary
+}
+
+func (e *envEditor) view() string {
+	var b strings.Builder
+	b.WriteString("\n Environment of the new pod:\n\n")
+	if len(e.entries) == 0 {
+		b.WriteString(helpStyle.Render("   (no variables)") + "\n")
+	}
+
+	end := min(e.offset+envEditorHeight, len(e.entries))
+	for i := e.offset; i < end; i++ {
+		entry := e.entries[i]
+		line := fmt.Sprintf("%s=%s", entry.env.Name, envDisplayValue(entry.env))
+		if e.editing && !e.adding && i == e.cursor {
+			line = fmt.Sprintf("%s=%s_", entry.env.Name, e.input)
+		}
+		if !entry.enabled {
+			line = disabledStyle.Render(line)
+		}
+		if i == e.cursor {
+			b.WriteString(cursorStyle.Render(" > ") + line + "\n")
+		} else {
+			b.WriteString("   " + line + "\n")
+		}
+	}
+	if len(e.entries) > envEditorHeight {
+		b.WriteString(helpStyle.Render(fmt.Sprintf("   (%d-%d of %d)", e.offset+1, end, len(e.entries))) + "\n")
+	}
+
+	if e.showDiff {
+		envs, _ := e.result()
+		b.WriteString("\n Changes compared to the source pod:\n")
+		b.WriteString(formatEnvDiff(diffEnv(e.source, v1.Container{Env: envs, EnvFrom: e.envFrom})))
+	}
+	if e.adding {
+		b.WriteString(fmt.Sprintf("\n New variable (KEY=value): %s_\n", e.input))
+	}
+	if e.err != "" {
+		b.WriteString(errorStyle.Render("\n "+e.err) + "\n")
+	}
+	if e.editing {
+		b.WriteString(helpStyle.Render("\n enter: save • esc: cancel") + "\n")
+	} else {
+		b.WriteString(helpStyle.Render("\n ↑/↓: move • space: toggle • e: edit • a: add • d: delete • v: diff • c: continue • ctrl+e: continue and edit YAML • q: abort") + "\n")
+	}
+	return b.String()
+}
+
+func envDisplayValue(env v1.EnvVar) string {
+	if env.ValueFrom == nil {
+		return env.Value
+	}
+	switch {
+	case env.ValueFrom.SecretKeyRef != nil:
+		return fmt.Sprintf("<secret %s/%s>", env.ValueFrom.SecretKeyRef.Name, env.ValueFrom.SecretKeyRef.Key)
+	case env.ValueFrom.ConfigMapKeyRef != nil:
+		return fmt.Sprintf("<configmap %s/%s>", env.ValueFrom.ConfigMapKeyRef.Name, env.ValueFrom.ConfigMapKeyRef.Key)
+	case env.ValueFrom.FieldRef != nil:
+		return fmt.Sprintf("<field %s>", env.ValueFrom.FieldRef.FieldPath)
+	case env.ValueFrom.ResourceFieldRef != nil:
+		return fmt.Sprintf("<resource %s>", env.ValueFrom.ResourceFieldRef.Resource)
+	}
+	return "<reference>"
+}
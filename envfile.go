@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// parseEnvFiles reads the files in order, later ones overriding earlier
+// ones. "-" reads the variables from stdin.
+func parseEnvFiles(paths []string) ([]v1.EnvVar, error) {
+	var envs []v1.EnvVar
+	readStdin := false
+	for _, path := range paths {
+		var fileEnvs []v1.EnvVar
+		var err error
+		if path == "-" {
+			if readStdin {
+				return nil, fmt.Errorf("stdin can only be used once as an env file")
+			}
+			readStdin = true
+			fileEnvs, err = parseEnvStdin()
+		} else {
+			fileEnvs, err = parseEnvFile(path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		envs = mergeEnv(envs, fileEnvs)
+	}
+	return envs, nil
+}
+
+// parseEnvStdin reads a dotenv document from stdin. Stdin is then pointed at
+// the controlling terminal, when there is one, so the TUI and the attached
+// shell stay interactive.
+func parseEnvStdin() ([]v1.EnvVar, error) {
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, fmt.Errorf("could not read env from stdin: %w", err)
+	}
+	if tty, err := os.Open("/dev/tty"); err == nil {
+		os.Stdin = tty
+	}
+
+	envs, err := parseDotenv(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("error reading env from stdin: %w", err)
+	}
+	return envs, nil
+}
+
+// parseEnvFile reads a dotenv file. It supports an optional "export"
+// prefix, single and double quoted values, escapes and multiline values in
+// double quotes, and inline comments after unquoted values.
+//
+// References such as ${VAR} or $VAR are turned into Kubernetes $(VAR)
+// references, so the kubelet resolves them against the variables defined
+// before them, including the ones inherited from the source pod.
+func parseEnvFile(filePath string) ([]v1.EnvVar, error) {
+	if filePath == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not open env file %s: %w", filePath, err)
+	}
+
+	envs, err := parseDotenv(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("error reading env file %s: %w", filePath, err)
+	}
+	return envs, nil
+}
+
+func parseDotenv(content string) ([]v1.EnvVar, error) {
+	var envs []v1.EnvVar
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+		name, rest, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected KEY=value", lineNo)
+		}
+		name = strings.TrimSpace(name)
+		if errs := validation.IsEnvVarName(name); len(errs) > 0 {
+			return nil, fmt.Errorf("line %d: invalid name %q: %s", lineNo, name, strings.Join(errs, "; "))
+		}
+		rest = strings.TrimLeft(rest, " \t")
+
+		var value string
+		switch {
+		case strings.HasPrefix(rest, `"`), strings.HasPrefix(rest, "'"):
+			quote := rest[0]
+			raw := rest[1:]
+			end := closingQuote(raw, quote)
+			// Quoted values may continue on the following lines.
+			for end < 0 && i+1 < len(lines) {
+				i++
+				raw += "\n" + lines[i]
+				end = closingQuote(raw, quote)
+			}
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated quoted value for %s", lineNo, name)
+			}
+			if trailing := strings.TrimSpace(raw[end+1:]); trailing != "" && !strings.HasPrefix(trailing, "#") {
+				return nil, fmt.Errorf("line %d: unexpected characters after quoted value for %s", lineNo, name)
+			}
+			if quote == '"' {
+				value = expandReferences(unescapeDoubleQuoted(raw[:end]))
+			} else {
+				value = strings.ReplaceAll(raw[:end], "$", "$$")
+			}
+		default:
+			if idx := strings.Index(rest, " #"); idx >= 0 {
+				rest = rest[:idx]
+			}
+			if idx := strings.Index(rest, "\t#"); idx >= 0 {
+				rest = rest[:idx]
+			}
+			value = expandReferences(strings.TrimSpace(rest))
+		}
+		envs = append(envs, v1.EnvVar{Name: name, Value: value})
+	}
+	return envs, nil
+}
+
+// closingQuote returns the index of the first unescaped quote in s, or -1.
+// Backslash escapes only apply inside double quotes.
+func closingQuote(s string, quote byte) int {
+	for i := 0; i < len(s); i++ {
+		if quote == '"' && s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == quote {
+			return i
+		}
+	}
+	return -1
+}
+
+// escapedDollar stands in for a backslash-escaped $ until references are
+// expanded.
+const escapedDollar = "\x00"
+
+func unescapeDoubleQuoted(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case '$':
+			b.WriteString(escapedDollar)
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// expandReferences rewrites ${VAR} and $VAR to $(VAR) and escapes every
+// other $ so Kubernetes keeps it literal.
+func expandReferences(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' {
+			if s[i:i+1] == escapedDollar {
+				b.WriteString("$$")
+			} else {
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == '{' {
+			if end := strings.IndexByte(s[i+2:], '}'); end > 0 {
+				b.WriteString("$(" + s[i+2:i+2+end] + ")")
+				i += end + 2
+				continue
+			}
+		}
+		name := 0
+		for i+1+name < len(s) && isEnvNameChar(s[i+1+name], name == 0) {
+			name++
+		}
+		if name > 0 {
+			b.WriteString("$(" + s[i+1:i+1+name] + ")")
+			i += name
+			continue
+		}
+		b.WriteString("$$")
+	}
+	return b.String()
+}
+
+func isEnvNameChar(c byte, first bool) bool {
+	switch {
+	case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		return true
+	case c >= '0' && c <= '9':
+		return !first
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+// outputEvents replaces the TUI with newline-delimited JSON progress events.
+const outputEvents = "events"
+
+// progressEvent is one line of -o events output.
+type progressEvent struct {
+	Event     string    `json:"event"`
+	Time      time.Time `json:"time"`
+	Namespace string    `json:"namespace,omitempty"`
+	Pod       string    `json:"pod,omitempty"`
+	Message   string    `json:"message,omitempty"`
+}
+
+// Event names, in the order a successful session emits them. Warnings and
+// errors can come at any point.
+const (
+	eventConnected  = "connected"
+	eventPodCreated = "pod_created"
+	eventPodRunning = "pod_running"
+	eventAttached   = "attached"
+	eventCleanedUp  = "cleaned_up"
+	eventWarning    = "warning"
+	eventError      = "error"
+)
+
+type eventWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newEventWriter(w io.Writer) *eventWriter {
+	return &eventWriter{enc: json.NewEncoder(w)}
+}
+
+func (w *eventWriter) emit(event progressEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	event.Time = time.Now().UTC()
+	w.enc.Encode(event)
+}
+
+// observe emits the event, if any, that a TUI message stands for.
+func (w *eventWriter) observe(m model, msg any) {
+	namespace := m.namespace
+	if namespace == "" {
+		namespace = m.params.namespace
+	}
+	switch msg := msg.(type) {
+	case kubeConnectedMsg:
+		w.emit(progressEvent{Event: eventConnected, Namespace: namespace})
+		for _, warning := range m.warnings {
+			w.emit(progressEvent{Event: eventWarning, Message: warning})
+		}
+	case preflightMsg:
+		for _, warning := range msg.warnings {
+			w.emit(progressEvent{Event: eventWarning, Message: warning})
+		}
+		for _, s := range msg.shortfalls {
+			w.emit(progressEvent{Event: eventWarning, Message: "resource quota: " + s.String()})
+		}
+	case podProgressMsg:
+		if msg.warning != "" && !slices.Contains(m.warnings, msg.warning) {
+			w.emit(progressEvent{Event: eventWarning, Namespace: namespace, Pod: m.newPodName, Message: msg.warning})
+		}
+	case toolingMsg:
+		for _, warning := range msg.warnings {
+			w.emit(progressEvent{Event: eventWarning, Message: warning})
+		}
+	case podCreatedMsg:
+		w.emit(progressEvent{Event: eventPodCreated, Namespace: msg.namespace, Pod: msg.podName})
+	case podRunningMsg:
+		w.emit(progressEvent{Event: eventPodRunning, Namespace: namespace, Pod: msg.podName})
+	case podStartedMsg:
+		w.emit(progressEvent{Event: eventPodRunning, Namespace: namespace, Pod: msg.podName})
+	case attachMsg:
+		w.emit(progressEvent{Event: eventAttached, Namespace: namespace, Pod: m.newPodName})
+	case podCleanedUpMsg:
+		w.emit(progressEvent{Event: eventCleanedUp, Namespace: namespace, Pod: m.newPodName})
+	case errorMsg:
+		w.emit(progressEvent{Event: eventError, Namespace: namespace, Pod: m.newPodName, Message: msg.err.Error()})
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// What --on-failure does with the clone when the session fails after it
+// was created.
+const (
+	onFailureAsk    = "ask"
+	onFailureKeep   = "keep"
+	onFailureDelete = "delete"
+	onFailureLogs   = "logs"
+)
+
+var onFailureModes = []string{onFailureAsk, onFailureKeep, onFailureDelete, onFailureLogs}
+
+// failureLogLines is how much of the clone's log --on-failure=logs prints.
+const failureLogLines int64 = 200
+
+type failureLogsMsg struct {
+	logs string
+	err  error
+}
+
+func validateOnFailure(mode string) error {
+	for _, m := range onFailureModes {
+		if mode == m {
+			return nil
+		}
+	}
+	return fmt.Errorf("expected ask, keep, delete or logs, got %q", mode)
+}
+
+// failed decides what happens to the clone after err ended the session,
+// following --on-failure. --keep always keeps it, and without the TUI
+// there is nobody to ask, so the clone is deleted.
+func (m model) failed(err error) (tea.Model, tea.Cmd) {
+	m.stopPortForward()
+	m.portForwardStop = nil
+	m.podStatus, m.podEvent = "", ""
+	m.waitDeadline = time.Time{}
+
+	mode := m.params.onFailure
+	if m.params.keep {
+		mode = onFailureKeep
+	} else if mode == onFailureAsk && m.params.headless {
+		mode = onFailureDelete
+	}
+	switch mode {
+	case onFailureAsk:
+		m.failurePrompt = err
+		return m, nil
+	case onFailureKeep:
+		m.cleanup.keep()
+		return m.Update(errorMsg{fmt.Errorf("%w\n%s", err, reattachHint(m.namespace, m.newPodName))})
+	case onFailureLogs:
+		m.sessionErr = err
+		m.statusText = fmt.Sprintf("Fetching the logs of pod '%s'...", m.newPodName)
+		return m, failureLogsCmd(m.clientset, m.namespace, m.newPodName)
+	default:
+		m.sessionErr = err
+		return m.removeClone()
+	}
+}
+
+// handleFailurePrompt lets the user keep a clone whose session failed.
+func (m model) handleFailurePrompt(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	err := m.failurePrompt
+	switch msg.String() {
+	case "k":
+		m.failurePrompt = nil
+		m.params.onFailure = onFailureKeep
+		return m.failed(err)
+	case "l":
+		m.failurePrompt = nil
+		m.params.onFailure = onFailureLogs
+		return m.failed(err)
+	case "enter", "d", "q":
+		m.failurePrompt = nil
+		m.params.onFailure = onFailureDelete
+		return m.failed(err)
+	}
+	return m, nil
+}
+
+// failureLogsCmd reads the end of the clone's log, to be printed once the
+// TUI exits.
+func failureLogsCmd(clientset *kubernetes.Clientset, namespace, podName string) tea.Cmd {
+	return func() tea.Msg {
+		tail := failureLogLines
+		logs, err := clientset.CoreV1().Pods(namespace).GetLogs(podName, &v1.PodLogOptions{TailLines: &tail}).DoRaw(context.TODO())
+		return failureLogsMsg{logs: string(logs), err: err}
+	}
+}
+
+// podFailure describes why a pod that ended in the Failed phase failed.
+func podFailure(pod *v1.Pod) error {
+	for _, status := range pod.Status.ContainerStatuses {
+		if t := status.State.Terminated; t != nil && t.ExitCode != 0 {
+			return fmt.Errorf("pod '%s' failed: container '%s' exited with code %d (%s)", pod.Name, status.Name, t.ExitCode, t.Reason)
+		}
+	}
+	reason := pod.Status.Reason
+	if reason == "" {
+		reason = "unknown reason"
+	}
+	return fmt.Errorf("pod '%s' failed: %s", pod.Name, reason)
+}
+
+// printFailureLogs prints the logs fetched with --on-failure=logs, if any.
+func printFailureLogs(final tea.Model) {
+	m, ok := final.(model)
+	if !ok || m.failureLogs == "" {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\nLast %d lines of the log of pod '%s':\n%s", failureLogLines, m.newPodName, m.failureLogs)
+	if !strings.HasSuffix(m.failureLogs, "\n") {
+		fmt.Fprintln(os.Stderr)
+	}
+}
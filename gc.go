@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Deletes kmime clones left behind by crashed sessions or --keep.",
+	Long: `gc lists the pods kmime created that are older than --older-than and deletes
+them after asking for confirmation. Sessions that crashed, lost their machine
+or were started with --keep leave such clones behind:
+
+  kmime gc -n production --older-than 2h
+  kmime gc --all-namespaces --dry-run
+
+--mine only deletes the clones you created, going by their kmime.io/user
+label, in every namespace unless -n is given and whatever their age unless
+--older-than is given:
+
+  kmime gc --mine
+
+Secrets, ConfigMaps and Leases kmime created for a clone that never came to
+own them, because kmime died halfway, are deleted too once they are older
+than --older-than and at least 10 minutes old.
+
+Clones whose session renews a lease are skipped whatever their age, and clones
+whose lease expired are deleted whatever their age, since the session that
+used them is gone. Pods of --as-job runs are left to their Job.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		namespace, _ := cmd.Flags().GetString("namespace")
+		allNamespaces, _ := cmd.Flags().GetBool("all-namespaces")
+		olderThan, _ := cmd.Flags().GetDuration("older-than")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		yes, _ := cmd.Flags().GetBool("yes")
+		mine, _ := cmd.Flags().GetBool("mine")
+		if namespace != "" && allNamespaces {
+			log.Fatalf("Error processing arguments: pass either -n or --all-namespaces")
+		}
+		if namespace == "" && !allNamespaces && !mine {
+			log.Fatalf("Error processing arguments: pass -n, --all-namespaces or --mine")
+		}
+		if namespace == "" {
+			namespace = v1.NamespaceAll
+		}
+		var user string
+		if mine {
+			var err error
+			user, err = getUserIdentifier()
+			if err != nil {
+				log.Fatalf("Error getting user identifier: %v", err)
+			}
+			if !cmd.Flags().Changed("older-than") {
+				olderThan = 0
+			}
+		}
+		if olderThan < 0 {
+			log.Fatalf("Error processing --older-than: must not be negative")
+		}
+
+		clientset, _, err := getKubeConfig()
+		if err != nil {
+			log.Fatalf("Could not get Kubernetes config: %v", err)
+		}
+		pods, err := staleClones(clientset, namespace, user, olderThan, time.Now())
+		if err != nil {
+			log.Fatalf("Could not list pods: %v", err)
+		}
+		orphans, err := orphanedAuxiliary(clientset, namespace, user, olderThan, time.Now())
+		if err != nil {
+			log.Fatalf("Could not list the objects created for clones: %v", err)
+		}
+		if len(pods) == 0 && len(orphans) == 0 {
+			switch {
+			case mine && olderThan == 0:
+				fmt.Printf("No kmime clones created by %s to delete.\n", user)
+			case mine:
+				fmt.Printf("No kmime clones created by %s older than %s or with an expired lease.\n", user, olderThan)
+			default:
+				fmt.Printf("No kmime clones older than %s or with an expired lease.\n", olderThan)
+			}
+			return
+		}
+
+		printClones(pods, orphans, time.Now())
+		if dryRun {
+			fmt.Printf("%d clone(s) and %d orphaned object(s) would be deleted (dry run).\n", len(pods), len(orphans))
+			return
+		}
+		if !yes {
+			if !term.IsTerminal(int(os.Stdin.Fd())) {
+				log.Fatalf("Error processing arguments: stdin is not a terminal, pass --yes to delete without confirmation")
+			}
+			fmt.Printf("Delete %d clone(s) and %d orphaned object(s)? [y/N] ", len(pods), len(orphans))
+			answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+				fmt.Println("Nothing deleted.")
+				return
+			}
+		}
+
+		failed := false
+		for _, pod := range pods {
+			if err := deletePod(clientset, pod.Namespace, pod.Name, nil); err != nil {
+				log.Printf("Warning: %v", err)
+				failed = true
+				continue
+			}
+			fmt.Printf("pod/%s deleted from %s\n", pod.Name, pod.Namespace)
+		}
+		for _, orphan := range orphans {
+			if err := deleteAuxiliaryObject(clientset, orphan.trackedObject); err != nil {
+				log.Printf("Warning: %v", err)
+				failed = true
+				continue
+			}
+			fmt.Printf("%s/%s deleted from %s\n", orphan.kind, orphan.name, orphan.namespace)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// staleClones lists the kmime clones whose lease expired, and those without
+// a lease created before now minus olderThan. Clones with a live lease and
+// pods that belong to a controller, such as a --as-job Job, are left out.
+// A non-empty user keeps only the clones that user created.
+func staleClones(clientset *kubernetes.Clientset, namespace, user string, olderThan time.Duration, now time.Time) ([]v1.Pod, error) {
+	selector := cloneLabel + "=true"
+	if user != "" && len(validation.IsValidLabelValue(user)) == 0 {
+		selector += "," + userKey + "=" + user
+	}
+	list, err := clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	var pods []v1.Pod
+	for _, pod := range list.Items {
+		if metav1.GetControllerOf(&pod) != nil {
+			continue
+		}
+		// Identifiers too long for a label are only in the annotation.
+		if user != "" && pod.Annotations[userKey] != user {
+			continue
+		}
+		lease, err := cloneLease(clientset, &pod)
+		if err != nil {
+			return nil, err
+		}
+		if lease != nil {
+			if leaseExpired(lease, now) {
+				pods = append(pods, pod)
+			}
+			continue
+		}
+		if now.Sub(pod.CreationTimestamp.Time) < olderThan {
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	return pods, nil
+}
+
+// orphanAge is how old an unowned Secret, ConfigMap or Lease must be
+// before gc deletes it, so the objects of a clone being created are spared.
+const orphanAge = 10 * time.Minute
+
+// orphanedObject is a Secret, ConfigMap or Lease created for a clone that
+// never came to own it, because kmime died before creating or adopting the
+// clone. Owned ones are garbage collected with their clone.
+type orphanedObject struct {
+	trackedObject
+	created time.Time
+}
+
+// orphanedAuxiliary lists the orphaned objects created before now minus
+// olderThan, or orphanAge if that is longer. A non-empty user keeps only
+// the objects created for that user's clones.
+func orphanedAuxiliary(clientset *kubernetes.Clientset, namespace, user string, olderThan time.Duration, now time.Time) ([]orphanedObject, error) {
+	selector := cloneLabel + "=true"
+	if user != "" {
+		// The objects only carry the user as a label.
+		if len(validation.IsValidLabelValue(user)) != 0 {
+			return nil, nil
+		}
+		selector += "," + userKey + "=" + user
+	}
+	opts := metav1.ListOptions{LabelSelector: selector}
+	var orphans []orphanedObject
+	add := func(kind string, meta metav1.ObjectMeta) {
+		if len(meta.OwnerReferences) > 0 || now.Sub(meta.CreationTimestamp.Time) < max(olderThan, orphanAge) {
+			return
+		}
+		orphans = append(orphans, orphanedObject{trackedObject{kind, meta.Namespace, meta.Name}, meta.CreationTimestamp.Time})
+	}
+
+	secrets, err := clientset.CoreV1().Secrets(namespace).List(context.TODO(), opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range secrets.Items {
+		add("secret", o.ObjectMeta)
+	}
+	configMaps, err := clientset.CoreV1().ConfigMaps(namespace).List(context.TODO(), opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range configMaps.Items {
+		add("configmap", o.ObjectMeta)
+	}
+	leases, err := clientset.CoordinationV1().Leases(namespace).List(context.TODO(), opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range leases.Items {
+		add("lease", o.ObjectMeta)
+	}
+	return orphans, nil
+}
+
+// printClones lists the pods and orphaned objects like kubectl get does,
+// with their namespace.
+func printClones(pods []v1.Pod, orphans []orphanedObject, now time.Time) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAMESPACE\tNAME\tSTATUS\tAGE")
+	for _, pod := range pods {
+		age := duration.HumanDuration(now.Sub(pod.CreationTimestamp.Time))
+		fmt.Fprintf(w, "%s\tpod/%s\t%s\t%s\n", pod.Namespace, pod.Name, pod.Status.Phase, age)
+	}
+	for _, orphan := range orphans {
+		age := duration.HumanDuration(now.Sub(orphan.created))
+		fmt.Fprintf(w, "%s\t%s/%s\tOrphaned\t%s\n", orphan.namespace, orphan.kind, orphan.name, age)
+	}
+	w.Flush()
+}
+
+func init() {
+	gcCmd.Flags().StringP("namespace", "n", "", "Namespace to clean up")
+	gcCmd.Flags().BoolP("all-namespaces", "A", false, "Clean up clones in every namespace")
+	gcCmd.Flags().Duration("older-than", 24*time.Hour, "Only delete clones created at least this long ago")
+	gcCmd.Flags().Bool("dry-run", false, "List the clones that would be deleted without deleting them")
+	gcCmd.Flags().BoolP("yes", "y", false, "Delete without asking for confirmation")
+	gcCmd.Flags().Bool("mine", false, "Only delete the clones you created, in every namespace unless -n is given")
+}
@@ -1,14 +1,17 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
+	"slices"
 	"strings"
 
 	"github.com/charmbracelet/bubbles/table"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 var baseStyle = lipgloss.NewStyle().
@@ -17,6 +20,13 @@ var baseStyle = lipgloss.NewStyle().
 
 type historyModel struct {
 	table table.Model
+	// entries are in the order of the table's rows, newest first.
+	entries []logEntry
+	// confirming is the entry waiting for the replay to be confirmed,
+	// and replay the one to run once the table exits.
+	confirming *logEntry
+	replay     *logEntry
+	notice     string
 }
 
 func (m historyModel) Init() tea.Cmd { return nil }
@@ -25,9 +35,31 @@ func (m historyModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if m.confirming != nil {
+			entry := m.confirming
+			m.confirming = nil
+			if msg.String() == "y" {
+				m.replay = entry
+				return m, tea.Quit
+			}
+			return m, nil
+		}
+		m.notice = ""
 		switch msg.String() {
 		case "q", "ctrl+c":
 			return m, tea.Quit
+		case "enter":
+			i := m.table.Cursor()
+			if i < 0 || i >= len(m.entries) {
+				return m, nil
+			}
+			entry := m.entries[i]
+			if err := replayable(entry); err != nil {
+				m.notice = err.Error()
+				return m, nil
+			}
+			m.confirming = &entry
+			return m, nil
 		}
 	case tea.WindowSizeMsg:
 		m.table.SetHeight(msg.Height - 4)
@@ -39,10 +71,149 @@ func (m historyModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 func (m historyModel) View() string {
-	return baseStyle.Render(m.table.View()) + "\n  Use ↑/↓ to navigate, q to quit\n"
+	if m.confirming != nil {
+		return fmt.Sprintf("\n  Replay the session of %s in %s from %s?\n\n    %s\n\n  %s\n",
+			m.confirming.SourcePod, m.confirming.Namespace, m.confirming.Timestamp.Format("2006-01-02 15:04:05"),
+			shellJoin(append([]string{"kmime"}, replayArgs(*m.confirming)...)),
+			helpStyle.Render("y to replay, any other key to go back"))
+	}
+	help := "  Use ↑/↓ to navigate, enter to replay a session, q to quit"
+	if m.notice != "" {
+		help = "  " + warningStyle.Render(m.notice)
+	}
+	return baseStyle.Render(m.table.View()) + "\n" + help + "\n"
+}
+
+// replayable reports why an entry cannot be replayed, such as entries of
+// kmime apply, whose source is a file, kmime debug, which added an
+// ephemeral container, and --script sessions recorded by older versions,
+// which did not keep the script's path.
+func replayable(entry logEntry) error {
+	if entry.SourcePod == "" || len(validation.IsDNS1123Subdomain(entry.SourcePod)) > 0 {
+		return fmt.Errorf("the session of %s cannot be replayed: its source is not a pod", entry.NewPodName)
+	}
+	for _, adjustment := range entry.Adjustments {
+		if strings.HasPrefix(adjustment, ephemeralContainerAdjustment) {
+			return fmt.Errorf("the session of %s cannot be replayed: it was a kmime debug session", entry.NewPodName)
+		}
+	}
+	if command := replayEntry(entry).Command; entry.Script == "" && len(command) > 0 && isScriptCommand(command) {
+		return fmt.Errorf("the session of %s cannot be replayed: the path of its --script was not recorded", entry.NewPodName)
+	}
+	return nil
 }
 
-func NewHistoryModel() (*historyModel, error) {
+// replayEntry returns the entry with the mode flags and user command that
+// older versions left in Command as wrappers: the default shell probe and
+// the --tmux wrapper. Sessions in place are told by their adjustment.
+func replayEntry(entry logEntry) logEntry {
+	if isTmuxCommand(entry.Command) {
+		entry.Tmux = true
+		entry.Command = entry.Command[4:]
+	}
+	if isShellCommand(entry.Command) {
+		entry.Command = nil
+	}
+	if slices.Contains(entry.Adjustments, inPlaceAdjustment) {
+		entry.InPlace = true
+	}
+	return entry
+}
+
+// isScriptCommand reports whether command runs a script mounted by
+// --script.
+func isScriptCommand(command []string) bool {
+	return strings.HasPrefix(command[0], scriptMountPath+"/") ||
+		(len(command) > 1 && command[0] == shellPath && strings.HasPrefix(command[1], scriptMountPath+"/"))
+}
+
+// replayArgs rebuilds the kmime arguments of a history entry: the same
+// source, namespace, mode flags, name prefix and suffix, labels, env files
+// and command. Env files read from stdin cannot be replayed and are left
+// out.
+func replayArgs(entry logEntry) []string {
+	entry = replayEntry(entry)
+	args := []string{entry.SourcePod}
+	if entry.Namespace != "" {
+		args = append(args, "-n", entry.Namespace)
+	}
+	switch {
+	case entry.InPlace:
+		args = append(args, "--in-place")
+	case entry.Tmux:
+		args = append(args, "--tmux")
+	case entry.Keepalive:
+		args = append(args, "--keepalive")
+	}
+	if entry.Script != "" {
+		args = append(args, "--script", entry.Script)
+	}
+	if entry.Prefix != "" {
+		args = append(args, "--prefix", entry.Prefix)
+	}
+	if entry.Suffix != "" {
+		args = append(args, "--suffix", entry.Suffix)
+	}
+	for _, key := range sortedKeys(entry.Labels) {
+		args = append(args, "-l", key+"="+entry.Labels[key])
+	}
+	envFiles := entry.EnvFiles
+	if len(envFiles) == 0 && entry.EnvFile != "" {
+		envFiles = strings.Split(entry.EnvFile, ", ")
+	}
+	for _, file := range envFiles {
+		if file != "-" {
+			args = append(args, "--env-file", file)
+		}
+	}
+	if len(entry.Command) > 0 {
+		args = append(append(args, "--"), entry.Command...)
+	}
+	return args
+}
+
+// replaySession runs kmime again with the arguments of the entry, on the
+// current terminal, and returns its exit code.
+func replaySession(entry logEntry) (int, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	cmd := exec.Command(self, replayArgs(entry)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	return 0, err
+}
+
+// shellJoin quotes the arguments for display as a shell command.
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && strings.IndexFunc(arg, func(r rune) bool {
+			return !strings.ContainsRune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:,@%+", r)
+		}) < 0 {
+			quoted[i] = arg
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
+
+// entryNamespace is the namespace shown for the entry, with the one the
+// clone was moved to.
+func entryNamespace(entry logEntry) string {
+	if entry.CloneNamespace != "" {
+		return entry.Namespace + " → " + entry.CloneNamespace
+	}
+	return entry.Namespace
+}
+
+func NewHistoryModel(history *historyStore) (*historyModel, error) {
 	columns := []table.Column{
 		{Title: "Timestamp", Width: 20},
 		{Title: "New Pod", Width: 30},
@@ -50,31 +221,27 @@ func NewHistoryModel() (*historyModel, error) {
 		{Title: "Namespace", Width: 20},
 		{Title: "User", Width: 20},
 		{Title: "Command", Width: 30},
+		{Title: "Log File", Width: 30},
 	}
 
-	var entries []logEntry
-	if _, err := os.Stat(logFileName); err == nil {
-		file, err := os.ReadFile(logFileName)
-		if err != nil {
-			return nil, fmt.Errorf("could not read log file: %w", err)
-		}
-		if len(file) > 0 {
-			if err := json.Unmarshal(file, &entries); err != nil {
-				return nil, fmt.Errorf("could not parse log file: %w", err)
-			}
-		}
+	entries, err := history.read()
+	if err != nil {
+		return nil, fmt.Errorf("could not read log file: %w", err)
 	}
 
 	var rows []table.Row
+	var ordered []logEntry
 	for i := len(entries) - 1; i >= 0; i-- {
 		entry := entries[i]
+		ordered = append(ordered, entry)
 		rows = append(rows, table.Row{
 			entry.Timestamp.Format("2006-01-02 15:04:05"),
 			entry.NewPodName,
 			entry.SourcePod,
-			entry.Namespace,
+			entryNamespace(entry),
 			entry.User,
-			strings.Join(entry.Command, " "),
+			strings.Join(replayEntry(entry).Command, " "),
+			entry.LogFile,
 		})
 	}
 
@@ -96,5 +263,5 @@ func NewHistoryModel() (*historyModel, error) {
 		Bold(false)
 	t.SetStyles(s)
 
-	return &historyModel{table: t}, nil
+	return &historyModel{table: t, entries: ordered}, nil
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// errIdleTimeout is returned when a session saw no input or output for
+// longer than --idle-timeout.
+var errIdleTimeout = errors.New("session idle timeout")
+
+// activityTracker records when a session last read or wrote anything.
+type activityTracker struct {
+	last atomic.Int64
+}
+
+func newActivityTracker() *activityTracker {
+	a := &activityTracker{}
+	a.touch()
+	return a
+}
+
+func (a *activityTracker) touch() {
+	a.last.Store(time.Now().UnixNano())
+}
+
+func (a *activityTracker) idleFor() time.Duration {
+	return time.Since(time.Unix(0, a.last.Load()))
+}
+
+// watch calls onIdle once the session has been idle for timeout, unless
+// ctx is done first.
+func (a *activityTracker) watch(ctx context.Context, timeout time.Duration, onIdle func()) {
+	ticker := time.NewTicker(min(timeout/10, time.Second) + time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if a.idleFor() >= timeout {
+				onIdle()
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (a *activityTracker) reader(r io.Reader) io.Reader {
+	return activityReader{r: r, tracker: a}
+}
+
+func (a *activityTracker) writer(w io.Writer) io.Writer {
+	return activityWriter{w: w, tracker: a}
+}
+
+type activityReader struct {
+	r       io.Reader
+	tracker *activityTracker
+}
+
+func (ar activityReader) Read(p []byte) (int, error) {
+	n, err := ar.r.Read(p)
+	if n > 0 {
+		ar.tracker.touch()
+	}
+	return n, err
+}
+
+type activityWriter struct {
+	w       io.Writer
+	tracker *activityTracker
+}
+
+func (aw activityWriter) Write(p []byte) (int, error) {
+	aw.tracker.touch()
+	return aw.w.Write(p)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	v1 "k8s.io/api/core/v1"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// inPlaceAdjustment marks history entries of sessions that ran in the
+// source pod instead of a clone.
+const inPlaceAdjustment = "exec'd into the source pod in place, no clone"
+
+// runInPlace execs the command into the source pod itself, like kubectl
+// exec, and returns the exit code to exit with. The session is still
+// recorded in the history under the source pod's name.
+func runInPlace(params *kmimeParams) int {
+	clientset, config, err := getKubeConfig()
+	if err != nil {
+		log.Fatalf("Could not get Kubernetes config: %v", err)
+	}
+	pod, err := getPod(clientset, params.namespace, params.sourcePod)
+	if err != nil {
+		log.Fatalf("Could not get source pod: %v", err)
+	}
+	if pod.Status.Phase != v1.PodRunning {
+		log.Fatalf("Cannot exec into pod '%s': it is %s, not Running", pod.Name, pod.Status.Phase)
+	}
+	if err := checkContainer(pod, params.container); err != nil {
+		log.Fatalf("Cannot exec into pod '%s': %v", pod.Name, err)
+	}
+	container := params.container
+	if container == "" {
+		container = pod.Spec.Containers[0].Name
+	}
+
+	entry := newLogEntry(params, pod.Name)
+	entry.Adjustments = []string{inPlaceAdjustment}
+	if err := params.history.append(entry); err != nil {
+		log.Printf("Warning: could not write to log file: %v", err)
+	}
+
+	if params.noAttach || params.pipedStdin {
+		var stdin io.Reader
+		if params.pipedStdin {
+			stdin = os.Stdin
+		}
+		err = execPiped(context.Background(), clientset, config, pod.Namespace, pod.Name, container, params.commandToRun, stdin)
+	} else {
+		fmt.Printf("Running in pod '%s' itself, not a clone; changes affect the live pod.\n", pod.Name)
+		// Detaching would end the exec like exiting does.
+		session := params.session
+		session.detachKeys = nil
+		err = execInteractive(clientset, config, pod.Namespace, pod.Name, container, params.commandToRun, session)
+	}
+	var exitErr utilexec.CodeExitError
+	switch {
+	case errors.As(err, &exitErr):
+		return exitErr.Code
+	case errors.Is(err, errIdleTimeout), sessionEnded(err):
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	batchv1 "k8s.io/api/batch/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	v1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	janitorName          = "kmime-janitor"
+	defaultJanitorImage  = "bitnami/kubectl:1.33"
+	defaultJanitorCron   = "*/15 * * * *"
+	defaultJanitorMaxAge = 24 * time.Hour
+)
+
+// janitorScript deletes the kmime clones whose lease expired, and those
+// without a lease created before the cutoff, in NAMESPACES or, when it is
+// empty, in every namespace. Pods of --as-job runs belong to their Job and
+// are skipped, like kmime gc does. RFC 3339 UTC timestamps compare
+// correctly as strings; fields are split on "|" so empty ones are kept.
+const janitorScript = `set -eu
+now=$(date +%s)
+cutoff=$(date -u -d "@$(( now - MAX_AGE_SECONDS ))" +%Y-%m-%dT%H:%M:%SZ)
+fields='{range .items[*]}{.metadata.namespace}{"|"}{.metadata.name}{"|"}{.metadata.creationTimestamp}{"|"}{.metadata.ownerReferences[0].kind}{"|"}{.metadata.annotations.kmime\.io/lease}{"\n"}{end}'
+clones() {
+  if [ -z "$NAMESPACES" ]; then
+    kubectl get pods --all-namespaces -l ` + cloneLabel + `=true,` + managedByLabel + `=` + managedByKmime + ` -o jsonpath="$fields"
+    return
+  fi
+  for namespace in $NAMESPACES; do
+    kubectl get pods -n "$namespace" -l ` + cloneLabel + `=true,` + managedByLabel + `=` + managedByKmime + ` -o jsonpath="$fields"
+  done
+}
+clones |
+while IFS='|' read -r namespace name created owner lease; do
+  if [ -n "$owner" ]; then
+    continue
+  fi
+  if [ -n "$lease" ]; then
+    renewal=$(kubectl get lease -n "$namespace" "$lease" -o jsonpath='{.spec.renewTime}|{.spec.leaseDurationSeconds}' 2>/dev/null || true)
+    if [ -n "$renewal" ]; then
+      if [ $(( $(date -u -d "${renewal%|*}" +%s) + ${renewal#*|} )) -lt "$now" ]; then
+        kubectl delete pod -n "$namespace" "$name" --wait=false
+      fi
+      continue
+    fi
+  fi
+  if [[ "$created" < "$cutoff" ]]; then
+    kubectl delete pod -n "$namespace" "$name" --wait=false
+  fi
+done
+`
+
+var installJanitorCmd = &cobra.Command{
+	Use:   "install-janitor",
+	Short: "Prints or installs a CronJob that deletes expired kmime clones.",
+	Long: `install-janitor generates a CronJob, with the ServiceAccount and RBAC it
+needs, that deletes the kmime clones whose lease expired, and the clones
+without a lease older than --max-age, in every namespace. It covers the clones
+kmime could not clean up itself because the client died.
+
+The manifest is printed as YAML for review or GitOps; --apply creates or
+updates the objects in the cluster instead:
+
+  kmime install-janitor -n kube-system --max-age 12h > janitor.yaml
+  kmime install-janitor -n kube-system --apply
+
+Scope: by default the janitor gets a ClusterRole to list and delete pods in
+every namespace, and only the kmime-clone and managed-by labels tell it which
+pods are clones, so anyone who can set those labels on a pod can have it
+deleted. --clone-namespace limits it to the given namespaces, with a Role in
+each instead of the ClusterRole. Pin --image by digest so the image that
+holds these permissions cannot change under it.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		namespace, _ := cmd.Flags().GetString("namespace")
+		maxAge, _ := cmd.Flags().GetDuration("max-age")
+		schedule, _ := cmd.Flags().GetString("schedule")
+		image, _ := cmd.Flags().GetString("image")
+		apply, _ := cmd.Flags().GetBool("apply")
+		cloneNamespaces, _ := cmd.Flags().GetStringArray("clone-namespace")
+		if maxAge < time.Minute {
+			log.Fatalf("Error processing --max-age: must be at least 1m")
+		}
+		if !strings.Contains(image, "@sha256:") {
+			fmt.Fprintf(os.Stderr, "Warning: the janitor image %s is not pinned by digest; pass --image <image>@sha256:<digest> so it cannot change under the janitor's permissions\n", image)
+		}
+
+		objects := janitorObjects(namespace, schedule, image, maxAge, cloneNamespaces)
+		if !apply {
+			data, err := renderObjects(objects, "yaml")
+			if err != nil {
+				log.Fatalf("Could not render the manifest: %v", err)
+			}
+			os.Stdout.Write(data)
+			return
+		}
+
+		clientset, _, err := getKubeConfig()
+		if err != nil {
+			log.Fatalf("Could not get Kubernetes config: %v", err)
+		}
+		for _, obj := range objects {
+			kind, name, err := applyJanitorObject(clientset, obj)
+			if err != nil {
+				log.Fatalf("Could not install the janitor: %v", err)
+			}
+			fmt.Printf("%s/%s configured\n", kind, name)
+		}
+	},
+}
+
+// janitorRules are what the janitor may do with clones and their leases.
+var janitorRules = []rbacv1.PolicyRule{{
+	APIGroups: []string{""},
+	Resources: []string{"pods"},
+	Verbs:     []string{"list", "delete"},
+}, {
+	APIGroups: []string{coordinationv1.GroupName},
+	Resources: []string{"leases"},
+	Verbs:     []string{"get"},
+}}
+
+// janitorObjects builds the janitor's ServiceAccount, its RBAC and its
+// CronJob. Without cloneNamespaces it gets a ClusterRole and
+// ClusterRoleBinding; otherwise a Role and RoleBinding in each of them.
+func janitorObjects(namespace, schedule, image string, maxAge time.Duration, cloneNamespaces []string) []runtime.Object {
+	meta := metav1.ObjectMeta{
+		Name:      janitorName,
+		Namespace: namespace,
+		Labels:    map[string]string{managedByLabel: managedByKmime},
+	}
+	script := fmt.Sprintf("MAX_AGE_SECONDS=%d\nNAMESPACES=%q\n", int64(maxAge.Seconds()), strings.Join(cloneNamespaces, " ")) + janitorScript
+	concurrency := batchv1.ForbidConcurrent
+	backoffLimit := int32(0)
+	subjects := []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: janitorName, Namespace: namespace}}
+
+	objects := []runtime.Object{&v1.ServiceAccount{ObjectMeta: meta}}
+	if len(cloneNamespaces) == 0 {
+		clusterMeta := metav1.ObjectMeta{Name: janitorName, Labels: meta.Labels}
+		objects = append(objects,
+			&rbacv1.ClusterRole{ObjectMeta: clusterMeta, Rules: janitorRules},
+			&rbacv1.ClusterRoleBinding{
+				ObjectMeta: clusterMeta,
+				RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: janitorName},
+				Subjects:   subjects,
+			},
+		)
+	}
+	for _, ns := range cloneNamespaces {
+		roleMeta := metav1.ObjectMeta{Name: janitorName, Namespace: ns, Labels: meta.Labels}
+		objects = append(objects,
+			&rbacv1.Role{ObjectMeta: roleMeta, Rules: janitorRules},
+			&rbacv1.RoleBinding{
+				ObjectMeta: roleMeta,
+				RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: janitorName},
+				Subjects:   subjects,
+			},
+		)
+	}
+
+	return append(objects,
+		&batchv1.CronJob{
+			ObjectMeta: meta,
+			Spec: batchv1.CronJobSpec{
+				Schedule:          schedule,
+				ConcurrencyPolicy: concurrency,
+				JobTemplate: batchv1.JobTemplateSpec{
+					Spec: batchv1.JobSpec{
+						BackoffLimit: &backoffLimit,
+						Template: v1.PodTemplateSpec{
+							ObjectMeta: metav1.ObjectMeta{Labels: meta.Labels},
+							Spec: v1.PodSpec{
+								ServiceAccountName: janitorName,
+								RestartPolicy:      v1.RestartPolicyNever,
+								Containers: []v1.Container{{
+									Name:    "janitor",
+									Image:   image,
+									Command: []string{"/bin/bash", "-c", script},
+								}},
+							},
+						},
+					},
+				},
+			},
+		},
+	)
+}
+
+// applyJanitorObject creates the object, or updates it when it exists.
+func applyJanitorObject(clientset *kubernetes.Clientset, obj runtime.Object) (string, string, error) {
+	ctx := context.TODO()
+	create, update := metav1.CreateOptions{}, metav1.UpdateOptions{}
+	var err error
+	switch o := obj.(type) {
+	case *v1.ServiceAccount:
+		client := clientset.CoreV1().ServiceAccounts(o.Namespace)
+		if _, err = client.Create(ctx, o, create); k8serrors.IsAlreadyExists(err) {
+			_, err = client.Update(ctx, o, update)
+		}
+		return "serviceaccount", o.Name, err
+	case *rbacv1.ClusterRole:
+		client := clientset.RbacV1().ClusterRoles()
+		if _, err = client.Create(ctx, o, create); k8serrors.IsAlreadyExists(err) {
+			_, err = client.Update(ctx, o, update)
+		}
+		return "clusterrole.rbac.authorization.k8s.io", o.Name, err
+	case *rbacv1.ClusterRoleBinding:
+		client := clientset.RbacV1().ClusterRoleBindings()
+		if _, err = client.Create(ctx, o, create); k8serrors.IsAlreadyExists(err) {
+			_, err = client.Update(ctx, o, update)
+		}
+		return "clusterrolebinding.rbac.authorization.k8s.io", o.Name, err
+	case *rbacv1.Role:
+		client := clientset.RbacV1().Roles(o.Namespace)
+		if _, err = client.Create(ctx, o, create); k8serrors.IsAlreadyExists(err) {
+			_, err = client.Update(ctx, o, update)
+		}
+		return "role.rbac.authorization.k8s.io", o.Name, err
+	case *rbacv1.RoleBinding:
+		client := clientset.RbacV1().RoleBindings(o.Namespace)
+		if _, err = client.Create(ctx, o, create); k8serrors.IsAlreadyExists(err) {
+			_, err = client.Update(ctx, o, update)
+		}
+		return "rolebinding.rbac.authorization.k8s.io", o.Name, err
+	case *batchv1.CronJob:
+		client := clientset.BatchV1().CronJobs(o.Namespace)
+		if _, err = client.Create(ctx, o, create); k8serrors.IsAlreadyExists(err) {
+			_, err = client.Update(ctx, o, update)
+		}
+		return "cronjob.batch", o.Name, err
+	}
+	return "", "", fmt.Errorf("unexpected object %T", obj)
+}
+
+func init() {
+	installJanitorCmd.Flags().StringP("namespace", "n", "kube-system", "Namespace to run the janitor in")
+	installJanitorCmd.Flags().Duration("max-age", defaultJanitorMaxAge, "Delete clones created at least this long ago")
+	installJanitorCmd.Flags().String("schedule", defaultJanitorCron, "Cron schedule of the janitor")
+	installJanitorCmd.Flags().String("image", defaultJanitorImage, "Image with kubectl and bash to run the janitor; pin it by digest (<image>@sha256:<digest>)")
+	installJanitorCmd.Flags().StringArray("clone-namespace", []string{}, "Only clean up clones in this namespace, with a Role there instead of a ClusterRole (can be repeated)")
+	installJanitorCmd.Flags().Bool("apply", false, "Create or update the objects in the cluster instead of printing them")
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// jobNameLabel is set by the Job controller on the pods it creates.
+const jobNameLabel = "job-name"
+
+// jobForPod wraps the clone in a batch/v1 Job. Nothing attaches to a Job's
+// pods, so stdin and the TTY are turned off and the command runs to
+// completion on its own.
+func jobForPod(pod *v1.Pod, params *kmimeParams) *batchv1.Job {
+	template := pod.DeepCopy()
+	if len(template.Spec.Containers) > 0 {
+		template.Spec.Containers[0].TTY = false
+		template.Spec.Containers[0].Stdin = false
+		template.Spec.Containers[0].StdinOnce = false
+	}
+	template.Spec.RestartPolicy = v1.RestartPolicyNever
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        pod.Name,
+			Namespace:   pod.Namespace,
+			Labels:      pod.Labels,
+			Annotations: pod.Annotations,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &params.backoffLimit,
+			Completions:             &params.completions,
+			TTLSecondsAfterFinished: params.ttlAfterFinished,
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      template.Labels,
+					Annotations: template.Annotations,
+				},
+				Spec: template.Spec,
+			},
+		},
+	}
+}
+
+func createJob(clientset *kubernetes.Clientset, job *batchv1.Job) (*batchv1.Job, error) {
+	created, err := clientset.BatchV1().Jobs(job.Namespace).Create(context.TODO(), job, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job '%s': %w", job.Name, err)
+	}
+	return created, nil
+}
+
+// dryRunJob submits the Job with DryRun=All, like dryRunPod.
+func dryRunJob(clientset *kubernetes.Clientset, job *batchv1.Job) (*batchv1.Job, error) {
+	opts := metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}}
+	created, err := clientset.BatchV1().Jobs(job.Namespace).Create(context.TODO(), job, opts)
+	if err != nil {
+		return nil, fmt.Errorf("server rejected job '%s': %s", job.Name, rejectionReason(err))
+	}
+	return created, nil
+}
+
+// jobOwnerReference makes an object garbage collected with the Job.
+func jobOwnerReference(job *batchv1.Job) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: "batch/v1",
+		Kind:       "Job",
+		Name:       job.Name,
+		UID:        job.UID,
+	}
+}
+
+// waitForJobPodCmd waits for the Job controller to start a pod and for its
+// container to start, so its logs can be followed.
+func waitForJobPodCmd(clientset *kubernetes.Clientset, namespace, jobName string, timeout time.Duration) tea.Cmd {
+	return func() tea.Msg {
+		deadline := time.Now().Add(timeout)
+		for {
+			pods, err := clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{
+				LabelSelector: fmt.Sprintf("%s=%s", jobNameLabel, jobName),
+			})
+			if err != nil {
+				return errorMsg{fmt.Errorf("could not list pods of job %s: %w", jobName, err)}
+			}
+			if len(pods.Items) > 0 {
+				podName := pods.Items[0].Name
+				if err := waitForPodStarted(clientset, namespace, podName, time.Until(deadline)); err != nil {
+					return errorMsg{err}
+				}
+				return podStartedMsg{podName: podName}
+			}
+			if time.Now().After(deadline) {
+				return errorMsg{fmt.Errorf("timeout waiting for job %s to start a pod", jobName)}
+			}
+			time.Sleep(2 * time.Second)
+		}
+	}
+}
+
+// followPodLogs streams the logs of the pod's first container to w until it
+// exits or ctx is done.
+func followPodLogs(ctx context.Context, clientset *kubernetes.Clientset, namespace, podName string, w io.Writer) error {
+	stream, err := clientset.CoreV1().Pods(namespace).GetLogs(podName, &v1.PodLogOptions{Follow: true}).Stream(ctx)
+	if err != nil {
+		return fmt.Errorf("could not follow logs of pod %s: %w", podName, err)
+	}
+	defer stream.Close()
+	_, err = io.Copy(w, stream)
+	return err
+}
+
+// followJobLogs streams the logs of every pod of the Job to w, one after
+// the other in the order they were created, until the Job finishes. With
+// --completions above 1, or retries after a failure, the Job runs several.
+// timeout bounds the wait for each pod to start.
+func followJobLogs(ctx context.Context, clientset *kubernetes.Clientset, namespace, jobName string, timeout time.Duration, w io.Writer) error {
+	followed := map[string]bool{}
+	for {
+		// The Job is read before its pods, so once it is finished the
+		// list holds every pod it ran.
+		job, err := clientset.BatchV1().Jobs(namespace).Get(ctx, jobName, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("could not get job %s: %w", jobName, err)
+		}
+		pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("%s=%s", jobNameLabel, jobName),
+		})
+		if err != nil {
+			return fmt.Errorf("could not list pods of job %s: %w", jobName, err)
+		}
+		slices.SortFunc(pods.Items, func(a, b v1.Pod) int {
+			return a.CreationTimestamp.Compare(b.CreationTimestamp.Time)
+		})
+		next := slices.IndexFunc(pods.Items, func(pod v1.Pod) bool { return !followed[pod.Name] })
+		if next >= 0 {
+			podName := pods.Items[next].Name
+			followed[podName] = true
+			if err := waitForPodStarted(clientset, namespace, podName, timeout); err != nil {
+				return err
+			}
+			if err := followPodLogs(ctx, clientset, namespace, podName, w); err != nil {
+				return err
+			}
+			continue
+		}
+		if jobFinished(job) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// jobFinished reports whether the Job completed or failed.
+func jobFinished(job *batchv1.Job) bool {
+	for _, condition := range job.Status.Conditions {
+		if (condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed) && condition.Status == v1.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
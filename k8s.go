@@ -2,19 +2,26 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	"golang.org/x/term"
 	v1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -51,6 +58,54 @@ func getPod(clientset *kubernetes.Clientset, namespace, podName string) (*v1.Pod
 	return pod, nil
 }
 
+type podNameData struct {
+	Source    string
+	Namespace string
+	Prefix    string
+	Suffix    string
+	User      string
+	Rand      string
+	Timestamp string
+}
+
+var invalidPodNameChars = regexp.MustCompile("[^a-z0-9-]+")
+
+// renderPodName executes a --name-template and normalizes the result into a
+// valid pod name.
+func renderPodName(nameTemplate string, data podNameData) (string, error) {
+	tmpl, err := template.New("name").Option("missingkey=error").Parse(nameTemplate)
+	if err != nil {
+		return "", fmt.Errorf("invalid name template: %w", err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("invalid name template: %w", err)
+	}
+
+	name := invalidPodNameChars.ReplaceAllString(strings.ToLower(b.String()), "-")
+	if len(name) > 63 {
+		name = name[:63]
+	}
+	name = strings.Trim(name, "-")
+	if name == "" {
+		return "", fmt.Errorf("name template %q rendered an empty pod name", nameTemplate)
+	}
+	return name, nil
+}
+
+func newPodNameData(originalPod *v1.Pod, params *kmimeParams) podNameData {
+	now := time.Now()
+	return podNameData{
+		Source:    originalPod.Name,
+		Namespace: originalPod.Namespace,
+		Prefix:    params.prefix,
+		Suffix:    params.suffix,
+		User:      params.user,
+		Rand:      fmt.Sprintf("%d", now.UnixNano()%10000),
+		Timestamp: now.Format("20060102-150405"),
+	}
+}
+
 func generateNewPodName(originalName, prefix, suffix, user string) string {
 	var nameParts []string
 	if prefix != "" {
@@ -72,29 +127,49 @@ func generateNewPodName(originalName, prefix, suffix, user string) string {
 	return strings.Trim(fullName, "-")
 }
 
-func clonePod(originalPod *v1.Pod, user string, command []string, prefix, suffix string, newLabels map[string]string, newEnvs []v1.EnvVar) *v1.Pod {
-	podName := generateNewPodName(originalPod.Name, prefix, suffix, user)
+func clonePod(originalPod *v1.Pod, params *kmimeParams) (*v1.Pod, error) {
+	podName := generateNewPodName(originalPod.Name, params.prefix, params.suffix, params.user)
+	if params.nameTemplate != "" {
+		name, err := renderPodName(params.nameTemplate, newPodNameData(originalPod, params))
+		if err != nil {
+			return nil, err
+		}
+		podName = name
+	}
 
-	finalLabels := make(map[string]string)
-	for k, v := range originalPod.Labels {
-		finalLabels[k] = v
+	inheritedLabels := mergeStringMaps(originalPod.Labels)
+	if params.noInheritLabels {
+		inheritedLabels = nil
 	}
-	for k, v := range newLabels {
-		finalLabels[k] = v
+	for _, key := range params.stripLabels {
+		delete(inheritedLabels, key)
 	}
 
+	finalLabels := mergeStringMaps(inheritedLabels, params.labels)
 	delete(finalLabels, "pod-template-hash")
-	finalLabels["kmime-clone"] = "true"
+
+	finalAnnotations := mergeStringMaps(originalPod.Annotations, params.annotations)
+	addManagementMetadata(finalLabels, finalAnnotations, originalPod.Name, params.user, time.Now())
+	if params.keepalive {
+		finalAnnotations[keepaliveAnnotation] = "true"
+	}
+	if params.tmux {
+		finalAnnotations[tmuxAnnotation] = "true"
+	}
 
 	newPod := &v1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        podName,
 			Namespace:   originalPod.Namespace,
 			Labels:      finalLabels,
-			Annotations: originalPod.Annotations,
+			Annotations: finalAnnotations,
 		},
 		Spec: *originalPod.Spec.DeepCopy(),
 	}
+	applyStrategy(newPod, params.strategy)
+	if !params.inheritAll {
+		sanitizeMetadata(newPod, params)
+	}
 
 	newPod.ObjectMeta.UID = ""
 	newPod.ObjectMeta.ResourceVersion = ""
@@ -102,35 +177,456 @@ func clonePod(originalPod *v1.Pod, user string, command []string, prefix, suffix
 	newPod.Status = v1.PodStatus{}
 
 	newPod.Spec.RestartPolicy = v1.RestartPolicyNever
-	newPod.Spec.Affinity = nil
+	if !params.keepReadinessGates {
+		// Gates such as load balancer target registration are never
+		// satisfied for a clone that no Service routes to.
+		newPod.Spec.ReadinessGates = nil
+	}
+	if params.stripAffinity {
+		newPod.Spec.Affinity = nil
+	}
+	if params.stripNodeSelector {
+		newPod.Spec.NodeSelector = nil
+	}
+	if params.stripTopologySpread {
+		newPod.Spec.TopologySpreadConstraints = nil
+	}
+	if params.terminationGracePeriod != nil {
+		newPod.Spec.TerminationGracePeriodSeconds = params.terminationGracePeriod
+	}
+	if params.ttl > 0 {
+		newPod.Spec.ActiveDeadlineSeconds = durationSeconds(params.ttl)
+	}
+	if params.runtimeClass != nil {
+		newPod.Spec.RuntimeClassName = nil
+		if *params.runtimeClass != "" {
+			newPod.Spec.RuntimeClassName = params.runtimeClass
+		}
+	}
+	if params.priorityClass != nil {
+		// Priority is resolved from the class by admission and must not
+		// carry over the source's value.
+		newPod.Spec.PriorityClassName = *params.priorityClass
+		newPod.Spec.Priority = nil
+		newPod.Spec.PreemptionPolicy = nil
+	}
 
 	if len(newPod.Spec.Containers) > 0 {
-		newPod.Spec.Containers[0].Command = command
+		newPod.Spec.Containers[0].Command = params.commandToRun
 		newPod.Spec.Containers[0].Args = nil
-		newPod.Spec.Containers[0].TTY = true
-		newPod.Spec.Containers[0].Stdin = true
+		newPod.Spec.Containers[0].TTY = !params.noAttach && !params.pipedStdin
+		newPod.Spec.Containers[0].Stdin = !params.noAttach
+		// With piped input the command sees EOF once the input ends.
+		newPod.Spec.Containers[0].StdinOnce = params.pipedStdin
+		if params.keepalive {
+			// The command is exec'd into the container instead, so exiting
+			// it does not end the pod.
+			newPod.Spec.Containers[0].Command = keepaliveCommand
+			newPod.Spec.Containers[0].TTY = false
+			newPod.Spec.Containers[0].Stdin = false
+			newPod.Spec.Containers[0].StdinOnce = false
+		}
 
 		newPod.Spec.Containers[0].LivenessProbe = nil
 		newPod.Spec.Containers[0].ReadinessProbe = nil
 		newPod.Spec.Containers[0].StartupProbe = nil
 
-		envMap := make(map[string]v1.EnvVar)
-		for _, env := range newPod.Spec.Containers[0].Env {
-			envMap[env.Name] = env
+		newPod.Spec.Containers[0].Env = mergeEnv(newPod.Spec.Containers[0].Env, params.envs)
+		newPod.Spec.Containers[0].EnvFrom = filterEnvFrom(newPod.Spec.Containers[0].EnvFrom, params.noInheritEnvFrom, params.dropEnvFrom)
+		newPod.Spec.Containers[0].EnvFrom = append(newPod.Spec.Containers[0].EnvFrom, params.envFrom...)
+	}
+	if params.stripLifecycleHooks {
+		for i := range newPod.Spec.Containers {
+			newPod.Spec.Containers[i].Lifecycle = nil
+		}
+	}
+	stripResources(newPod, params.noLimits, params.noRequests)
+	if params.stripExtendedResources {
+		stripExtendedResources(newPod, params.keepResources)
+	}
+	if params.smallProfile != nil {
+		applySmallProfile(newPod, params.smallProfile)
+	}
+	setEphemeralStorage(newPod, params.ephemeralRequest, params.ephemeralLimit)
+	newPod.Spec.Tolerations = append(newPod.Spec.Tolerations, params.tolerations...)
+	if len(params.nodeSelector) > 0 {
+		newPod.Spec.NodeSelector = mergeStringMaps(newPod.Spec.NodeSelector, params.nodeSelector)
+	}
+	newPod.Spec.HostAliases = append(newPod.Spec.HostAliases, params.hostAliases...)
+	applySecurityOverrides(newPod, params)
+	applyHostNamespaces(newPod, params)
+	addCapabilities(newPod, params.addCapabilities)
+	stripVolumes(newPod, params.stripVolumes, params.stripPVCVolumes)
+	addVolumes(newPod, params.extraVolumes)
+	if params.debugSidecarImage != "" {
+		newPod.Spec.Containers = append(newPod.Spec.Containers, debugSidecar(params.debugSidecarImage))
+	}
+	newPod.Spec.NodeName = ""
+	newPod.Spec.ServiceAccountName = originalPod.Spec.ServiceAccountName
+	if params.serviceAccount != "" {
+		newPod.Spec.ServiceAccountName = params.serviceAccount
+		newPod.Spec.DeprecatedServiceAccount = params.serviceAccount
+	}
+	if params.mountSAToken != nil {
+		newPod.Spec.AutomountServiceAccountToken = params.mountSAToken
+		if !*params.mountSAToken {
+			// The source's token volume was injected by admission and is
+			// copied like any other, so it has to go as well.
+			stripVolumes(newPod, serviceAccountTokenVolumes(newPod), false)
+		}
+	}
+	return newPod, nil
+}
+
+// serviceAccountTokenVolumes returns the names of the projected volumes
+// admission adds to mount the service account token, kube-api-access-*.
+func serviceAccountTokenVolumes(pod *v1.Pod) []string {
+	var names []string
+	for _, vol := range pod.Spec.Volumes {
+		if vol.Projected == nil || !strings.HasPrefix(vol.Name, "kube-api-access-") {
+			continue
+		}
+		for _, source := range vol.Projected.Sources {
+			if source.ServiceAccountToken != nil {
+				names = append(names, vol.Name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+const debugSidecarName = "kmime-debug"
+
+// debugSidecar returns a long-running tools container. Containers in a pod
+// always share the network namespace, so tcpdump, dig and curl inside it
+// see the same traffic as the cloned application.
+func debugSidecar(image string) v1.Container {
+	return v1.Container{
+		Name:    debugSidecarName,
+		Image:   image,
+		Command: []string{"sleep", "infinity"},
+		Stdin:   true,
+		TTY:     true,
+	}
+}
+
+// stripVolumes removes the named volumes (and, optionally, every PVC
+// volume) together with all mounts that reference them.
+func stripVolumes(pod *v1.Pod, names []string, pvcs bool) {
+	if len(names) == 0 && !pvcs {
+		return
+	}
+
+	removed := make(map[string]bool)
+	for _, name := range names {
+		removed[name] = true
+	}
+	var volumes []v1.Volume
+	for _, vol := range pod.Spec.Volumes {
+		if pvcs && vol.PersistentVolumeClaim != nil {
+			removed[vol.Name] = true
 		}
-		for _, env := range newEnvs {
-			envMap[env.Name] = env
+		if !removed[vol.Name] {
+			volumes = append(volumes, vol)
 		}
+	}
+	pod.Spec.Volumes = volumes
 
-		var finalEnvs []v1.EnvVar
-		for _, env := range envMap {
-			finalEnvs = append(finalEnvs, env)
+	for _, containers := range [][]v1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for i := range containers {
+			var mounts []v1.VolumeMount
+			for _, m := range containers[i].VolumeMounts {
+				if !removed[m.Name] {
+					mounts = append(mounts, m)
+				}
+			}
+			containers[i].VolumeMounts = mounts
+
+			var devices []v1.VolumeDevice
+			for _, d := range containers[i].VolumeDevices {
+				if !removed[d.Name] {
+					devices = append(devices, d)
+				}
+			}
+			containers[i].VolumeDevices = devices
 		}
-		newPod.Spec.Containers[0].Env = finalEnvs
 	}
-	newPod.Spec.NodeName = ""
-	newPod.Spec.ServiceAccountName = originalPod.Spec.ServiceAccountName
-	return newPod
+}
+
+func addVolumes(pod *v1.Pod, volumes []extraVolume) {
+	if len(pod.Spec.Containers) == 0 {
+		return
+	}
+	for _, v := range volumes {
+		pod.Spec.Volumes = append(pod.Spec.Volumes, v.volume)
+		pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, v.mount)
+	}
+}
+
+func stripResources(pod *v1.Pod, limits, requests bool) {
+	if !limits && !requests {
+		return
+	}
+	for _, containers := range [][]v1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for i := range containers {
+			if limits {
+				containers[i].Resources.Limits = nil
+			}
+			if requests {
+				containers[i].Resources.Requests = nil
+			}
+		}
+	}
+}
+
+// mergeEnv overrides variables in place and appends new ones, preserving
+// order so $(VAR) references resolve against earlier entries.
+func mergeEnv(existing, overrides []v1.EnvVar) []v1.EnvVar {
+	index := make(map[string]int)
+	merged := append([]v1.EnvVar(nil), existing...)
+	for i, env := range merged {
+		index[env.Name] = i
+	}
+	for _, env := range overrides {
+		if i, ok := index[env.Name]; ok {
+			merged[i] = env
+			continue
+		}
+		index[env.Name] = len(merged)
+		merged = append(merged, env)
+	}
+	return merged
+}
+
+// filterEnvFrom drops inherited envFrom sources, either all of them or the
+// ones named in drop as <name> or <kind>/<name>.
+func filterEnvFrom(sources []v1.EnvFromSource, dropAll bool, drop []string) []v1.EnvFromSource {
+	if dropAll {
+		return nil
+	}
+	dropped := make(map[string]bool)
+	for _, name := range drop {
+		dropped[name] = true
+	}
+	var kept []v1.EnvFromSource
+	for _, from := range sources {
+		kind, name, _ := strings.Cut(envFromName(from), "/")
+		name, _, _ = strings.Cut(name, " ")
+		if dropped[name] || dropped[kind+"/"+name] || (kind == "configmap" && dropped["cm/"+name]) {
+			continue
+		}
+		kept = append(kept, from)
+	}
+	return kept
+}
+
+// stripExtendedResources removes requests and limits for non-core resources
+// such as nvidia.com/gpu, except those named in keep.
+func stripExtendedResources(pod *v1.Pod, keep []string) {
+	kept := make(map[v1.ResourceName]bool)
+	for _, name := range keep {
+		kept[v1.ResourceName(name)] = true
+	}
+	strip := func(list v1.ResourceList) {
+		for name := range list {
+			if isExtendedResource(name) && !kept[name] {
+				delete(list, name)
+			}
+		}
+	}
+	for _, containers := range [][]v1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for i := range containers {
+			strip(containers[i].Resources.Limits)
+			strip(containers[i].Resources.Requests)
+		}
+	}
+}
+
+// isExtendedResource reports whether name is outside the kubernetes.io
+// domain, e.g. a device plugin resource.
+func isExtendedResource(name v1.ResourceName) bool {
+	domain, _, found := strings.Cut(string(name), "/")
+	if !found {
+		return false
+	}
+	return domain != "kubernetes.io" && !strings.HasSuffix(domain, ".kubernetes.io")
+}
+
+// applySmallProfile downsizes every container to the given CPU and memory
+// and removes all probes.
+func applySmallProfile(pod *v1.Pod, profile v1.ResourceList) {
+	for i := range pod.Spec.Containers {
+		container := &pod.Spec.Containers[i]
+		container.LivenessProbe = nil
+		container.ReadinessProbe = nil
+		container.StartupProbe = nil
+		if container.Resources.Requests == nil {
+			container.Resources.Requests = v1.ResourceList{}
+		}
+		if container.Resources.Limits == nil {
+			container.Resources.Limits = v1.ResourceList{}
+		}
+		for name, quantity := range profile {
+			container.Resources.Requests[name] = quantity
+			container.Resources.Limits[name] = quantity
+		}
+	}
+}
+
+// setEphemeralStorage overrides the ephemeral-storage request and limit of
+// the target container.
+func setEphemeralStorage(pod *v1.Pod, request, limit *resource.Quantity) {
+	if len(pod.Spec.Containers) == 0 {
+		return
+	}
+	resources := &pod.Spec.Containers[0].Resources
+	if request != nil {
+		if resources.Requests == nil {
+			resources.Requests = v1.ResourceList{}
+		}
+		resources.Requests[v1.ResourceEphemeralStorage] = *request
+	}
+	if limit != nil {
+		if resources.Limits == nil {
+			resources.Limits = v1.ResourceList{}
+		}
+		resources.Limits[v1.ResourceEphemeralStorage] = *limit
+	}
+}
+
+func applySecurityOverrides(pod *v1.Pod, params *kmimeParams) {
+	runAsUser := params.runAsUser
+	if params.runAsRoot {
+		root := int64(0)
+		runAsUser = &root
+	}
+	if runAsUser == nil && params.fsGroup == nil {
+		return
+	}
+
+	if pod.Spec.SecurityContext == nil {
+		pod.Spec.SecurityContext = &v1.PodSecurityContext{}
+	}
+	if params.fsGroup != nil {
+		pod.Spec.SecurityContext.FSGroup = params.fsGroup
+	}
+	if runAsUser == nil {
+		return
+	}
+
+	runAsNonRoot := *runAsUser != 0
+	pod.Spec.SecurityContext.RunAsUser = runAsUser
+	pod.Spec.SecurityContext.RunAsNonRoot = &runAsNonRoot
+
+	// Container-level settings take precedence over the pod's, so the
+	// target container has to be overridden as well.
+	if len(pod.Spec.Containers) > 0 {
+		container := &pod.Spec.Containers[0]
+		if container.SecurityContext == nil {
+			container.SecurityContext = &v1.SecurityContext{}
+		}
+		container.SecurityContext.RunAsUser = runAsUser
+		container.SecurityContext.RunAsNonRoot = &runAsNonRoot
+	}
+}
+
+func applyHostNamespaces(pod *v1.Pod, params *kmimeParams) {
+	if params.hostNetwork != nil {
+		pod.Spec.HostNetwork = *params.hostNetwork
+		// Without this the pod resolves names through the node's DNS
+		// configuration instead of the cluster's.
+		if pod.Spec.HostNetwork && (pod.Spec.DNSPolicy == "" || pod.Spec.DNSPolicy == v1.DNSClusterFirst) {
+			pod.Spec.DNSPolicy = v1.DNSClusterFirstWithHostNet
+		}
+		if !pod.Spec.HostNetwork && pod.Spec.DNSPolicy == v1.DNSClusterFirstWithHostNet {
+			pod.Spec.DNSPolicy = v1.DNSClusterFirst
+		}
+	}
+	if params.hostPID != nil {
+		pod.Spec.HostPID = *params.hostPID
+	}
+	if params.hostIPC != nil {
+		pod.Spec.HostIPC = *params.hostIPC
+	}
+	if params.shareProcessNamespace != nil {
+		pod.Spec.ShareProcessNamespace = params.shareProcessNamespace
+	}
+}
+
+func addCapabilities(pod *v1.Pod, capabilities []v1.Capability) {
+	if len(capabilities) == 0 || len(pod.Spec.Containers) == 0 {
+		return
+	}
+
+	container := &pod.Spec.Containers[0]
+	if container.SecurityContext == nil {
+		container.SecurityContext = &v1.SecurityContext{}
+	}
+	if container.SecurityContext.Capabilities == nil {
+		container.SecurityContext.Capabilities = &v1.Capabilities{}
+	}
+
+	existing := make(map[v1.Capability]bool)
+	for _, c := range container.SecurityContext.Capabilities.Add {
+		existing[c] = true
+	}
+	for _, c := range capabilities {
+		if !existing[c] {
+			container.SecurityContext.Capabilities.Add = append(container.SecurityContext.Capabilities.Add, c)
+			existing[c] = true
+		}
+	}
+
+	var drop []v1.Capability
+	for _, c := range container.SecurityContext.Capabilities.Drop {
+		if !existing[c] {
+			drop = append(drop, c)
+		}
+	}
+	container.SecurityContext.Capabilities.Drop = drop
+}
+
+// cloneWarnings lists the settings that make the clone deviate from the
+// source pod in ways that weaken its security posture.
+func cloneWarnings(params *kmimeParams) []string {
+	var warnings []string
+	if params.runAsRoot {
+		warnings = append(warnings, "the pod will run as root (UID 0) with runAsNonRoot disabled")
+	} else if params.runAsUser != nil {
+		warnings = append(warnings, fmt.Sprintf("the pod will run as UID %d instead of the source pod's user", *params.runAsUser))
+	}
+	if params.fsGroup != nil {
+		warnings = append(warnings, fmt.Sprintf("the pod's fsGroup is overridden to %d", *params.fsGroup))
+	}
+	if params.hostNetwork != nil && *params.hostNetwork {
+		warnings = append(warnings, "HOST NETWORK ENABLED: the pod shares the node's network stack and can bind to node ports")
+	}
+	if params.hostPID != nil && *params.hostPID {
+		warnings = append(warnings, "HOST PID ENABLED: the pod can see and signal every process on the node")
+	}
+	if params.hostIPC != nil && *params.hostIPC {
+		warnings = append(warnings, "HOST IPC ENABLED: the pod shares the node's IPC namespace")
+	}
+	if len(params.addCapabilities) > 0 {
+		var names []string
+		for _, c := range params.addCapabilities {
+			names = append(names, string(c))
+		}
+		warnings = append(warnings, fmt.Sprintf("the container gains the capabilities %s", strings.Join(names, ", ")))
+	}
+	return warnings
+}
+
+func checkServiceAccount(clientset *kubernetes.Clientset, namespace, name string) error {
+	_, err := clientset.CoreV1().ServiceAccounts(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return fmt.Errorf("service account '%s' does not exist in namespace '%s'", name, namespace)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get service account '%s' in namespace '%s': %w", name, namespace, err)
+	}
+	return nil
 }
 
 func createPod(clientset *kubernetes.Clientset, pod *v1.Pod) (*v1.Pod, error) {
@@ -141,15 +637,154 @@ func createPod(clientset *kubernetes.Clientset, pod *v1.Pod) (*v1.Pod, error) {
 	return createdPod, nil
 }
 
-func deletePod(clientset *kubernetes.Clientset, namespace, podName string) error {
-	err := clientset.CoreV1().Pods(namespace).Delete(context.TODO(), podName, metav1.DeleteOptions{})
+// dryRunPod submits the pod with DryRun=All, so admission webhooks, pod
+// security, quotas and defaulting run without persisting anything. It
+// returns the pod as the server would have stored it.
+func dryRunPod(clientset *kubernetes.Clientset, pod *v1.Pod) (*v1.Pod, error) {
+	opts := metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}}
+	createdPod, err := clientset.CoreV1().Pods(pod.Namespace).Create(context.TODO(), pod, opts)
+	if err != nil {
+		return nil, fmt.Errorf("server rejected pod '%s': %s", pod.Name, rejectionReason(err))
+	}
+	return createdPod, nil
+}
+
+// rejectionReason expands an API error with the field-level causes the
+// server attached to it that its message does not already mention.
+func rejectionReason(err error) string {
+	var status k8serrors.APIStatus
+	if !errors.As(err, &status) || status.Status().Details == nil {
+		return err.Error()
+	}
+	message := status.Status().Message
+	var b strings.Builder
+	b.WriteString(message)
+	for _, cause := range status.Status().Details.Causes {
+		if strings.Contains(message, cause.Message) {
+			continue
+		}
+		b.WriteString("\n  - ")
+		if cause.Field != "" {
+			b.WriteString(cause.Field + ": ")
+		}
+		b.WriteString(cause.Message)
+	}
+	return b.String()
+}
+
+// deletePod deletes the pod, using gracePeriod instead of the pod's own
+// terminationGracePeriodSeconds when it is set.
+func deletePod(clientset *kubernetes.Clientset, namespace, podName string, gracePeriod *int64) error {
+	err := clientset.CoreV1().Pods(namespace).Delete(context.TODO(), podName, metav1.DeleteOptions{GracePeriodSeconds: gracePeriod})
 	if err != nil && !k8serrors.IsNotFound(err) {
 		return fmt.Errorf("failed to delete pod '%s': %w", podName, err)
 	}
 	return nil
 }
 
+// forceDeletePod removes the pod without waiting for its containers to stop
+// and clears its finalizers, so a wedged finalizer cannot keep it around.
+func forceDeletePod(clientset *kubernetes.Clientset, namespace, podName string) error {
+	pod, err := clientset.CoreV1().Pods(namespace).Get(context.TODO(), podName, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get pod '%s': %w", podName, err)
+	}
+	if len(pod.Finalizers) > 0 {
+		patch := []byte(`{"metadata":{"finalizers":null}}`)
+		_, err := clientset.CoreV1().Pods(namespace).Patch(context.TODO(), podName, types.MergePatchType, patch, metav1.PatchOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return fmt.Errorf("failed to remove finalizers of pod '%s': %w", podName, err)
+		}
+	}
+	var immediately int64
+	return deletePod(clientset, namespace, podName, &immediately)
+}
+
+// deleteClone removes a clone at the end of a session, honouring
+// --delete-grace-period and --force-delete, after saving its logs with
+// --save-logs. Failed deletes are retried, and a clone that is still there
+// afterwards is reported as a leftover.
+func deleteClone(clientset *kubernetes.Clientset, namespace, podName string, params *kmimeParams) error {
+	if params.logFile != "" {
+		if err := saveLogs(clientset, namespace, podName, params.logFile); err != nil {
+			log.Printf("Warning: could not save the logs of pod '%s': %v", podName, err)
+		}
+	}
+	gracePeriod := params.terminationGracePeriod
+	if params.deleteGracePeriod != nil {
+		gracePeriod = params.deleteGracePeriod
+	}
+	attempts, err := retryCleanup(func() error {
+		if params.forceDelete {
+			if err := forceDeletePod(clientset, namespace, podName); err != nil {
+				return err
+			}
+		} else if err := deletePod(clientset, namespace, podName, gracePeriod); err != nil {
+			return err
+		}
+		return checkPodDeleted(clientset, namespace, podName)
+	})
+	if err != nil {
+		command := fmt.Sprintf("kubectl delete pod %s -n %s", podName, namespace)
+		if params.forceDelete {
+			command += " --grace-period=0 --force"
+		}
+		return &leftoverError{kind: "pod", namespace: namespace, name: podName, attempts: attempts, command: command, err: err}
+	}
+	return nil
+}
+
+// checkPodDeleted verifies a delete took effect: the pod is gone or
+// terminating. Terminating can take its whole grace period, which cleanup
+// does not wait for.
+func checkPodDeleted(clientset *kubernetes.Clientset, namespace, podName string) error {
+	pod, err := clientset.CoreV1().Pods(namespace).Get(context.TODO(), podName, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not check pod '%s' was deleted: %w", podName, err)
+	}
+	if pod.DeletionTimestamp == nil {
+		return fmt.Errorf("pod '%s' still exists after it was deleted", podName)
+	}
+	return nil
+}
+
+// defaultStartupTimeout is how long kmime waits for a new pod to start,
+// unless --timeout or the config says otherwise.
+const defaultStartupTimeout = 2 * time.Minute
+
 func waitForPodRunning(clientset *kubernetes.Clientset, namespace, podName string, timeout time.Duration) error {
+	return waitForPod(clientset, namespace, podName, "running", timeout, podRunning)
+}
+
+// podRunning is the waitForPod check for a pod to attach to.
+func podRunning(pod *v1.Pod) (bool, error) {
+	// Readiness is deliberately ignored: probes are removed from the
+	// clone and gates may never pass, so a running container is enough.
+	switch pod.Status.Phase {
+	case v1.PodRunning:
+		// A command that exits quickly next to a sidecar leaves the phase
+		// Running without the watch ever seeing its container run.
+		return containerStarted(pod) || containerExited(pod), nil
+	case v1.PodSucceeded:
+		return true, nil
+	case v1.PodFailed:
+		if err := missingShellError(pod); err != nil {
+			return false, err
+		}
+		return false, fmt.Errorf("pod terminated unexpectedly with phase %s", pod.Status.Phase)
+	}
+	return false, startupError(pod)
+}
+
+// waitForPod watches the pod until done reports true or fails. state
+// describes what is awaited, for the timeout error.
+func waitForPod(clientset *kubernetes.Clientset, namespace, podName, state string, timeout time.Duration, done func(*v1.Pod) (bool, error)) error {
 	watcher, err := clientset.CoreV1().Pods(namespace).Watch(context.TODO(), metav1.ListOptions{
 		FieldSelector: fmt.Sprintf("metadata.name=%s", podName),
 	})
@@ -158,6 +793,8 @@ func waitForPodRunning(clientset *kubernetes.Clientset, namespace, podName strin
 	}
 	defer watcher.Stop()
 
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
 	for {
 		select {
 		case event := <-watcher.ResultChan():
@@ -168,18 +805,46 @@ func waitForPodRunning(clientset *kubernetes.Clientset, namespace, podName strin
 			if !ok {
 				return fmt.Errorf("unexpected object type in watch: %T", event.Object)
 			}
-			switch pod.Status.Phase {
-			case v1.PodRunning, v1.PodSucceeded:
-				return nil
-			case v1.PodFailed:
-				return fmt.Errorf("pod terminated unexpectedly with phase %s", pod.Status.Phase)
+			if ok, err := done(pod); ok || err != nil {
+				return err
 			}
-		case <-time.After(timeout):
-			return fmt.Errorf("timeout waiting for pod %s to be running", podName)
+		case <-timer.C:
+			return fmt.Errorf("timeout waiting for pod %s to be %s after %s", podName, state, timeout)
 		}
 	}
 }
 
+// containerStarted reports whether the pod's first container, the one kmime
+// attaches to, is running.
+func containerStarted(pod *v1.Pod) bool {
+	if len(pod.Spec.Containers) == 0 {
+		return true
+	}
+	status := firstContainerStatus(pod)
+	return status != nil && status.State.Running != nil
+}
+
+// containerExited reports whether the pod's first container already ran and
+// terminated.
+func containerExited(pod *v1.Pod) bool {
+	status := firstContainerStatus(pod)
+	return status != nil && status.State.Terminated != nil
+}
+
+// firstContainerStatus returns the status of the pod's first container, or
+// nil if it has none yet.
+func firstContainerStatus(pod *v1.Pod) *v1.ContainerStatus {
+	if len(pod.Spec.Containers) == 0 {
+		return nil
+	}
+	for i, status := range pod.Status.ContainerStatuses {
+		if status.Name == pod.Spec.Containers[0].Name {
+			return &pod.Status.ContainerStatuses[i]
+		}
+	}
+	return nil
+}
+
 type terminalSizeQueue struct {
 	resizeChan chan remotecommand.TerminalSize
 }
@@ -192,31 +857,83 @@ func (t *terminalSizeQueue) Next() *remotecommand.TerminalSize {
 	return &size
 }
 
-func attachToPod(clientset *kubernetes.Clientset, config *rest.Config, namespace, podName string, command []string) error {
-	req := clientset.CoreV1().RESTClient().Post().
-		Resource("pods").
-		Name(podName).
-		Namespace(namespace).
-		SubResource("attach")
-	req.VersionedParams(&v1.PodAttachOptions{
-		Container: "",
-		Stdin:     true,
-		Stdout:    true,
-		Stderr:    true,
-		TTY:       true,
-	}, scheme.ParameterCodec)
+// attachToPod attaches the local terminal to the container. Typing the
+// detach keys ends the stream with errDetached, leaving the session running.
+func attachToPod(clientset *kubernetes.Clientset, config *rest.Config, namespace, podName, container string, opts sessionOptions) error {
+	return withRawTerminal(opts, func(ctx context.Context, stdin io.Reader, stdout io.Writer, sizeQueue remotecommand.TerminalSizeQueue) error {
+		return streamAttach(ctx, clientset, config, namespace, podName, container, stdin, stdout, sizeQueue)
+	})
+}
 
-	exec, err := remotecommand.NewSPDYExecutor(config, http.MethodPost, req.URL())
-	if err != nil {
-		return fmt.Errorf("failed to create SPDY executor: %w", err)
-	}
+// execInteractive runs command in the container with the local terminal
+// attached, like kubectl exec -it.
+func execInteractive(clientset *kubernetes.Clientset, config *rest.Config, namespace, podName, container string, command []string, opts sessionOptions) error {
+	return withRawTerminal(opts, func(ctx context.Context, stdin io.Reader, stdout io.Writer, sizeQueue remotecommand.TerminalSizeQueue) error {
+		req := clientset.CoreV1().RESTClient().Post().
+			Resource("pods").
+			Name(podName).
+			Namespace(namespace).
+			SubResource("exec")
+		req.VersionedParams(&v1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdin:     true,
+			Stdout:    true,
+			Stderr:    true,
+			TTY:       true,
+		}, scheme.ParameterCodec)
+
+		exec, err := remotecommand.NewSPDYExecutor(config, http.MethodPost, req.URL())
+		if err != nil {
+			return fmt.Errorf("failed to create SPDY executor: %w", err)
+		}
+		return exec.StreamWithContext(ctx, remotecommand.StreamOptions{
+			Stdin:             stdin,
+			Stdout:            stdout,
+			Tty:               true,
+			TerminalSizeQueue: sizeQueue,
+		})
+	})
+}
 
+// withRawTerminal puts the local terminal in raw mode and feeds its size,
+// and every change to it, to stream. stdin is cut off and the context
+// cancelled when the detach keys are typed or the idle timeout expires.
+// With a recorder, everything going through the terminal is recorded, and
+// with an output log, everything written to it is copied there.
+func withRawTerminal(opts sessionOptions, stream func(context.Context, io.Reader, io.Writer, remotecommand.TerminalSizeQueue) error) error {
 	oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
 	if err != nil {
 		return fmt.Errorf("failed to set terminal to raw mode: %w", err)
 	}
 	defer term.Restore(int(os.Stdin.Fd()), oldState)
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var detached atomic.Bool
+	var stdin io.Reader = &detachReader{r: os.Stdin, keys: opts.detachKeys, detach: func() {
+		detached.Store(true)
+		cancel()
+	}}
+	var stdout io.Writer = os.Stdout
+	if opts.recorder != nil {
+		stdin = recordingReader{r: stdin, recorder: opts.recorder}
+		stdout = recordingWriter{w: stdout, recorder: opts.recorder}
+	}
+	if opts.outputLog != nil {
+		stdout = io.MultiWriter(stdout, opts.outputLog)
+	}
+	var idled atomic.Bool
+	if opts.idleTimeout > 0 {
+		activity := newActivityTracker()
+		stdin, stdout = activity.reader(stdin), activity.writer(stdout)
+		go activity.watch(ctx, opts.idleTimeout, func() {
+			idled.Store(true)
+			fmt.Fprintf(os.Stdout, "\r\nkmime: no activity for %s, ending the session\r\n", opts.idleTimeout)
+			cancel()
+		})
+	}
+
 	resizeChan := make(chan remotecommand.TerminalSize)
 	sizeQueue := &terminalSizeQueue{resizeChan: resizeChan}
 
@@ -233,21 +950,91 @@ func attachToPod(clientset *kubernetes.Clientset, config *rest.Config, namespace
 				if newWidth != width || newHeight != height {
 					width = newWidth
 					height = newHeight
+					if opts.recorder != nil {
+						opts.recorder.resize(width, height)
+					}
 					resizeChan <- remotecommand.TerminalSize{Width: uint16(width), Height: uint16(height)}
 				}
+			case <-ctx.Done():
+				return
 			}
 		}
 	}()
 
-	err = exec.Stream(remotecommand.StreamOptions{
-		Stdin:             os.Stdin,
-		Stdout:            os.Stdout,
-		Stderr:            os.Stderr,
+	err = stream(ctx, stdin, stdout, sizeQueue)
+	if detached.Load() {
+		return errDetached
+	}
+	if idled.Load() {
+		return errIdleTimeout
+	}
+	return err
+}
+
+func streamAttach(ctx context.Context, clientset *kubernetes.Clientset, config *rest.Config, namespace, podName, container string, stdin io.Reader, stdout io.Writer, sizeQueue remotecommand.TerminalSizeQueue) error {
+	req := clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(podName).
+		Namespace(namespace).
+		SubResource("attach")
+	req.VersionedParams(&v1.PodAttachOptions{
+		Container: container,
+		Stdin:     true,
+		Stdout:    true,
+		Stderr:    true,
+		TTY:       true,
+	}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(config, http.MethodPost, req.URL())
+	if err != nil {
+		return fmt.Errorf("failed to create SPDY executor: %w", err)
+	}
+
+	return exec.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:             stdin,
+		Stdout:            stdout,
 		Tty:               true,
 		TerminalSizeQueue: sizeQueue,
 	})
+}
 
-	return err
+// execInPod runs a non-interactive command in a container and streams its
+// output to the given writers.
+func execInPod(clientset *kubernetes.Clientset, config *rest.Config, namespace, podName, container string, command []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	req := clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(podName).
+		Namespace(namespace).
+		SubResource("exec")
+	req.VersionedParams(&v1.PodExecOptions{
+		Container: container,
+		Command:   command,
+		Stdin:     stdin != nil,
+		Stdout:    stdout != nil,
+		Stderr:    stderr != nil,
+	}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(config, http.MethodPost, req.URL())
+	if err != nil {
+		return fmt.Errorf("failed to create SPDY executor: %w", err)
+	}
+
+	return exec.Stream(remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+}
+
+// missingTools reports which of the given executables are not on the
+// container's PATH.
+func missingTools(clientset *kubernetes.Clientset, config *rest.Config, namespace, podName, container string, tools []string) ([]string, error) {
+	script := fmt.Sprintf(`for t in %s; do command -v "$t" >/dev/null 2>&1 || echo "$t"; done`, strings.Join(tools, " "))
+	var stdout strings.Builder
+	if err := execInPod(clientset, config, namespace, podName, container, []string{"sh", "-c", script}, nil, &stdout, nil); err != nil {
+		return nil, err
+	}
+	return strings.Fields(stdout.String()), nil
 }
 
 func getUserIdentifier() (string, error) {
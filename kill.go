@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+)
+
+var killCmd = &cobra.Command{
+	Use:   "kill [pod]...",
+	Short: "Deletes running kmime clones.",
+	Long: `kill deletes the given clones, for example ones found with kmime list:
+
+  kmime kill my-app-pod-xyz-kmime-4f2a -n production
+
+Only pods kmime created can be deleted this way, so a typo cannot take down
+a workload. --force removes a stuck clone immediately, finalizers included.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		namespace, _ := cmd.Flags().GetString("namespace")
+		force, _ := cmd.Flags().GetBool("force")
+		gracePeriod, _ := cmd.Flags().GetDuration("delete-grace-period")
+		if gracePeriod < 0 {
+			log.Fatalf("Error processing --delete-grace-period: must not be negative")
+		}
+		params := &kmimeParams{
+			forceDelete:       force,
+			deleteGracePeriod: optionalDeleteGracePeriod(cmd, gracePeriod),
+		}
+
+		clientset, _, err := getKubeConfig()
+		if err != nil {
+			log.Fatalf("Could not get Kubernetes config: %v", err)
+		}
+		failed := false
+		for _, name := range args {
+			if err := killClone(clientset, namespace, name, params); err != nil {
+				log.Printf("Could not kill pod '%s': %v", name, err)
+				failed = true
+				continue
+			}
+			fmt.Printf("pod/%s deleted\n", name)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// killClone deletes the pod, like at the end of a session with params,
+// after checking it is a kmime clone.
+func killClone(clientset *kubernetes.Clientset, namespace, name string, params *kmimeParams) error {
+	pod, err := getPod(clientset, namespace, name)
+	if err != nil {
+		return err
+	}
+	if pod.Labels[cloneLabel] != "true" {
+		return fmt.Errorf("it is not a kmime clone (no %s=true label)", cloneLabel)
+	}
+	return deleteClone(clientset, namespace, name, params)
+}
+
+func init() {
+	killCmd.Flags().StringP("namespace", "n", "", "Namespace of the clones (required)")
+	killCmd.MarkFlagRequired("namespace")
+	killCmd.Flags().Duration("delete-grace-period", 0, "Grace period for the deletion (defaults to the pod's termination grace period)")
+	killCmd.Flags().Bool("force", false, "Delete immediately, removing the pods' finalizers")
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// leaseAnnotation names the Lease kmime renews while a session uses the
+// clone. Once the Lease expires nobody is using the clone and kmime gc or
+// the janitor may delete it.
+const leaseAnnotation = "kmime.io/lease"
+
+const (
+	leaseDuration      = 2 * time.Minute
+	leaseRenewInterval = 30 * time.Second
+)
+
+// startLease creates a Lease for the clone, owned by it so it goes away with
+// it, points the clone at it and renews it until ctx is done or the Lease is
+// deleted. The Lease is returned whenever it was created.
+func startLease(ctx context.Context, clientset *kubernetes.Clientset, pod *v1.Pod) (*coordinationv1.Lease, error) {
+	holder, _ := os.Hostname()
+	holder = fmt.Sprintf("%s/%d", holder, os.Getpid())
+	seconds := int32(leaseDuration.Seconds())
+	now := metav1.NewMicroTime(time.Now())
+	lease := &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            pod.Name,
+			Namespace:       pod.Namespace,
+			Labels:          auxiliaryLabels(pod),
+			OwnerReferences: []metav1.OwnerReference{podOwnerReference(pod)},
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &seconds,
+			AcquireTime:          &now,
+			RenewTime:            &now,
+		},
+	}
+	created, err := clientset.CoordinationV1().Leases(pod.Namespace).Create(context.TODO(), lease, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not create lease for pod '%s': %w", pod.Name, err)
+	}
+	patch, _ := json.Marshal(map[string]any{"metadata": map[string]any{"annotations": map[string]string{leaseAnnotation: created.Name}}})
+	if _, err := clientset.CoreV1().Pods(pod.Namespace).Patch(context.TODO(), pod.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return created, fmt.Errorf("could not annotate pod '%s' with its lease: %w", pod.Name, err)
+	}
+	go renewLease(ctx, clientset, created.Namespace, created.Name)
+	return created, nil
+}
+
+// renewLease keeps the Lease alive. Failed renewals are retried at the next
+// interval; the Lease only expires if they keep failing.
+func renewLease(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string) {
+	ticker := time.NewTicker(leaseRenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		patch, _ := json.Marshal(map[string]any{"spec": map[string]any{"renewTime": metav1.NewMicroTime(time.Now())}})
+		_, err := clientset.CoordinationV1().Leases(namespace).Patch(context.TODO(), name, types.MergePatchType, patch, metav1.PatchOptions{})
+		if k8serrors.IsNotFound(err) {
+			return
+		}
+	}
+}
+
+// releaseLease deletes the Lease of a clone that is kept on purpose, so it
+// is not mistaken for an abandoned one; it is then cleaned up by age.
+func releaseLease(clientset *kubernetes.Clientset, namespace, name string) {
+	err := clientset.CoordinationV1().Leases(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		fmt.Fprintf(os.Stderr, "Warning: could not release the lease of pod '%s': %v\n", name, err)
+	}
+}
+
+// leaseExpired reports whether the Lease was not renewed in time.
+func leaseExpired(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	return now.After(expiry)
+}
+
+// cloneLease returns the Lease the clone points at, or nil when it has
+// none: clones made before leases, kept clones and --as-job pods.
+func cloneLease(clientset *kubernetes.Clientset, pod *v1.Pod) (*coordinationv1.Lease, error) {
+	name := pod.Annotations[leaseAnnotation]
+	if name == "" {
+		return nil, nil
+	}
+	lease, err := clientset.CoordinationV1().Leases(pod.Namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil, nil
+	}
+	return lease, err
+}
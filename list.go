@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/charmbracelet/bubbles/table"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"k8s.io/client-go/kubernetes"
+)
+
+// listRefreshInterval is how often kmime list --watch reloads the clones.
+const listRefreshInterval = 5 * time.Second
+
+var listColumns = []string{"NAMESPACE", "NAME", "USER", "SOURCE", "AGE", "NODE", "STATUS"}
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the kmime clones currently running, with who created them.",
+	Long: `list shows the running and starting kmime clones in every namespace, or in
+the one given with -n, with their creator, source pod, age and node, so a team
+can see who is debugging what:
+
+  kmime list
+  kmime list -n production --watch
+
+With --watch the list is shown as a table that refreshes every few seconds.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		namespace, _ := cmd.Flags().GetString("namespace")
+		watch, _ := cmd.Flags().GetBool("watch")
+
+		clientset, _, err := getKubeConfig()
+		if err != nil {
+			log.Fatalf("Could not get Kubernetes config: %v", err)
+		}
+		if watch {
+			p := tea.NewProgram(newListModel(clientset, namespace), tea.WithAltScreen())
+			if _, err := p.Run(); err != nil {
+				fmt.Printf("An error occurred during execution: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		pods, err := activeClones(clientset, namespace)
+		if err != nil {
+			log.Fatalf("Could not list pods: %v", err)
+		}
+		if len(pods) == 0 {
+			fmt.Println("No kmime clones are running.")
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, strings.Join(listColumns, "\t"))
+		for _, row := range cloneRows(pods, time.Now()) {
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+		w.Flush()
+	},
+}
+
+// activeClones lists the clones that are running or still starting, oldest
+// first.
+func activeClones(clientset *kubernetes.Clientset, namespace string) ([]v1.Pod, error) {
+	list, err := clientset.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: cloneLabel + "=true"})
+	if err != nil {
+		return nil, err
+	}
+	var pods []v1.Pod
+	for _, pod := range list.Items {
+		if pod.Status.Phase == v1.PodRunning || pod.Status.Phase == v1.PodPending {
+			pods = append(pods, pod)
+		}
+	}
+	sort.SliceStable(pods, func(i, j int) bool {
+		return pods[i].CreationTimestamp.Before(&pods[j].CreationTimestamp)
+	})
+	return pods, nil
+}
+
+// cloneRows formats the pods for listColumns. Clones made before kmime
+// recorded its metadata show "-" for the creator and source.
+func cloneRows(pods []v1.Pod, now time.Time) [][]string {
+	orDash := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+	var rows [][]string
+	for _, pod := range pods {
+		rows = append(rows, []string{
+			pod.Namespace,
+			pod.Name,
+			orDash(pod.Annotations[userKey]),
+			orDash(pod.Annotations[sourcePodKey]),
+			duration.HumanDuration(now.Sub(pod.CreationTimestamp.Time)),
+			orDash(pod.Spec.NodeName),
+			podWaitStatus(&pod),
+		})
+	}
+	return rows
+}
+
+type listLoadedMsg struct {
+	pods []v1.Pod
+	err  error
+}
+
+type listTickMsg struct{}
+
+type cloneKilledMsg struct {
+	name string
+	err  error
+}
+
+// listModel is the table shown by kmime list --watch.
+type listModel struct {
+	clientset *kubernetes.Clientset
+	namespace string
+	table     table.Model
+	updated   time.Time
+	err       error
+	// killing is the row waiting for the kill to be confirmed.
+	killing table.Row
+	notice  string
+}
+
+func newListModel(clientset *kubernetes.Clientset, namespace string) listModel {
+	var columns []table.Column
+	for _, title := range listColumns {
+		columns = append(columns, table.Column{Title: title, Width: len(title)})
+	}
+	return listModel{
+		clientset: clientset,
+		namespace: namespace,
+		table:     table.New(table.WithColumns(columns), table.WithFocused(true)),
+	}
+}
+
+func (m listModel) load() tea.Cmd {
+	return func() tea.Msg {
+		pods, err := activeClones(m.clientset, m.namespace)
+		return listLoadedMsg{pods: pods, err: err}
+	}
+}
+
+func (m listModel) Init() tea.Cmd {
+	return m.load()
+}
+
+func (m listModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		if m.killing != nil {
+			row := m.killing
+			m.killing = nil
+			if msg.String() != "y" {
+				m.notice = ""
+				return m, nil
+			}
+			m.notice = fmt.Sprintf("Killing pod '%s'...", row[1])
+			return m, func() tea.Msg {
+				return cloneKilledMsg{name: row[1], err: killClone(m.clientset, row[0], row[1], &kmimeParams{})}
+			}
+		}
+		switch msg.String() {
+		case "q", "esc", "ctrl+c":
+			return m, tea.Quit
+		case "x":
+			if row := m.table.SelectedRow(); row != nil {
+				m.killing = row
+				m.notice = fmt.Sprintf("Kill pod '%s' in %s? [y/N]", row[1], row[0])
+			}
+			return m, nil
+		}
+	case cloneKilledMsg:
+		m.notice = fmt.Sprintf("Pod '%s' deleted.", msg.name)
+		if msg.err != nil {
+			m.notice = fmt.Sprintf("Could not kill pod '%s': %v", msg.name, msg.err)
+		}
+		return m, m.load()
+	case tea.WindowSizeMsg:
+		m.table.SetHeight(max(msg.Height-4, 1))
+		return m, nil
+	case listLoadedMsg:
+		m.err = msg.err
+		if msg.err == nil {
+			m.setRows(cloneRows(msg.pods, time.Now()))
+			m.updated = time.Now()
+		}
+		return m, tea.Tick(listRefreshInterval, func(time.Time) tea.Msg { return listTickMsg{} })
+	case listTickMsg:
+		if m.killing == nil {
+			m.notice = ""
+		}
+		return m, m.load()
+	}
+	var cmd tea.Cmd
+	m.table, cmd = m.table.Update(msg)
+	return m, cmd
+}
+
+// setRows replaces the rows, widening the columns to fit them.
+func (m *listModel) setRows(rows [][]string) {
+	columns := m.table.Columns()
+	var tableRows []table.Row
+	for _, row := range rows {
+		for i, cell := range row {
+			columns[i].Width = max(columns[i].Width, len(cell))
+		}
+		tableRows = append(tableRows, table.Row(row))
+	}
+	m.table.SetColumns(columns)
+	m.table.SetRows(tableRows)
+}
+
+func (m listModel) View() string {
+	var b strings.Builder
+	b.WriteString(m.table.View())
+	b.WriteString("\n")
+	switch {
+	case m.notice != "":
+		b.WriteString(warningStyle.Render(m.notice))
+	case m.err != nil:
+		b.WriteString(errorStyle.Render(fmt.Sprintf("Could not list pods: %v", m.err)))
+	case m.updated.IsZero():
+		b.WriteString(helpStyle.Render("Loading..."))
+	default:
+		b.WriteString(helpStyle.Render(fmt.Sprintf("%d clone(s) · updated %s · ↑/↓ to scroll, x to kill, q to quit", len(m.table.Rows()), m.updated.Format("15:04:05"))))
+	}
+	return b.String()
+}
+
+func init() {
+	listCmd.Flags().StringP("namespace", "n", "", "Namespace to list clones in (defaults to all namespaces)")
+	listCmd.Flags().BoolP("watch", "w", false, "Show the clones in a table that refreshes every few seconds")
+}
@@ -2,10 +2,21 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
 	"time"
 )
 
+// logEntry is a session in the history. Command is the command the user
+// gave: empty for the default shell, and the script's arguments with
+// Script. Older versions recorded the command kmime ran instead, wrappers
+// included.
 type logEntry struct {
 	Timestamp  time.Time         `json:"timestamp"`
 	NewPodName string            `json:"new_pod_name"`
@@ -16,32 +27,229 @@ type logEntry struct {
 	Prefix     string            `json:"prefix,omitempty"`
 	Suffix     string            `json:"suffix,omitempty"`
 	Labels     map[string]string `json:"labels,omitempty"`
-	EnvFile    string            `json:"env_file,omitempty"`
+	// EnvFiles are the absolute paths of the --env-file flags, "-" for
+	// stdin.
+	EnvFiles []string `json:"env_files,omitempty"`
+	// EnvFile is the ", "-joined --env-file list of older versions.
+	EnvFile string `json:"env_file,omitempty"`
+	// Script is the absolute path of --script.
+	Script string `json:"script,omitempty"`
+	// InPlace, Tmux and Keepalive record the session's mode flags.
+	InPlace   bool `json:"in_place,omitempty"`
+	Tmux      bool `json:"tmux,omitempty"`
+	Keepalive bool `json:"keepalive,omitempty"`
+	// CloneNamespace is where the clone was created, when it is not the
+	// source pod's Namespace, e.g. the debug namespace.
+	CloneNamespace string `json:"clone_namespace,omitempty"`
+	// LogFile is where the clone's logs are saved before it is deleted.
+	LogFile string `json:"log_file,omitempty"`
+	// Adjustments records changes kmime made to the clone on the user's
+	// behalf, such as quota remediations.
+	Adjustments []string `json:"adjustments,omitempty"`
 }
 
-const logFileName = "kmime_log.json"
+// legacyLogFileName is where older versions wrote the history, in
+// whatever directory kmime ran from.
+const legacyLogFileName = "kmime_log.json"
 
-func appendLog(entry logEntry) error {
+const historyEnvVar = "KMIME_HISTORY"
+
+type historyStore struct {
+	path     string
+	key      []byte
+	disabled bool
+
+	// mu serializes appends, which read and rewrite the whole file, from
+	// concurrent sessions such as the API server's.
+	mu sync.Mutex
+}
+
+func newHistoryStore(cfg *kmimeConfig) (*historyStore, error) {
+	if cfg.DisableHistory {
+		path, _ := historyFilePath(cfg)
+		return &historyStore{path: path, disabled: true}, nil
+	}
+	path, err := historyFilePath(cfg)
+	if err != nil {
+		return nil, err
+	}
+	key, err := loadHistoryKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+	h := &historyStore{path: path, key: key}
+	if err := h.migrate(legacyLogFileName); err != nil {
+		log.Printf("Warning: could not move the history from %s to %s: %v", legacyLogFileName, path, err)
+	}
+	return h, nil
+}
+
+// historyFilePath is $KMIME_HISTORY, historyFile from the config, or
+// history.json in kmime's directory under the user data directory.
+func historyFilePath(cfg *kmimeConfig) (string, error) {
+	if path := os.Getenv(historyEnvVar); path != "" {
+		return expandHome(path), nil
+	}
+	if cfg.HistoryFile != "" {
+		return expandHome(cfg.HistoryFile), nil
+	}
+	dataDir, err := userDataDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user data directory: %w", err)
+	}
+	return filepath.Join(dataDir, "kmime", "history.json"), nil
+}
+
+// userDataDir is the platform's directory for user data:
+// $XDG_DATA_HOME or ~/.local/share on Unix, ~/Library/Application Support
+// on macOS and %LocalAppData% on Windows.
+func userDataDir() (string, error) {
+	switch runtime.GOOS {
+	case "windows":
+		if dir := os.Getenv("LocalAppData"); dir != "" {
+			return dir, nil
+		}
+		return "", errors.New("%LocalAppData% is not defined")
+	case "darwin", "ios":
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, "Library", "Application Support"), nil
+	}
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share"), nil
+}
+
+// migrate moves the entries of a history written by an older version at
+// legacy into the store, oldest first, and removes the old file.
+func (h *historyStore) migrate(legacy string) error {
+	if _, err := os.Stat(legacy); err != nil {
+		return nil
+	}
+	if same, err := samePath(legacy, h.path); err != nil || same {
+		return err
+	}
+	old, err := (&historyStore{path: legacy, key: h.key}).read()
+	if err != nil {
+		return err
+	}
+	entries, err := h.read()
+	if err != nil {
+		return err
+	}
+	entries = append(old, entries...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+	if err := h.write(entries); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Moved the history from %s to %s.\n", legacy, h.path)
+	return os.Remove(legacy)
+}
+
+func samePath(a, b string) (bool, error) {
+	absA, err := filepath.Abs(a)
+	if err != nil {
+		return false, err
+	}
+	absB, err := filepath.Abs(b)
+	if err != nil {
+		return false, err
+	}
+	return absA == absB, nil
+}
+
+func newLogEntry(params *kmimeParams, newPodName string) logEntry {
+	command := params.userCommand
+	if command == nil && !isShellCommand(params.commandToRun) {
+		command = params.commandToRun
+	}
+	var script string
+	if params.script != nil {
+		script = params.script.path
+	}
+	return logEntry{
+		Timestamp:  time.Now(),
+		NewPodName: newPodName,
+		SourcePod:  params.sourcePod,
+		Namespace:  params.namespace,
+		User:       params.user,
+		Command:    command,
+		Script:     script,
+		InPlace:    params.inPlace,
+		Tmux:       params.tmux,
+		Keepalive:  params.keepalive && !params.tmux,
+		Prefix:     params.prefix,
+		Suffix:     params.suffix,
+		Labels:     params.labels,
+		EnvFiles:   params.envFiles,
+		LogFile:    params.logFile,
+	}
+}
+
+func (h *historyStore) read() ([]logEntry, error) {
 	var entries []logEntry
 
-	if _, err := os.Stat(logFileName); err == nil {
-		file, err := os.ReadFile(logFileName)
+	if _, err := os.Stat(h.path); err == nil {
+		file, err := os.ReadFile(h.path)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		file, err = decryptHistory(h.key, file)
+		if err != nil {
+			return nil, err
 		}
 		if len(file) > 0 {
 			if err := json.Unmarshal(file, &entries); err != nil {
-				return err
+				return nil, err
 			}
 		}
 	}
 
-	entries = append(entries, entry)
+	return entries, nil
+}
 
+func (h *historyStore) append(entry logEntry) error {
+	if h.disabled {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	entries, err := h.read()
+	if err != nil {
+		return err
+	}
+
+	return h.write(append(entries, entry))
+}
+
+// write replaces the history with entries, creating its directory if
+// needed.
+func (h *historyStore) write(entries []logEntry) error {
 	data, err := json.MarshalIndent(entries, "", "  ")
 	if err != nil {
 		return err
 	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0700); err != nil {
+		return err
+	}
+
+	if h.key != nil {
+		data, err = encryptHistory(h.key, data)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(h.path, data, 0600)
+	}
 
-	return os.WriteFile(logFileName, data, 0644)
+	return os.WriteFile(h.path, data, 0644)
 }
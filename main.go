@@ -1,13 +1,19 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/spf13/cobra"
-	"sigs.k8s.io/yaml"
+	"github.com/spf13/pflag"
+	"golang.org/x/term"
+	v1 "k8s.io/api/core/v1"
 )
 
 var rootCmd = &cobra.Command{
@@ -21,37 +27,58 @@ This is useful for tasks like running batch jobs or exploring a pod's environmen
 without altering the original pod.`,
 	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		var commandToRun []string
-		if len(args) > 1 {
-			commandToRun = args[1:]
-		} else {
-			commandToRun = []string{"bash"}
+		previewPath, _ := cmd.Flags().GetString("preview")
+		preview := previewPath != ""
+		force, _ := cmd.Flags().GetBool("force")
+		output, _ := cmd.Flags().GetString("output")
+		showSecrets, _ := cmd.Flags().GetBool("show-secrets")
+		printName := output == outputName
+		printEvents := output == outputEvents
+		if printName || printEvents {
+			output = ""
 		}
-
-		namespace, _ := cmd.Flags().GetString("namespace")
-		prefix, _ := cmd.Flags().GetString("prefix")
-		suffix, _ := cmd.Flags().GetString("suffix")
-		labelStrs, _ := cmd.Flags().GetStringArray("label")
-		envFile, _ := cmd.Flags().GetString("env-file")
-		preview, _ := cmd.Flags().GetBool("preview")
-
-		labels, err := parseLabels(labelStrs)
-		if err != nil {
-			log.Fatalf("Error processing labels: %v", err)
+		if err := validatePreviewFormat(output); err != nil {
+			log.Fatalf("Error processing output: %v", err)
 		}
-
-		envs, err := parseEnvFile(envFile)
-		if err != nil {
-			log.Fatalf("Error processing env file: %v", err)
+		dryRun, _ := cmd.Flags().GetString("dry-run")
+		switch dryRun {
+		case dryRunNone, dryRunServer:
+		case dryRunClient:
+			preview = true
+		default:
+			log.Fatalf("Error processing dry-run: expected none, client or server, got %q", dryRun)
 		}
-
-		skipIdentification, _ := cmd.Flags().GetBool("skip-identification")
-		var user string
-		if !skipIdentification {
-			user, err = getUserIdentifier()
-			if err != nil {
-				log.Fatalf("Error getting user identifier: %v", err)
+		preview = preview || output != "" || dryRun == dryRunServer
+		if (printName || printEvents) && preview {
+			log.Fatalf("Error processing output: -o name and -o events cannot be combined with a preview or dry run")
+		}
+		quiet, _ := cmd.Flags().GetBool("quiet")
+		params := paramsFromFlags(cmd, args)
+		if params.inPlace && (preview || printName || printEvents) {
+			log.Fatalf("Error processing --in-place: there is no clone to preview or report on")
+		}
+		// Piped stdin goes to the remote command, so there is no keyboard
+		// for the TUI.
+		params.headless = printEvents || quiet || params.pipedStdin
+		if params.headless && (params.editEnv || params.confirm) {
+			log.Fatalf("Error processing output: --edit-env and --confirm need the TUI and cannot be combined with -o events, --quiet or piped stdin")
+		}
+		var programOptions []tea.ProgramOption
+		if params.headless {
+			programOptions = append(programOptions, tea.WithoutRenderer())
+		}
+		if params.pipedStdin {
+			programOptions = append(programOptions, tea.WithInput(nil))
+		}
+		if printName || printEvents {
+			// Everything else, the TUI and the attached shell included,
+			// goes to stderr so stdout only carries the name or events.
+			if printName {
+				params.nameOutput = os.Stdout
+			} else {
+				params.events = newEventWriter(os.Stdout)
 			}
+			os.Stdout = os.Stderr
 		}
 
 		if preview {
@@ -59,79 +86,854 @@ without altering the original pod.`,
 			if err != nil {
 				log.Fatalf("Could not get Kubernetes config: %v", err)
 			}
-			originalPod, err := getPod(clientset, namespace, args[0])
+			originalPod, err := getPod(clientset, params.namespace, args[0])
 			if err != nil {
 				log.Fatalf("Could not get source pod: %v", err)
 			}
 
-			podSpec := clonePod(originalPod, user, commandToRun, prefix, suffix, labels, envs)
-			yamlData, err := yaml.Marshal(podSpec)
+			podSpec, err := clonePod(originalPod, params)
 			if err != nil {
-				log.Fatalf("Could not marshal pod spec to YAML: %v", err)
+				log.Fatalf("Could not clone pod: %v", err)
 			}
-
-			fileName := "kmime-preview.yaml"
-			err = os.WriteFile(fileName, yamlData, 0644)
+			podSpec, err = customizePod(podSpec, params)
+			if err != nil {
+				log.Fatalf("Could not customize pod spec: %v", err)
+			}
+			if params.serviceAccount != "" {
+				if err := checkServiceAccount(clientset, podSpec.Namespace, params.serviceAccount); err != nil {
+					log.Fatalf("Invalid service account: %v", err)
+				}
+			}
+			warnings := append(cloneWarnings(params), sanitizeClone(clientset, originalPod, podSpec, params)...)
+			if !quiet {
+				for _, warning := range warnings {
+					fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+				}
+			}
+			if params.edit {
+				podSpec, err = editPod(podSpec)
+				if err != nil {
+					log.Fatalf("Could not edit pod spec: %v", err)
+				}
+			}
+			podSpec, err = finalizePod(podSpec, params)
+			if err != nil {
+				log.Fatalf("Could not customize pod spec: %v", err)
+			}
+			warning, err := checkSchema(clientset, podSpec, params)
+			if err != nil {
+				log.Fatalf("Invalid pod spec: %v", err)
+			}
+			if warning != "" && !quiet {
+				fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+			}
+			if dryRun == dryRunServer && params.asJob {
+				job, err := dryRunJob(clientset, jobForPod(podSpec, params))
+				if err != nil {
+					log.Fatalf("Dry run failed: %v", err)
+				}
+				if output == "" {
+					fmt.Printf("job.batch/%s created (server dry run)\n", job.Name)
+					return
+				}
+			} else if dryRun == dryRunServer {
+				podSpec, err = dryRunPod(clientset, podSpec)
+				if err != nil {
+					log.Fatalf("Dry run failed: %v", err)
+				}
+				if output == "" {
+					fmt.Printf("pod/%s created (server dry run)\n", podSpec.Name)
+					return
+				}
+			}
+			if !showSecrets {
+				podSpec = maskSecrets(podSpec)
+			}
+			objects, err := previewObjects(podSpec, params, showSecrets)
 			if err != nil {
-				log.Fatalf("Could not write YAML to file: %v", err)
+				log.Fatalf("Could not build preview: %v", err)
+			}
+			if err := writePreview(objects, output, previewPath, force); err != nil {
+				log.Fatalf("Could not write preview: %v", err)
 			}
-			fmt.Printf("Pod specification saved to %s\n", fileName)
 			return
 		}
 
-		params := &kmimeParams{
-			sourcePod:    args[0],
-			commandToRun: commandToRun,
-			namespace:    namespace,
-			prefix:       prefix,
-			suffix:       suffix,
-			labels:       labels,
-			envs:         envs,
-			user:         user,
-			envFile:      envFile,
+		if recordPath, _ := cmd.Flags().GetString("record"); recordPath != "" {
+			recorder, err := startRecording(recordPath, os.Args)
+			if err != nil {
+				log.Fatalf("Error processing --record: %v", err)
+			}
+			defer recorder.Close()
+			params.session.recorder = recorder
+		}
+		if logPath, _ := cmd.Flags().GetString("log-output"); logPath != "" {
+			outputLog, err := openOutputLog(logPath)
+			if err != nil {
+				log.Fatalf("Error processing --log-output: %v", err)
+			}
+			defer outputLog.Close()
+			params.session.outputLog = outputLog
 		}
 
-		p := tea.NewProgram(NewModel(params))
-		if _, err := p.Run(); err != nil {
+		if params.inPlace {
+			os.Exit(runInPlace(params))
+		}
+
+		initial := NewModel(params)
+		stopCleanup := initial.cleanup.cleanupOnSignals(params)
+		p := tea.NewProgram(initial, programOptions...)
+		finalModel, err := p.Run()
+		stopCleanup()
+		// ctrl-c and errors end the TUI without removing the clone.
+		initial.cleanup.cleanup(params)
+		printFailureLogs(finalModel)
+		if err != nil {
 			fmt.Printf("An error occurred during execution: %v\n", err)
 			os.Exit(1)
 		}
+		m, _ := finalModel.(model)
+		if (quiet || params.pipedStdin) && !printEvents {
+			switch {
+			case m.err != nil:
+				fmt.Fprintf(os.Stderr, "Error: %v\n", m.err)
+			case m.done && !params.asJob && !params.noAttach && !params.pipedStdin:
+				fmt.Println(m.statusText)
+			}
+		}
+		if params.headless && m.err != nil {
+			os.Exit(1)
+		}
+		switch {
+		case params.asJob && m.done:
+			// The job keeps running if this is interrupted.
+			if err := followJobLogs(context.Background(), m.clientset, m.namespace, m.jobName, params.startupTimeout, os.Stdout); err != nil {
+				log.Fatalf("Could not follow job logs: %v", err)
+			}
+		case params.noAttach && m.done:
+			container := m.newPod.Spec.Containers[0].Name
+			os.Exit(runToCompletion(m.clientset, m.config, m.namespace, m.newPodName, container, params, func(ctx context.Context) error {
+				if params.keepalive {
+					return execPiped(ctx, m.clientset, m.config, m.namespace, m.newPodName, container, params.commandToRun, nil)
+				}
+				return followPodLogs(ctx, m.clientset, m.namespace, m.newPodName, os.Stdout)
+			}))
+		case params.pipedStdin && m.done:
+			container := m.newPod.Spec.Containers[0].Name
+			os.Exit(runToCompletion(m.clientset, m.config, m.namespace, m.newPodName, container, params, func(ctx context.Context) error {
+				if params.keepalive {
+					return execPiped(ctx, m.clientset, m.config, m.namespace, m.newPodName, container, params.commandToRun, os.Stdin)
+				}
+				return attachPiped(ctx, m.clientset, m.config, m.namespace, m.newPodName)
+			}))
+		}
 	},
 }
 
+// paramsFromFlags builds the clone parameters from the root command's flags,
+// exiting on invalid values. args are the source pod and optional command.
+func paramsFromFlags(cmd *cobra.Command, args []string) *kmimeParams {
+	namespace, _ := cmd.Flags().GetString("namespace")
+	prefix, _ := cmd.Flags().GetString("prefix")
+	suffix, _ := cmd.Flags().GetString("suffix")
+	nameTemplate, _ := cmd.Flags().GetString("name-template")
+	labelStrs, _ := cmd.Flags().GetStringArray("label")
+	annotationStrs, _ := cmd.Flags().GetStringArray("annotation")
+	stripLabels, _ := cmd.Flags().GetStringArray("strip-label")
+	noInheritLabels, _ := cmd.Flags().GetBool("no-inherit-labels")
+	inheritAll, _ := cmd.Flags().GetBool("inherit-all")
+	envFiles, _ := cmd.Flags().GetStringArray("env-file")
+	editEnv, _ := cmd.Flags().GetBool("edit-env")
+	edit, _ := cmd.Flags().GetBool("edit")
+	overridesStr, _ := cmd.Flags().GetString("overrides")
+	patchFiles, _ := cmd.Flags().GetStringArray("patch-file")
+	jsonPatchFiles, _ := cmd.Flags().GetStringArray("json-patch")
+	strategy, _ := cmd.Flags().GetString("strategy")
+	stripLifecycleHooks, _ := cmd.Flags().GetBool("strip-lifecycle-hooks")
+	keepReadinessGates, _ := cmd.Flags().GetBool("keep-readiness-gates")
+	runAsRoot, _ := cmd.Flags().GetBool("run-as-root")
+	runAsUser := optionalInt64Flag(cmd, "run-as-user")
+	fsGroup := optionalInt64Flag(cmd, "fs-group")
+	capabilityStrs, _ := cmd.Flags().GetStringSlice("add-capabilities")
+	hostNetwork := optionalBoolFlag(cmd, "host-network")
+	hostPID := optionalBoolFlag(cmd, "host-pid")
+	hostIPC := optionalBoolFlag(cmd, "host-ipc")
+	shareProcessNamespace := optionalBoolFlag(cmd, "share-process-namespace")
+	noLimits, _ := cmd.Flags().GetBool("no-limits")
+	noRequests, _ := cmd.Flags().GetBool("no-requests")
+	stripExtendedResources, _ := cmd.Flags().GetBool("strip-extended-resources")
+	keepResources, _ := cmd.Flags().GetStringSlice("keep-resource")
+	ephemeralStorageRequestStr, _ := cmd.Flags().GetString("ephemeral-storage-request")
+	ephemeralStorageLimitStr, _ := cmd.Flags().GetString("ephemeral-storage-limit")
+	tolerationStrs, _ := cmd.Flags().GetStringArray("toleration")
+	spot, _ := cmd.Flags().GetBool("spot")
+	small, _ := cmd.Flags().GetBool("small")
+	hostAliasStrs, _ := cmd.Flags().GetStringArray("host-alias")
+	stripAffinity, _ := cmd.Flags().GetBool("strip-affinity")
+	stripNodeSelector, _ := cmd.Flags().GetBool("strip-node-selector")
+	stripTopologySpread, _ := cmd.Flags().GetBool("strip-topology-spread")
+	priorityClass := optionalStringFlag(cmd, "priority-class")
+	runtimeClass := optionalStringFlag(cmd, "runtime-class")
+	terminationGracePeriod, _ := cmd.Flags().GetDuration("termination-grace-period")
+	deleteGracePeriod, _ := cmd.Flags().GetDuration("delete-grace-period")
+	forceDelete, _ := cmd.Flags().GetBool("force-delete")
+	ttl, _ := cmd.Flags().GetDuration("ttl")
+	serviceAccount, _ := cmd.Flags().GetString("service-account")
+	mountSAToken := optionalBoolFlag(cmd, "mount-sa-token")
+	debugSidecarImage, _ := cmd.Flags().GetString("debug-sidecar")
+	volumeStrs, _ := cmd.Flags().GetStringArray("volume")
+	stripVolumes, _ := cmd.Flags().GetStringArray("strip-volume")
+	stripPVCVolumes, _ := cmd.Flags().GetBool("strip-pvc-volumes")
+	scratchPath, _ := cmd.Flags().GetString("scratch")
+	scratchSize, _ := cmd.Flags().GetString("scratch-size")
+	scratchMemory, _ := cmd.Flags().GetBool("scratch-memory")
+	validate, _ := cmd.Flags().GetBool("validate")
+	confirm, _ := cmd.Flags().GetBool("confirm")
+	showSecrets, _ := cmd.Flags().GetBool("show-secrets")
+	schemaFile, _ := cmd.Flags().GetString("schema-file")
+	asJob, _ := cmd.Flags().GetBool("as-job")
+	noAttach, _ := cmd.Flags().GetBool("no-attach")
+	keep, _ := cmd.Flags().GetBool("keep")
+	keepalive, _ := cmd.Flags().GetBool("keepalive")
+	container, _ := cmd.Flags().GetString("container")
+	copyInStrs, _ := cmd.Flags().GetStringArray("copy-in")
+	collectStrs, _ := cmd.Flags().GetStringArray("collect")
+	scriptPath, _ := cmd.Flags().GetString("script")
+	tmux, _ := cmd.Flags().GetBool("tmux")
+	inPlace, _ := cmd.Flags().GetBool("in-place")
+	onFailure, _ := cmd.Flags().GetString("on-failure")
+	logsDir, _ := cmd.Flags().GetString("save-logs")
+	detachKeysStr, _ := cmd.Flags().GetString("detach-keys")
+	portForwards, _ := cmd.Flags().GetStringArray("port-forward")
+	idleTimeout, _ := cmd.Flags().GetDuration("idle-timeout")
+	reconnectAttempts, _ := cmd.Flags().GetInt("reconnect-attempts")
+	startupTimeout, _ := cmd.Flags().GetDuration("timeout")
+	rm, _ := cmd.Flags().GetBool("rm")
+	backoffLimit, _ := cmd.Flags().GetInt32("backoff-limit")
+	completions, _ := cmd.Flags().GetInt32("completions")
+	ttlAfterFinished, _ := cmd.Flags().GetDuration("ttl-after-finished")
+
+	cfg, history := loadCommandConfig(cmd)
+
+	if inPlace {
+		var cloneOnly []string
+		cmd.Flags().Visit(func(f *pflag.Flag) {
+			if !inPlaceFlags[f.Name] {
+				cloneOnly = append(cloneOnly, "--"+f.Name)
+			}
+		})
+		if len(cloneOnly) > 0 {
+			log.Fatalf("Error processing --in-place: there is no clone for %s", strings.Join(cloneOnly, ", "))
+		}
+	}
+
+	var script *localScript
+	var commandToRun []string
+	if scriptPath != "" {
+		var err error
+		script, err = readScript(scriptPath)
+		if err != nil {
+			log.Fatalf("Error processing --script: %v", err)
+		}
+		// The remaining arguments are passed to the script.
+		commandToRun = script.command(args[1:])
+	} else if len(args) > 1 {
+		commandToRun = args[1:]
+	} else {
+		commandToRun = shellCommand(cfg.ShellFallback)
+	}
+	if nameTemplate == "" {
+		nameTemplate = cfg.NameTemplate
+	}
+	if nameTemplate != "" {
+		if _, err := renderPodName(nameTemplate, podNameData{Source: args[0], Namespace: namespace, Prefix: prefix, Suffix: suffix, Rand: "0"}); err != nil {
+			log.Fatalf("Error processing name template: %v", err)
+		}
+	}
+	if priorityClass == nil && cfg.DefaultPriorityClass != "" {
+		priorityClass = &cfg.DefaultPriorityClass
+	}
+	if mountSAToken == nil {
+		mountSAToken = cfg.MountServiceAccountToken
+	}
+	if debugSidecarImage == debugSidecarFromConfig {
+		debugSidecarImage = defaultDebugSidecarImage
+		if cfg.DebugSidecarImage != "" {
+			debugSidecarImage = cfg.DebugSidecarImage
+		}
+	}
+	if debugSidecarImage != "" && shareProcessNamespace == nil && cfg.DebugSidecarShareProcesses {
+		shareProcessNamespace = &cfg.DebugSidecarShareProcesses
+	}
+
+	labels, err := parseLabels(labelStrs)
+	if err != nil {
+		log.Fatalf("Error processing labels: %v", err)
+	}
+
+	annotations, err := parseAnnotations(annotationStrs)
+	if err != nil {
+		log.Fatalf("Error processing annotations: %v", err)
+	}
+
+	if err := validateStrategy(strategy); err != nil {
+		log.Fatalf("Error processing strategy: %v", err)
+	}
+
+	capabilities, err := parseCapabilities(capabilityStrs, cfg.AllowedCapabilities)
+	if err != nil {
+		log.Fatalf("Error processing capabilities: %v", err)
+	}
+
+	ephemeralRequest, ephemeralLimit, err := parseEphemeralStorage(ephemeralStorageRequestStr, ephemeralStorageLimitStr)
+	if err != nil {
+		log.Fatalf("Error processing ephemeral storage: %v", err)
+	}
+
+	var smallResources v1.ResourceList
+	if small {
+		smallResources, err = parseSmallProfile(cfg.Small)
+		if err != nil {
+			log.Fatalf("Error processing --small: %v", err)
+		}
+		stripExtendedResources = true
+	}
+
+	var nodeSelector map[string]string
+	if spot {
+		if cfg.Spot == nil {
+			log.Fatalf("Error processing --spot: no spot settings in the config")
+		}
+		tolerationStrs = append(tolerationStrs, cfg.Spot.Tolerations...)
+		nodeSelector = cfg.Spot.NodeSelector
+	}
+
+	tolerations, err := parseTolerations(tolerationStrs)
+	if err != nil {
+		log.Fatalf("Error processing tolerations: %v", err)
+	}
+
+	hostAliases, err := parseHostAliases(hostAliasStrs)
+	if err != nil {
+		log.Fatalf("Error processing host aliases: %v", err)
+	}
+
+	extraVolumes, err := parseVolumes(volumeStrs)
+	if err != nil {
+		log.Fatalf("Error processing volumes: %v", err)
+	}
+	scratch, err := scratchVolume(scratchPath, scratchSize, scratchMemory)
+	if err != nil {
+		log.Fatalf("Error processing scratch volume: %v", err)
+	}
+	if scratch != nil {
+		extraVolumes = append(extraVolumes, *scratch)
+	}
+
+	envs, envFrom, secretRefs := parseEnvFlags(cmd, cfg)
+	// Checked after the env flags, since --env-file - reads stdin and
+	// points it at the terminal again.
+	pipedStdin := !noAttach && !asJob && !term.IsTerminal(int(os.Stdin.Fd()))
+	if pipedStdin && keepalive {
+		log.Fatalf("Error processing --keepalive: it needs a terminal, stdin is not one")
+	}
+	overrides, err := parseOverrides(overridesStr)
+	if err != nil {
+		log.Fatalf("Error processing overrides: %v", err)
+	}
+	patches, err := readPatchFiles(patchFiles)
+	if err != nil {
+		log.Fatalf("Error processing patch files: %v", err)
+	}
+	jsonPatches, err := readJSONPatches(jsonPatchFiles)
+	if err != nil {
+		log.Fatalf("Error processing JSON patches: %v", err)
+	}
+	if noAttach && len(args) < 2 && script == nil {
+		log.Fatalf("Error processing --no-attach: a command to run is required")
+	}
+	detachKeys, err := parseDetachKeys(detachKeysStr)
+	if err != nil {
+		log.Fatalf("Error processing detach keys: %v", err)
+	}
+	if !cmd.Flags().Changed("idle-timeout") && cfg.IdleTimeout != "" {
+		idleTimeout, err = time.ParseDuration(cfg.IdleTimeout)
+		if err != nil {
+			log.Fatalf("Error processing idleTimeout in the config: %v", err)
+		}
+	}
+	if !cmd.Flags().Changed("timeout") && cfg.StartupTimeout != "" {
+		// loadConfig already validated it.
+		startupTimeout, _ = time.ParseDuration(cfg.StartupTimeout)
+	}
+	if startupTimeout <= 0 {
+		log.Fatalf("Error processing --timeout: must be positive")
+	}
+	if !cmd.Flags().Changed("save-logs") {
+		logsDir = cfg.LogsDir
+	}
+	if err := validateOnFailure(onFailure); err != nil {
+		log.Fatalf("Error processing --on-failure: %v", err)
+	}
+	if deleteGracePeriod < 0 {
+		log.Fatalf("Error processing --delete-grace-period: must not be negative")
+	}
+	if reconnectAttempts < 0 {
+		log.Fatalf("Error processing --reconnect-attempts: must not be negative")
+	}
+	if err := validatePortForwards(portForwards); err != nil {
+		log.Fatalf("Error processing port forwards: %v", err)
+	}
+	if container != "" && (noAttach || asJob || pipedStdin) {
+		log.Fatalf("Error processing --container: it only applies to interactive sessions")
+	}
+	copyIn, err := parseCopyIn(copyInStrs)
+	if err != nil {
+		log.Fatalf("Error processing --copy-in: %v", err)
+	}
+	if len(copyIn) > 0 && (noAttach || asJob || pipedStdin) {
+		log.Fatalf("Error processing --copy-in: it only applies to interactive sessions, the command would start before the copy")
+	}
+	if keepalive && (noAttach || asJob) {
+		log.Fatalf("Error processing --keepalive: cannot be combined with --no-attach or --as-job")
+	}
+	collect, err := parseCollect(collectStrs)
+	if err != nil {
+		log.Fatalf("Error processing --collect: %v", err)
+	}
+	if len(collect) > 0 {
+		if asJob {
+			log.Fatalf("Error processing --collect: cannot be combined with --as-job")
+		}
+		// The files can only be read while the container runs, so the
+		// command is exec'd into an idle clone.
+		if !keepalive {
+			fmt.Fprintln(os.Stderr, "Note: --collect runs the clone in keepalive mode, which needs /bin/sh in the image")
+		}
+		keepalive = true
+	}
+	if tmux {
+		if noAttach || asJob || pipedStdin {
+			log.Fatalf("Error processing --tmux: it only applies to interactive sessions")
+		}
+		// tmux outlives the exec'd client, so the clone has to idle
+		// rather than end with the attached command.
+		if !keepalive {
+			fmt.Fprintln(os.Stderr, "Note: --tmux runs the clone in keepalive mode, which needs /bin/sh in the image")
+		}
+		keepalive = true
+		commandToRun = tmuxCommand(commandToRun)
+	}
+	if noAttach && asJob {
+		log.Fatalf("Error processing --no-attach: cannot be combined with --as-job, which never attaches")
+	}
+	// Grace periods are whole seconds, and a period of 0 deletes the pod
+	// at once, so a typo like 500ms must not silently become one.
+	if terminationGracePeriod < 0 || (terminationGracePeriod > 0 && terminationGracePeriod < time.Second) {
+		log.Fatalf("Error processing --termination-grace-period: must be 0 or at least 1s")
+	}
+	if deleteGracePeriod < 0 || (deleteGracePeriod > 0 && deleteGracePeriod < time.Second) {
+		log.Fatalf("Error processing --delete-grace-period: must be 0 or at least 1s")
+	}
+	// activeDeadlineSeconds must be positive; 0 leaves it unset.
+	if ttl < 0 || (ttl > 0 && ttl < time.Second) {
+		log.Fatalf("Error processing --ttl: must be at least 1s")
+	}
+	var ttlAfterFinishedSeconds *int32
+	if asJob {
+		if len(args) < 2 {
+			log.Fatalf("Error processing --as-job: a command to run is required, the job has no terminal to attach to")
+		}
+		if backoffLimit < 0 || completions < 1 {
+			log.Fatalf("Error processing --as-job: --backoff-limit must be at least 0 and --completions at least 1")
+		}
+		if ttlAfterFinished < 0 || (ttlAfterFinished > 0 && ttlAfterFinished < time.Second) {
+			log.Fatalf("Error processing --ttl-after-finished: must be 0 or at least 1s")
+		}
+		if ttlAfterFinished > 0 {
+			seconds := int32(*durationSeconds(ttlAfterFinished))
+			ttlAfterFinishedSeconds = &seconds
+		}
+	}
+	noInheritEnvFrom, _ := cmd.Flags().GetBool("no-inherit-env-from")
+	dropEnvFrom, _ := cmd.Flags().GetStringArray("drop-env-from")
+
+	skipIdentification, _ := cmd.Flags().GetBool("skip-identification")
+	var user string
+	if !skipIdentification {
+		user, err = getUserIdentifier()
+		if err != nil {
+			log.Fatalf("Error getting user identifier: %v", err)
+		}
+	}
+
+	return &kmimeParams{
+		sourcePod:    args[0],
+		commandToRun: commandToRun,
+		namespace:    namespace,
+		prefix:       prefix,
+		suffix:       suffix,
+		labels:       mergeStringMaps(cfg.DefaultLabels, labels),
+		annotations:  mergeStringMaps(cfg.DefaultAnnotations, annotations),
+		envs:         envs,
+		envFrom:      envFrom,
+		secretRefs:   secretRefs,
+		editEnv:      editEnv,
+		edit:         edit,
+		confirm:      confirm,
+		noAttach:     noAttach,
+		keep:         keep || !rm,
+		forceDelete:  forceDelete,
+		keepalive:    keepalive,
+		container:    container,
+		copyIn:       copyIn,
+		collect:      collect,
+		script:       script,
+		tmux:         tmux,
+		inPlace:      inPlace,
+		userCommand:  append([]string{}, args[1:]...),
+		onFailure:    onFailure,
+		logsDir:      logsDir,
+		session:      sessionOptions{detachKeys: detachKeys, idleTimeout: idleTimeout},
+		portForwards: portForwards,
+		pipedStdin:   pipedStdin,
+		showSecrets:  showSecrets,
+		noValidate:   !validate,
+		schemaFile:   schemaFile,
+		user:         user,
+		envFiles:     absoluteEnvFiles(envFiles),
+		history:      history,
+
+		nameTemplate:           nameTemplate,
+		strategy:               strategy,
+		stripLabels:            stripLabels,
+		noInheritLabels:        noInheritLabels,
+		noInheritEnvFrom:       noInheritEnvFrom,
+		dropEnvFrom:            dropEnvFrom,
+		overrides:              overrides,
+		patchFiles:             patchFiles,
+		patches:                patches,
+		jsonPatchFiles:         jsonPatchFiles,
+		jsonPatches:            jsonPatches,
+		inheritAll:             inheritAll,
+		stripLifecycleHooks:    stripLifecycleHooks,
+		keepReadinessGates:     keepReadinessGates,
+		runAsUser:              runAsUser,
+		runAsRoot:              runAsRoot,
+		fsGroup:                fsGroup,
+		addCapabilities:        capabilities,
+		hostNetwork:            hostNetwork,
+		hostPID:                hostPID,
+		hostIPC:                hostIPC,
+		shareProcessNamespace:  shareProcessNamespace,
+		noLimits:               noLimits,
+		noRequests:             noRequests,
+		stripExtendedResources: stripExtendedResources,
+		keepResources:          keepResources,
+		smallProfile:           smallResources,
+		ephemeralRequest:       ephemeralRequest,
+		ephemeralLimit:         ephemeralLimit,
+		tolerations:            tolerations,
+		nodeSelector:           nodeSelector,
+		hostAliases:            hostAliases,
+		stripAffinity:          stripAffinity,
+		stripNodeSelector:      stripNodeSelector,
+		stripTopologySpread:    stripTopologySpread,
+		priorityClass:          priorityClass,
+		runtimeClass:           runtimeClass,
+		terminationGracePeriod: durationSeconds(terminationGracePeriod),
+		deleteGracePeriod:      optionalDeleteGracePeriod(cmd, deleteGracePeriod),
+		reconnectAttempts:      reconnectAttempts,
+		startupTimeout:         startupTimeout,
+		ttl:                    ttl,
+		serviceAccount:         serviceAccount,
+		mountSAToken:           mountSAToken,
+		debugSidecarImage:      debugSidecarImage,
+		extraVolumes:           extraVolumes,
+		stripVolumes:           stripVolumes,
+		stripPVCVolumes:        stripPVCVolumes,
+		debugNamespace:         cfg.DebugNamespace,
+		mutationPlugins:        cfg.MutationPlugins,
+		asJob:                  asJob,
+		backoffLimit:           backoffLimit,
+		completions:            completions,
+		ttlAfterFinished:       ttlAfterFinishedSeconds,
+	}
+}
+
 var historyCmd = &cobra.Command{
 	Use:   "history",
 	Short: "Displays the execution history of kmime.",
+	Long: `history shows the sessions kmime created, newest first. Pressing enter on a
+row replays that session, after a confirmation, with the same source pod,
+namespace, command, labels and env files.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		model, err := NewHistoryModel()
+		_, history := loadCommandConfig(cmd)
+
+		model, err := NewHistoryModel(history)
 		if err != nil {
 			log.Fatalf("Error creating history view: %v", err)
 		}
 
 		p := tea.NewProgram(model)
-		if _, err := p.Run(); err != nil {
+		final, err := p.Run()
+		if err != nil {
 			fmt.Printf("An error occurred during execution: %v\n", err)
 			os.Exit(1)
 		}
+		if m, ok := final.(historyModel); ok && m.replay != nil {
+			code, err := replaySession(*m.replay)
+			if err != nil {
+				log.Fatalf("Could not replay the session: %v", err)
+			}
+			os.Exit(code)
+		}
 	},
 }
 
+// optionalInt64Flag returns nil when the flag was not set so that callers
+// can tell "not set" apart from an explicit zero.
+func optionalInt64Flag(cmd *cobra.Command, name string) *int64 {
+	if !cmd.Flags().Changed(name) {
+		return nil
+	}
+	value, _ := cmd.Flags().GetInt64(name)
+	return &value
+}
+
+func optionalStringFlag(cmd *cobra.Command, name string) *string {
+	if !cmd.Flags().Changed(name) {
+		return nil
+	}
+	value, _ := cmd.Flags().GetString(name)
+	return &value
+}
+
+func optionalBoolFlag(cmd *cobra.Command, name string) *bool {
+	if !cmd.Flags().Changed(name) {
+		return nil
+	}
+	value, _ := cmd.Flags().GetBool(name)
+	return &value
+}
+
+// inPlaceFlags are the flags that apply to an --in-place session, which
+// execs into the source pod. Every other flag shapes the clone, and passing
+// one with --in-place is an error rather than silently ignored.
+var inPlaceFlags = map[string]bool{
+	"in-place":            true,
+	"namespace":           true,
+	"container":           true,
+	"no-attach":           true,
+	"quiet":               true,
+	"skip-identification": true,
+	"idle-timeout":        true,
+	"record":              true,
+	"log-output":          true,
+	"config":              true,
+	"no-history":          true,
+}
+
+// absoluteEnvFiles makes the --env-file paths absolute for the history, so
+// a replay from another directory reads the same files.
+func absoluteEnvFiles(files []string) []string {
+	var absolute []string
+	for _, file := range files {
+		if file != "-" {
+			path, err := filepath.Abs(file)
+			if err != nil {
+				log.Fatalf("Error processing --env-file: %v", err)
+			}
+			file = path
+		}
+		absolute = append(absolute, file)
+	}
+	return absolute
+}
+
+// optionalDeleteGracePeriod is --delete-grace-period in seconds, or nil to
+// delete with the clone's termination grace period.
+func optionalDeleteGracePeriod(cmd *cobra.Command, d time.Duration) *int64 {
+	if !cmd.Flags().Changed("delete-grace-period") {
+		return nil
+	}
+	return durationSeconds(d)
+}
+
+// durationSeconds converts d to whole seconds for the API, rounding a
+// partial second up.
+func durationSeconds(d time.Duration) *int64 {
+	seconds := int64((d + time.Second - 1) / time.Second)
+	return &seconds
+}
+
+// loadCommandConfig loads the config file and applies the persistent flags
+// that override it, exiting on error like the rest of the command setup.
+func loadCommandConfig(cmd *cobra.Command) (*kmimeConfig, *historyStore) {
+	configPath, _ := cmd.Flags().GetString("config")
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+
+	if noHistory, _ := cmd.Flags().GetBool("no-history"); noHistory {
+		cfg.DisableHistory = true
+	}
+
+	history, err := newHistoryStore(cfg)
+	if err != nil {
+		log.Fatalf("Error opening history: %v", err)
+	}
+	return cfg, history
+}
+
+// parseEnvFlags reads --env-file, -e and --env-from. Env file values that
+// reference external secrets are returned separately.
+func parseEnvFlags(cmd *cobra.Command, cfg *kmimeConfig) ([]v1.EnvVar, []v1.EnvFromSource, []secretRef) {
+	envFiles, _ := cmd.Flags().GetStringArray("env-file")
+	envStrs, _ := cmd.Flags().GetStringArray("env")
+	envFromStrs, _ := cmd.Flags().GetStringArray("env-from")
+
+	envs, err := parseEnvFiles(envFiles)
+	if err != nil {
+		log.Fatalf("Error processing env file: %v", err)
+	}
+	registerCommandProviders(cfg.SecretProviders)
+	envs, secretRefs := extractSecretRefs(envs)
+	flagEnvs, err := parseEnvVars(envStrs)
+	if err != nil {
+		log.Fatalf("Error processing env: %v", err)
+	}
+	envs = append(envs, flagEnvs...)
+	envFrom, err := parseEnvFrom(envFromStrs)
+	if err != nil {
+		log.Fatalf("Error processing env-from: %v", err)
+	}
+	return envs, envFrom, secretRefs
+}
+
 func Execute() {
 	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(compareStrategiesCmd)
+	rootCmd.AddCommand(debugCmd)
+	rootCmd.AddCommand(envDiffCmd)
+	rootCmd.AddCommand(applyCmd)
+	rootCmd.AddCommand(attachCmd)
+	rootCmd.AddCommand(cpCmd)
+	rootCmd.AddCommand(eachCmd)
+	rootCmd.AddCommand(gcCmd)
+	rootCmd.AddCommand(listCmd)
+	rootCmd.AddCommand(killCmd)
+	rootCmd.AddCommand(installJanitorCmd)
+	addCloneFlags(diffCmd)
+	addRunFlags()
+	rootCmd.AddCommand(runCmd)
+	rootCmd.AddCommand(diffCmd)
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
 	}
 }
 
 func init() {
+	rootCmd.PersistentFlags().String("config", "", "Path to the kmime config file (defaults to $KMIME_CONFIG or the user config directory)")
+	rootCmd.PersistentFlags().Bool("no-history", false, "Do not write session records to the local history file")
 	rootCmd.Flags().StringP("namespace", "n", "", "Namespace of the source pod (required)")
 	rootCmd.MarkFlagRequired("namespace")
 	rootCmd.Flags().String("prefix", "", "Prefix for the new pod's name")
 	rootCmd.Flags().String("suffix", "", "Suffix for the new pod's name")
+	rootCmd.Flags().String("name-template", "", "Go template for the new pod's name (e.g., '{{.User}}-{{.Source}}-{{.Rand}}'), replacing the prefix/suffix scheme")
 	rootCmd.Flags().StringArrayP("label", "l", []string{}, "Add a label to the new pod (e.g., -l key=value)")
-	rootCmd.Flags().String("env-file", "", "Path to a file with environment variables to add to the pod")
+	rootCmd.Flags().StringArray("strip-label", []string{}, "Do not copy this label from the source pod (repeatable)")
+	rootCmd.Flags().Bool("no-inherit-labels", false, "Do not copy any labels from the source pod")
+	rootCmd.Flags().Bool("inherit-all", false, "Keep controller labels, per-pod annotations and Service/controller selector labels copied from the source pod")
+	rootCmd.Flags().StringArray("annotation", []string{}, "Add an annotation to the new pod (e.g., --annotation cost-center=debug)")
+	rootCmd.Flags().StringArray("env-file", []string{}, "Path to a file with environment variables to add to the pod, or - for stdin (can be repeated)")
+	rootCmd.Flags().StringArrayP("env", "e", []string{}, "Set an environment variable in the new pod, applied after --env-file (e.g., -e LOG_LEVEL=debug)")
+	rootCmd.Flags().StringArray("env-from", []string{}, "Load environment variables from a ConfigMap or Secret (e.g., --env-from configmap/debug-config)")
+	rootCmd.Flags().Bool("no-inherit-env-from", false, "Do not inherit envFrom ConfigMaps and Secrets from the source container")
+	rootCmd.Flags().StringArray("drop-env-from", []string{}, "Drop an inherited envFrom source by name or kind/name (can be repeated)")
+	rootCmd.Flags().Bool("confirm", false, "Ask for confirmation before creating the pod, with a view of the generated spec")
+	rootCmd.Flags().Bool("edit-env", false, "Review and edit the environment of the new pod in the TUI before it is created")
 	rootCmd.Flags().Bool("skip-identification", false, "Skip appending user identification to the pod name")
-	rootCmd.Flags().Bool("preview", false, "Preview the generated pod specification as YAML without creating it")
+	rootCmd.Flags().String("preview", "", "Write the generated pod specification to a file, kmime-preview.yaml by default or - for stdout, without creating it")
+	rootCmd.Flags().Lookup("preview").NoOptDefVal = previewFileName
+	rootCmd.Flags().Bool("validate", true, "Validate the pod against the cluster's OpenAPI schema before creating it; the schema is cached per server version")
+	rootCmd.Flags().String("schema-file", "", "Validate against this core/v1 OpenAPI v3 document instead of fetching the cluster's")
+	rootCmd.Flags().BoolP("quiet", "q", false, "Hide the spinner, status text and warnings, printing only the final result or error")
+	rootCmd.Flags().Bool("force", false, "Overwrite an existing --preview file")
+	rootCmd.Flags().Bool("force-delete", false, "Delete the clone immediately at cleanup, with grace period 0, removing its finalizers")
+	rootCmd.Flags().String("dry-run", dryRunNone, "none, client (same as --preview) or server, which validates the pod against the API server's admission chain without creating it")
+	rootCmd.Flags().StringP("output", "o", "", "yaml or json prints the preview to stdout instead of writing kmime-preview.yaml (implies --preview); name prints pod/<name> once the pod is created; events replaces the TUI with JSON progress events")
+	rootCmd.Flags().Bool("show-secrets", false, "Do not mask secret-looking environment values in the preview")
+	rootCmd.Flags().String("strategy", strategyFull, "Clone strategy: full, no-sidecars (only the target container) or minimal (also drops init containers and unused volumes)")
+	rootCmd.Flags().Int64("run-as-user", 0, "Run the new pod's containers as the given UID")
+	rootCmd.Flags().Bool("run-as-root", false, "Run the new pod's containers as root (UID 0), disabling runAsNonRoot")
+	rootCmd.Flags().Int64("fs-group", 0, "Set the fsGroup of the new pod's security context")
+	rootCmd.MarkFlagsMutuallyExclusive("run-as-user", "run-as-root")
+	rootCmd.Flags().StringSlice("add-capabilities", []string{}, "Linux capabilities to add to the new pod's container (e.g., NET_ADMIN,NET_RAW)")
+	rootCmd.Flags().Bool("host-network", false, "Enable (or, with =false, disable) hostNetwork on the new pod")
+	rootCmd.Flags().Bool("host-pid", false, "Enable (or, with =false, disable) hostPID on the new pod")
+	rootCmd.Flags().Bool("host-ipc", false, "Enable (or, with =false, disable) hostIPC on the new pod")
+	rootCmd.Flags().Bool("share-process-namespace", false, "Enable (or, with =false, disable) shareProcessNamespace on the new pod")
+	rootCmd.Flags().Bool("no-limits", false, "Remove resource limits from all containers in the new pod")
+	rootCmd.Flags().Bool("no-requests", false, "Remove resource requests from all containers in the new pod")
+	rootCmd.Flags().Bool("small", false, "Downsize every container to the small profile and strip probes and extended resources")
+	rootCmd.Flags().Bool("strip-extended-resources", false, "Remove extended resources (e.g. nvidia.com/gpu) from all containers in the new pod")
+	rootCmd.Flags().StringSlice("keep-resource", nil, "Extended resource to keep with --strip-extended-resources (can be repeated)")
+	rootCmd.Flags().String("ephemeral-storage-request", "", "Set the ephemeral-storage request of the target container (e.g., 5Gi)")
+	rootCmd.Flags().String("ephemeral-storage-limit", "", "Set the ephemeral-storage limit of the target container (e.g., 10Gi)")
+	rootCmd.Flags().StringArray("toleration", []string{}, "Add a toleration to the new pod (e.g., --toleration dedicated=debug:NoSchedule)")
+	rootCmd.Flags().Bool("spot", false, "Schedule the new pod on spot nodes using the tolerations and nodeSelector from the config")
+	rootCmd.Flags().StringArray("host-alias", []string{}, "Add an /etc/hosts entry to the new pod (e.g., --host-alias 10.0.0.5=db.internal,cache.internal)")
+	rootCmd.Flags().Bool("strip-affinity", true, "Remove affinity and anti-affinity rules from the new pod (use --strip-affinity=false to inherit them)")
+	rootCmd.Flags().Bool("strip-node-selector", false, "Remove the nodeSelector from the new pod")
+	rootCmd.Flags().Bool("strip-topology-spread", true, "Remove topology spread constraints from the new pod (use --strip-topology-spread=false to inherit them)")
+	rootCmd.Flags().String("priority-class", "", "PriorityClass for the new pod; an empty value removes the inherited one")
+	rootCmd.Flags().String("runtime-class", "", "RuntimeClass for the new pod; an empty value removes the inherited one")
+	rootCmd.Flags().Duration("termination-grace-period", defaultTerminationGracePeriod, "terminationGracePeriodSeconds of the new pod, also used when deleting it (0 or at least 1s)")
+	rootCmd.Flags().Duration("delete-grace-period", 0, "Grace period for deleting the clone at cleanup (defaults to --termination-grace-period)")
+	rootCmd.Flags().Duration("timeout", defaultStartupTimeout, "How long to wait for the new pod to start, e.g. for large images or node provisioning (e.g., --timeout 10m)")
+	rootCmd.Flags().Duration("ttl", 0, "Maximum lifetime of the new pod (sets activeDeadlineSeconds, e.g., --ttl 4h)")
+	rootCmd.Flags().Bool("keep", false, "Keep the new pod after the session ends instead of deleting it")
+	rootCmd.Flags().Bool("rm", true, "Delete the new pod when the session ends (--rm=false is the same as --keep)")
+	rootCmd.Flags().StringArray("port-forward", []string{}, "Forward a local port to the new pod during the session, as [local:]remote (e.g., --port-forward 8080:8080, can be repeated)")
+	rootCmd.Flags().Duration("idle-timeout", 0, "End the session and delete the new pod after this long without input or output (e.g., --idle-timeout 30m)")
+	rootCmd.Flags().Int("reconnect-attempts", defaultReconnectAttempts, "Times to reattach, with backoff, when the session's connection drops before giving up and deleting the new pod")
+	rootCmd.Flags().String("record", "", "Record the attached session, input and output with timing, to this file in asciinema v2 format")
+	rootCmd.Flags().String("log-output", "", "Append everything written to the terminal during the attached session to this file")
+	rootCmd.Flags().String("detach-keys", defaultDetachKeys, "Key sequence that detaches from the session without ending it, empty to disable")
+	rootCmd.Flags().StringP("container", "c", "", "Container of the new pod to open the session in (defaults to the one running the command)")
+	rootCmd.Flags().StringArray("copy-in", []string{}, "Copy a local file or directory into the new pod before attaching, as <local>:<path in the pod> (e.g., --copy-in ./tools:/opt/tools, can be repeated)")
+	rootCmd.Flags().StringArray("collect", []string{}, "Download a file or directory from the new pod after the command exits, before cleanup, as <path in the pod>:<local> (e.g., --collect /tmp/output:./output, can be repeated)")
+	rootCmd.Flags().String("script", "", "Run this local script in the new pod as the command, with the remaining arguments; it is mounted from a ConfigMap removed with the pod")
+	rootCmd.Flags().String("save-logs", "", "Save the clone's logs to a timestamped file in this directory before deleting it, linked from the history")
+	rootCmd.Flags().Lookup("save-logs").NoOptDefVal = defaultLogsDir
+	rootCmd.Flags().String("on-failure", onFailureAsk, "What to do with the clone when the session fails: ask, keep, delete, or logs to print its logs and delete it")
+	rootCmd.Flags().Bool("in-place", false, "Exec the command into the source pod itself instead of a clone; nothing is created or cleaned up")
+	rootCmd.Flags().Bool("tmux", false, "Run the command inside tmux, when the image has it, so reattaching after a dropped connection resumes the same session (implies --keepalive)")
+	rootCmd.Flags().Bool("keepalive", false, "Keep the pod idle and exec the command into it, so exiting the shell does not end the pod")
+	rootCmd.Flags().Bool("no-attach", false, "Run the command to completion without a terminal, streaming its output and exiting with its exit code")
+	rootCmd.Flags().Bool("as-job", false, "Run the command in a batch/v1 Job that survives disconnects instead of attaching to a bare pod")
+	rootCmd.Flags().Int32("backoff-limit", 0, "Retries before the job is marked failed (with --as-job)")
+	rootCmd.Flags().Int32("completions", 1, "Successful pods the job needs to complete (with --as-job)")
+	rootCmd.Flags().Duration("ttl-after-finished", 24*time.Hour, "Delete the job this long after it finishes, 0 keeps it (with --as-job)")
+	rootCmd.Flags().String("service-account", "", "Run the new pod under this service account instead of the source pod's")
+	rootCmd.Flags().Bool("mount-sa-token", true, "Set automountServiceAccountToken on the new pod (e.g., --mount-sa-token=false); inherited when not set")
+	rootCmd.Flags().String("debug-sidecar", "", "Add a debug tools container sharing the pod's network, and with --share-process-namespace its processes (defaults to debugSidecarImage from the config, or "+defaultDebugSidecarImage+", when no image is given)")
+	rootCmd.Flags().Lookup("debug-sidecar").NoOptDefVal = debugSidecarFromConfig
+	rootCmd.Flags().StringArray("volume", []string{}, "Mount an extra volume into the new pod (e.g., configMap:tools:/opt/tools, pvc:data:/data:ro, emptyDir:/scratch)")
+	rootCmd.Flags().StringArray("strip-volume", []string{}, "Remove a named volume and its mounts from the new pod")
+	rootCmd.Flags().Bool("strip-pvc-volumes", false, "Remove all PersistentVolumeClaim volumes and their mounts from the new pod")
+	rootCmd.Flags().String("scratch", "", "Mount a writable emptyDir scratch volume at this path")
+	rootCmd.Flags().String("scratch-size", "", "Size limit of the scratch volume (e.g., 2Gi)")
+	rootCmd.Flags().Bool("scratch-memory", false, "Back the scratch volume with memory (tmpfs)")
+	rootCmd.Flags().Bool("strip-lifecycle-hooks", false, "Remove postStart/preStop lifecycle hooks from all containers in the new pod")
+	rootCmd.Flags().Bool("keep-readiness-gates", false, "Keep the source pod's readinessGates on the new pod")
+	rootCmd.Flags().Bool("edit", false, "Open the generated pod YAML in $KUBE_EDITOR or $EDITOR before creating it")
+	rootCmd.Flags().StringArray("patch-file", []string{}, "YAML or JSON strategic merge patch applied to the generated pod (can be repeated)")
+	rootCmd.Flags().StringArray("json-patch", []string{}, "File with RFC 6902 JSON patch operations applied to the generated pod (can be repeated)")
+	rootCmd.Flags().String("overrides", "", "Inline JSON merged into the generated pod as a JSON merge patch (e.g., '{\"spec\":{\"dnsPolicy\":\"Default\"}}')")
 }
 
 func main() {
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Metadata kmime puts on every clone, so clones can be found, attributed
+// and matched by policies without reading the history.
+const (
+	cloneLabel     = "kmime-clone"
+	managedByLabel = "app.kubernetes.io/managed-by"
+	managedByKmime = "kmime"
+	sourcePodKey   = "kmime.io/source-pod"
+	userKey        = "kmime.io/user"
+	createdAtKey   = "kmime.io/created-at"
+)
+
+// auxiliaryLabels mark the Secrets, ConfigMaps and Leases created alongside
+// a clone, with the clone's creator so kmime gc --mine finds them.
+func auxiliaryLabels(pod *v1.Pod) map[string]string {
+	labels := map[string]string{cloneLabel: "true", managedByLabel: managedByKmime}
+	if user, ok := pod.Labels[userKey]; ok {
+		labels[userKey] = user
+	}
+	return labels
+}
+
+// addManagementMetadata labels and annotates a clone of sourcePod made by
+// user, who is empty with --skip-identification. Values that do not fit in
+// a label, such as long pod names, are only kept in the annotations.
+func addManagementMetadata(labels, annotations map[string]string, sourcePod, user string, now time.Time) {
+	// A clone of a clone must not keep its source's values.
+	for _, key := range []string{sourcePodKey, userKey, createdAtKey} {
+		delete(labels, key)
+		delete(annotations, key)
+	}
+	labels[cloneLabel] = "true"
+	labels[managedByLabel] = managedByKmime
+	annotations[sourcePodKey] = sourcePod
+	if len(validation.IsValidLabelValue(sourcePod)) == 0 {
+		labels[sourcePodKey] = sourcePod
+	}
+	if user != "" {
+		annotations[userKey] = user
+		if len(validation.IsValidLabelValue(user)) == 0 {
+			labels[userKey] = user
+		}
+	}
+	annotations[createdAtKey] = now.UTC().Format(time.RFC3339)
+}
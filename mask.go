@@ -0,0 +1,100 @@
+package main
+
+import (
+	"math"
+	"regexp"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+const maskedValue = "********"
+
+// secretNameParts mark an env var as sensitive when one of the
+// underscore-separated segments of its name matches.
+var secretNameParts = map[string]bool{
+	"PASSWORD": true, "PASSWD": true,
+	"TOKEN": true, "TOKENS": true,
+	"KEY": true, "KEYS": true, "APIKEY": true,
+	"SECRET": true, "SECRETS": true,
+	"CREDENTIAL": true, "CREDENTIALS": true,
+	"PRIVATE": true, "AUTH": true,
+}
+
+// secretValuePatterns match well-known credential formats.
+var secretValuePatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*$`),                // JWT
+	regexp.MustCompile(`^(gh[pousr]_|github_pat_|glpat-|xox[abpr]-|sk-|AKIA)[A-Za-z0-9_-]+`), // vendor tokens
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`),
+	regexp.MustCompile(`^[a-z][a-z0-9+.-]*://[^:/@\s]+:[^@\s]+@`), // URL with credentials
+}
+
+// maskSecrets returns a copy of the pod whose secret-looking literal env
+// values are replaced, for output that may end up in tickets or chat.
+func maskSecrets(pod *v1.Pod) *v1.Pod {
+	masked := pod.DeepCopy()
+	for _, containers := range [][]v1.Container{masked.Spec.InitContainers, masked.Spec.Containers} {
+		for i := range containers {
+			maskEnv(containers[i].Env)
+		}
+	}
+	for i := range masked.Spec.EphemeralContainers {
+		maskEnv(masked.Spec.EphemeralContainers[i].Env)
+	}
+	return masked
+}
+
+func maskEnv(envs []v1.EnvVar) {
+	for i := range envs {
+		if envs[i].Value != "" && looksSecret(envs[i].Name, envs[i].Value) {
+			envs[i].Value = maskedValue
+		}
+	}
+}
+
+func looksSecret(name, value string) bool {
+	segments := strings.FieldsFunc(strings.ToUpper(name), func(r rune) bool {
+		return r == '_' || r == '-' || r == '.'
+	})
+	for _, segment := range segments {
+		if secretNameParts[segment] {
+			return true
+		}
+	}
+	for _, pattern := range secretValuePatterns {
+		if pattern.MatchString(value) {
+			return true
+		}
+	}
+	return isHighEntropy(value)
+}
+
+// isHighEntropy flags long random-looking strings such as API keys, while
+// leaving paths, URLs and sentences alone.
+func isHighEntropy(value string) bool {
+	if len(value) < 20 || strings.ContainsAny(value, " /.:") {
+		return false
+	}
+	var hasDigit, hasLetter bool
+	counts := make(map[rune]int)
+	for _, r := range value {
+		counts[r]++
+		switch {
+		case r >= '0' && r <= '9':
+			hasDigit = true
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+			hasLetter = true
+		}
+	}
+	if !hasDigit || !hasLetter {
+		return false
+	}
+
+	var entropy float64
+	length := float64(len([]rune(value)))
+	for _, c := range counts {
+		p := float64(c) / length
+		entropy -= p * math.Log2(p)
+	}
+	return entropy >= 4.0
+}
@@ -1,58 +1,273 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
-	"os"
+	"net"
 	"strings"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 func parseLabels(labels []string) (map[string]string, error) {
-	labelMap := make(map[string]string)
-	for _, l := range labels {
-		parts := strings.SplitN(l, "=", 2)
+	return parseKeyValuePairs(labels, "label")
+}
+
+func parseAnnotations(annotations []string) (map[string]string, error) {
+	return parseKeyValuePairs(annotations, "annotation")
+}
+
+func parseKeyValuePairs(pairs []string, kind string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, p := range pairs {
+		parts := strings.SplitN(p, "=", 2)
 		if len(parts) != 2 {
-			return nil, fmt.Errorf("invalid label format: %s, expected key=value", l)
+			return nil, fmt.Errorf("invalid %s format: %s, expected key=value", kind, p)
 		}
-		labelMap[parts[0]] = parts[1]
+		result[parts[0]] = parts[1]
 	}
-	return labelMap, nil
+	return result, nil
 }
 
-func parseEnvFile(filePath string) ([]v1.EnvVar, error) {
-	if filePath == "" {
-		return nil, nil
+// parseEnvVars accepts KEY=value pairs; the value may be empty.
+func parseEnvVars(pairs []string) ([]v1.EnvVar, error) {
+	var envs []v1.EnvVar
+	for _, p := range pairs {
+		name, value, ok := strings.Cut(p, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid env format: %s, expected KEY=value", p)
+		}
+		if errs := validation.IsEnvVarName(name); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid env name %q: %s", name, strings.Join(errs, "; "))
+		}
+		envs = append(envs, v1.EnvVar{Name: name, Value: value})
 	}
+	return envs, nil
+}
 
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("could not open env file %s: %w", filePath, err)
+// parseEnvFrom accepts configmap/<name> or secret/<name>.
+func parseEnvFrom(sources []string) ([]v1.EnvFromSource, error) {
+	var result []v1.EnvFromSource
+	for _, s := range sources {
+		kind, name, ok := strings.Cut(s, "/")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid env-from format: %s, expected configmap/<name> or secret/<name>", s)
+		}
+		ref := v1.LocalObjectReference{Name: name}
+		switch strings.ToLower(kind) {
+		case "configmap", "cm":
+			result = append(result, v1.EnvFromSource{ConfigMapRef: &v1.ConfigMapEnvSource{LocalObjectReference: ref}})
+		case "secret":
+			result = append(result, v1.EnvFromSource{SecretRef: &v1.SecretEnvSource{LocalObjectReference: ref}})
+		default:
+			return nil, fmt.Errorf("invalid env-from kind: %s, expected configmap or secret", kind)
+		}
 	}
-	defer file.Close()
+	return result, nil
+}
 
-	var envs []v1.EnvVar
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
+func parseCapabilities(capabilities []string, allowed []string) ([]v1.Capability, error) {
+	if len(allowed) == 0 {
+		allowed = defaultAllowedCapabilities
+	}
+	allowedSet := make(map[string]bool)
+	for _, c := range allowed {
+		allowedSet[normalizeCapability(c)] = true
+	}
+
+	var result []v1.Capability
+	for _, c := range capabilities {
+		name := normalizeCapability(c)
+		if name == "" {
 			continue
 		}
+		if !allowedSet[name] {
+			return nil, fmt.Errorf("capability %s is not in the allow-list (%s)", name, strings.Join(allowed, ", "))
+		}
+		result = append(result, v1.Capability(name))
+	}
+	return result, nil
+}
 
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) != 2 {
-			if strings.HasSuffix(line, "=") {
-				envs = append(envs, v1.EnvVar{Name: parts[0], Value: ""})
+func normalizeCapability(c string) string {
+	return strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(c)), "CAP_")
+}
+
+// parseTolerations accepts the kubectl taint syntax key[=value][:effect].
+// Without a value the toleration uses the Exists operator, and without an
+// effect it matches all effects.
+func parseTolerations(tolerations []string) ([]v1.Toleration, error) {
+	var result []v1.Toleration
+	for _, t := range tolerations {
+		spec, effect, _ := strings.Cut(t, ":")
+		key, value, hasValue := strings.Cut(spec, "=")
+		if key == "" {
+			return nil, fmt.Errorf("invalid toleration format: %s, expected key[=value][:effect]", t)
+		}
+
+		toleration := v1.Toleration{Key: key, Operator: v1.TolerationOpExists}
+		if hasValue {
+			toleration.Operator = v1.TolerationOpEqual
+			toleration.Value = value
+		}
+
+		switch v1.TaintEffect(effect) {
+		case "", v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute:
+			toleration.Effect = v1.TaintEffect(effect)
+		default:
+			return nil, fmt.Errorf("invalid toleration effect %q in %s, expected NoSchedule, PreferNoSchedule or NoExecute", effect, t)
+		}
+
+		result = append(result, toleration)
+	}
+	return result, nil
+}
+
+type extraVolume struct {
+	volume v1.Volume
+	mount  v1.VolumeMount
+}
+
+// parseVolumes accepts <type>:<source>:<mountPath>[:ro], where type is one
+// of configMap, secret, pvc or hostPath, and emptyDir:<mountPath>[:ro].
+func parseVolumes(volumes []string) ([]extraVolume, error) {
+	var result []extraVolume
+	for i, spec := range volumes {
+		parts := strings.Split(spec, ":")
+		name := fmt.Sprintf("kmime-volume-%d", i)
+
+		var source v1.VolumeSource
+		var rest []string
+		switch parts[0] {
+		case "emptyDir":
+			source.EmptyDir = &v1.EmptyDirVolumeSource{}
+			rest = parts[1:]
+		case "configMap", "secret", "pvc", "hostPath":
+			if len(parts) < 3 || parts[1] == "" {
+				return nil, fmt.Errorf("invalid volume format: %s, expected %s:<source>:<mountPath>[:ro]", spec, parts[0])
 			}
-			continue
+			switch parts[0] {
+			case "configMap":
+				source.ConfigMap = &v1.ConfigMapVolumeSource{LocalObjectReference: v1.LocalObjectReference{Name: parts[1]}}
+			case "secret":
+				source.Secret = &v1.SecretVolumeSource{SecretName: parts[1]}
+			case "pvc":
+				source.PersistentVolumeClaim = &v1.PersistentVolumeClaimVolumeSource{ClaimName: parts[1]}
+			case "hostPath":
+				source.HostPath = &v1.HostPathVolumeSource{Path: parts[1]}
+			}
+			rest = parts[2:]
+		default:
+			return nil, fmt.Errorf("invalid volume type %q in %s, expected configMap, secret, pvc, emptyDir or hostPath", parts[0], spec)
+		}
+
+		if len(rest) == 0 || !strings.HasPrefix(rest[0], "/") {
+			return nil, fmt.Errorf("invalid volume format: %s, the mount path must be absolute", spec)
 		}
-		envs = append(envs, v1.EnvVar{Name: parts[0], Value: parts[1]})
+		if len(rest) > 2 || (len(rest) == 2 && rest[1] != "ro") {
+			return nil, fmt.Errorf("invalid volume format: %s, only the :ro option is supported", spec)
+		}
+
+		result = append(result, extraVolume{
+			volume: v1.Volume{Name: name, VolumeSource: source},
+			mount:  v1.VolumeMount{Name: name, MountPath: rest[0], ReadOnly: len(rest) == 2},
+		})
 	}
+	return result, nil
+}
 
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading env file %s: %w", filePath, err)
+// scratchVolume builds the emptyDir behind --scratch.
+func scratchVolume(mountPath, sizeLimit string, memory bool) (*extraVolume, error) {
+	if mountPath == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(mountPath, "/") {
+		return nil, fmt.Errorf("invalid scratch path: %s, the mount path must be absolute", mountPath)
 	}
 
-	return envs, nil
+	emptyDir := &v1.EmptyDirVolumeSource{}
+	if memory {
+		emptyDir.Medium = v1.StorageMediumMemory
+	}
+	if sizeLimit != "" {
+		size, err := resource.ParseQuantity(sizeLimit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid scratch size %s: %w", sizeLimit, err)
+		}
+		emptyDir.SizeLimit = &size
+	}
+
+	return &extraVolume{
+		volume: v1.Volume{Name: "kmime-scratch", VolumeSource: v1.VolumeSource{EmptyDir: emptyDir}},
+		mount:  v1.VolumeMount{Name: "kmime-scratch", MountPath: mountPath},
+	}, nil
+}
+
+// parseEphemeralStorage validates the --ephemeral-storage-request and
+// --ephemeral-storage-limit values. Empty values yield nil.
+func parseEphemeralStorage(request, limit string) (*resource.Quantity, *resource.Quantity, error) {
+	var req, lim *resource.Quantity
+	if request != "" {
+		q, err := resource.ParseQuantity(request)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid ephemeral-storage request %s: %w", request, err)
+		}
+		req = &q
+	}
+	if limit != "" {
+		q, err := resource.ParseQuantity(limit)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid ephemeral-storage limit %s: %w", limit, err)
+		}
+		lim = &q
+	}
+	if req != nil && lim != nil && req.Cmp(*lim) > 0 {
+		return nil, nil, fmt.Errorf("ephemeral-storage request %s exceeds limit %s", request, limit)
+	}
+	return req, lim, nil
+}
+
+// parseSmallProfile resolves the --small resources, falling back to
+// defaultSmallProfile for anything the config leaves out.
+func parseSmallProfile(profile *smallProfile) (v1.ResourceList, error) {
+	resolved := defaultSmallProfile
+	if profile != nil {
+		if profile.CPU != "" {
+			resolved.CPU = profile.CPU
+		}
+		if profile.Memory != "" {
+			resolved.Memory = profile.Memory
+		}
+	}
+
+	cpu, err := resource.ParseQuantity(resolved.CPU)
+	if err != nil {
+		return nil, fmt.Errorf("invalid small profile cpu %s: %w", resolved.CPU, err)
+	}
+	memory, err := resource.ParseQuantity(resolved.Memory)
+	if err != nil {
+		return nil, fmt.Errorf("invalid small profile memory %s: %w", resolved.Memory, err)
+	}
+	return v1.ResourceList{v1.ResourceCPU: cpu, v1.ResourceMemory: memory}, nil
+}
+
+// parseHostAliases accepts ip=hostname[,hostname...].
+func parseHostAliases(aliases []string) ([]v1.HostAlias, error) {
+	var result []v1.HostAlias
+	for _, a := range aliases {
+		ip, hostnames, ok := strings.Cut(a, "=")
+		if !ok || net.ParseIP(ip) == nil || hostnames == "" {
+			return nil, fmt.Errorf("invalid host alias format: %s, expected ip=hostname[,hostname...]", a)
+		}
+
+		alias := v1.HostAlias{IP: ip}
+		for _, h := range strings.Split(hostnames, ",") {
+			if h = strings.TrimSpace(h); h != "" {
+				alias.Hostnames = append(alias.Hostnames, h)
+			}
+		}
+		result = append(result, alias)
+	}
+	return result, nil
 }
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"sigs.k8s.io/yaml"
+)
+
+// parseOverrides validates an --overrides fragment, which must be a JSON
+// object.
+func parseOverrides(overrides string) ([]byte, error) {
+	if overrides == "" {
+		return nil, nil
+	}
+	var fragment map[string]any
+	if err := json.Unmarshal([]byte(overrides), &fragment); err != nil {
+		return nil, fmt.Errorf("invalid overrides, expected a JSON object: %w", err)
+	}
+	return []byte(overrides), nil
+}
+
+// readPatchFiles loads YAML or JSON strategic merge patches and converts
+// them to JSON.
+func readPatchFiles(paths []string) ([][]byte, error) {
+	var patches [][]byte
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read patch file %s: %w", path, err)
+		}
+		patch, err := yaml.YAMLToJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid patch file %s: %w", path, err)
+		}
+		patches = append(patches, patch)
+	}
+	return patches, nil
+}
+
+// readJSONPatches loads RFC 6902 operation lists written in YAML or JSON.
+func readJSONPatches(paths []string) ([]jsonpatch.Patch, error) {
+	var patches []jsonpatch.Patch
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read JSON patch %s: %w", path, err)
+		}
+		ops, err := yaml.YAMLToJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON patch %s: %w", path, err)
+		}
+		patch, err := jsonpatch.DecodePatch(ops)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON patch %s: %w", path, err)
+		}
+		patches = append(patches, patch)
+	}
+	return patches, nil
+}
+
+// customizePod applies the user's free-form changes on top of the generated
+// clone: patch files, then JSON patches, each in order, then the inline
+// overrides. Mutation plugins run later, in finalizePod.
+func customizePod(pod *v1.Pod, params *kmimeParams) (*v1.Pod, error) {
+	for i, patch := range params.patches {
+		patched, err := strategicPatchPod(pod, patch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply patch file %s: %w", params.patchFiles[i], err)
+		}
+		pod = patched
+	}
+	for i, patch := range params.jsonPatches {
+		patched, err := jsonPatchPod(pod, patch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply JSON patch %s: %w", params.jsonPatchFiles[i], err)
+		}
+		pod = patched
+	}
+	if len(params.overrides) > 0 {
+		patched, err := mergePatchPod(pod, params.overrides)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply overrides: %w", err)
+		}
+		pod = patched
+	}
+	return pod, nil
+}
+
+// mergePatchPod applies an RFC 7386 JSON merge patch, the default patch type
+// of kubectl run --overrides.
+func mergePatchPod(pod *v1.Pod, patch []byte) (*v1.Pod, error) {
+	original, err := json.Marshal(pod)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := jsonpatch.MergePatch(original, patch)
+	if err != nil {
+		return nil, err
+	}
+	return decodePod(merged)
+}
+
+// strategicPatchPod applies a strategic merge patch, which merges lists such
+// as containers and volumes by name instead of replacing them.
+func strategicPatchPod(pod *v1.Pod, patch []byte) (*v1.Pod, error) {
+	original, err := json.Marshal(pod)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := strategicpatch.StrategicMergePatch(original, patch, v1.Pod{})
+	if err != nil {
+		return nil, err
+	}
+	return decodePod(merged)
+}
+
+func jsonPatchPod(pod *v1.Pod, patch jsonpatch.Patch) (*v1.Pod, error) {
+	original, err := json.Marshal(pod)
+	if err != nil {
+		return nil, err
+	}
+	patched, err := patch.Apply(original)
+	if err != nil {
+		return nil, err
+	}
+	return decodePod(patched)
+}
+
+// decodePod rejects unknown fields, which json.Unmarshal would silently
+// drop, so typos in patches and overrides surface immediately.
+func decodePod(data []byte) (*v1.Pod, error) {
+	var pod v1.Pod
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&pod); err != nil {
+		return nil, fmt.Errorf("patched object is not a valid pod: %w", err)
+	}
+	return &pod, nil
+}
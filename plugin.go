@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const mutationPluginTimeout = 30 * time.Second
+
+// runMutationPlugins pipes the pod through each configured plugin in order.
+// A plugin is a command line that reads the pod as JSON on stdin and prints
+// the mutated pod as JSON or YAML. WASM modules run through a runtime, e.g.
+// "wasmtime run mutate.wasm".
+func runMutationPlugins(pod *v1.Pod, plugins []string, sourcePod string) (*v1.Pod, error) {
+	for _, plugin := range plugins {
+		mutated, err := runMutationPlugin(pod, plugin, sourcePod)
+		if err != nil {
+			return nil, fmt.Errorf("mutation plugin %q: %w", plugin, err)
+		}
+		pod = mutated
+	}
+	return pod, nil
+}
+
+func runMutationPlugin(pod *v1.Pod, plugin, sourcePod string) (*v1.Pod, error) {
+	args := strings.Fields(plugin)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+	input, err := json.Marshal(pod)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mutationPluginTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), "KMIME_SOURCE_POD="+sourcePod, "KMIME_NAMESPACE="+pod.Namespace)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("timed out after %s", mutationPluginTimeout)
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+
+	var mutated v1.Pod
+	if err := yaml.UnmarshalStrict(stdout.Bytes(), &mutated); err != nil {
+		return nil, fmt.Errorf("output is not a valid pod: %w", err)
+	}
+	if err := validateEditedPod(&mutated); err != nil {
+		return nil, fmt.Errorf("output is not a valid pod: %w", err)
+	}
+	return &mutated, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// portForwardMsg reports the port-forward started for the session. stop is
+// nil when it could not be started.
+type portForwardMsg struct {
+	stop chan struct{}
+	err  error
+}
+
+// validatePortForwards checks --port-forward values, which are
+// [local:]remote port pairs as in kubectl port-forward.
+func validatePortForwards(specs []string) error {
+	for _, spec := range specs {
+		for _, port := range strings.SplitN(spec, ":", 2) {
+			if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+				return fmt.Errorf("invalid port forward %q, expected [local:]remote with ports between 1 and 65535", spec)
+			}
+		}
+	}
+	return nil
+}
+
+// startPortForward forwards the ports from localhost to the pod in the
+// background until stop is closed. It returns once the listeners are ready.
+func startPortForward(clientset *kubernetes.Clientset, config *rest.Config, namespace, podName string, ports []string) (chan struct{}, error) {
+	transport, upgrader, err := spdy.RoundTripperFor(config)
+	if err != nil {
+		return nil, err
+	}
+	url := clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(podName).
+		SubResource("portforward").
+		URL()
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, url)
+
+	stop := make(chan struct{})
+	ready := make(chan struct{})
+	// Connection errors are not printed: they would garble the attached
+	// terminal.
+	forwarder, err := portforward.New(dialer, ports, stop, ready, io.Discard, io.Discard)
+	if err != nil {
+		return nil, err
+	}
+	errs := make(chan error, 1)
+	go func() { errs <- forwarder.ForwardPorts() }()
+
+	select {
+	case <-ready:
+		return stop, nil
+	case err := <-errs:
+		return nil, fmt.Errorf("could not forward ports %s: %w", strings.Join(ports, ", "), err)
+	}
+}
+
+func startPortForwardCmd(clientset *kubernetes.Clientset, config *rest.Config, namespace, podName string, ports []string) tea.Cmd {
+	return func() tea.Msg {
+		stop, err := startPortForward(clientset, config, namespace, podName, ports)
+		return portForwardMsg{stop: stop, err: err}
+	}
+}
+
+// describePortForwards lists the forwarded ports for the status line.
+func describePortForwards(specs []string) string {
+	var parts []string
+	for _, spec := range specs {
+		local, remote, found := strings.Cut(spec, ":")
+		if !found {
+			remote = local
+		}
+		parts = append(parts, fmt.Sprintf("localhost:%s → %s", local, remote))
+	}
+	return strings.Join(parts, ", ")
+}
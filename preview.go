@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
+)
+
+const previewFileName = "kmime-preview.yaml"
+
+// Values of --dry-run.
+const (
+	dryRunNone   = "none"
+	dryRunClient = "client"
+	dryRunServer = "server"
+)
+
+// previewFormats are the values accepted by -o/--output that print the spec
+// instead of creating the pod.
+var previewFormats = []string{"yaml", "json"}
+
+// outputName prints the created pod's name as pod/<name>, like kubectl.
+const outputName = "name"
+
+func validatePreviewFormat(format string) error {
+	if format == "" {
+		return nil
+	}
+	for _, f := range previewFormats {
+		if format == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported output format %q, expected yaml, json, name or events", format)
+}
+
+// previewObjects lists every object kmime would create for the pod, in
+// creation order, ending with the pod itself, or its Job with --as-job.
+// Secret values are only resolved with showSecrets.
+func previewObjects(pod *v1.Pod, params *kmimeParams, showSecrets bool) ([]runtime.Object, error) {
+	var objects []runtime.Object
+	if len(params.secretRefs) > 0 {
+		secret, err := envSecret(pod, params.secretRefs, showSecrets)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, secret)
+	}
+	if params.script != nil {
+		objects = append(objects, scriptConfigMap(pod, params.script))
+	}
+	if params.asJob {
+		return append(objects, jobForPod(pod, params)), nil
+	}
+	return append(objects, pod), nil
+}
+
+// withTypeMeta returns a copy of obj with its apiVersion and kind set, so
+// the output can be fed to kubectl.
+func withTypeMeta(obj runtime.Object) (runtime.Object, error) {
+	gvks, _, err := scheme.Scheme.ObjectKinds(obj)
+	if err != nil {
+		return nil, err
+	}
+	typed := obj.DeepCopyObject()
+	typed.GetObjectKind().SetGroupVersionKind(gvks[0])
+	return typed, nil
+}
+
+// renderObjects serializes the objects as a multi-document YAML stream or,
+// in JSON, as the single object or a List of them.
+func renderObjects(objects []runtime.Object, format string) ([]byte, error) {
+	var typed []runtime.Object
+	for _, obj := range objects {
+		t, err := withTypeMeta(obj)
+		if err != nil {
+			return nil, err
+		}
+		typed = append(typed, t)
+	}
+
+	if format != "json" {
+		var docs [][]byte
+		for _, obj := range typed {
+			data, err := yaml.Marshal(obj)
+			if err != nil {
+				return nil, fmt.Errorf("could not marshal %s to YAML: %w", obj.GetObjectKind().GroupVersionKind().Kind, err)
+			}
+			docs = append(docs, data)
+		}
+		return bytes.Join(docs, []byte("---\n")), nil
+	}
+
+	var out any = typed[0]
+	if len(typed) > 1 {
+		list := &v1.List{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "List"}}
+		for _, obj := range typed {
+			list.Items = append(list.Items, runtime.RawExtension{Object: obj})
+		}
+		out = list
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal preview to JSON: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// writePreview renders the objects in the given format, YAML by default, and
+// writes them to path. "-" means stdout, as does an empty path when a format
+// was asked for; otherwise an empty path means kmime-preview.yaml. Existing
+// files are only replaced with force.
+func writePreview(objects []runtime.Object, format, path string, force bool) error {
+	data, err := renderObjects(objects, format)
+	if err != nil {
+		return err
+	}
+	if path == "-" || (path == "" && format != "") {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if path == "" {
+		path = previewFileName
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !force {
+		flags |= os.O_EXCL
+	}
+	file, err := os.OpenFile(path, flags, 0644)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf("%s already exists, use --force to overwrite it", path)
+	}
+	if err != nil {
+		return fmt.Errorf("could not write preview file: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(data); err != nil {
+		return fmt.Errorf("could not write preview file: %w", err)
+	}
+	fmt.Printf("Pod specification saved to %s\n", path)
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+// podProgressMsg reports what a starting pod is waiting on: its status, its
+// latest event, or a warning event. next waits for the following update.
+type podProgressMsg struct {
+	status  string
+	event   string
+	warning string
+	next    tea.Cmd
+}
+
+// startupFailureReasons are container waiting reasons the kubelet keeps
+// retrying without a chance of success, so waiting for the pod fails fast.
+var startupFailureReasons = map[string]bool{
+	"ImagePullBackOff":           true,
+	"ErrImageNeverPull":          true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+// startupError reports a container stuck in one of startupFailureReasons.
+func startupError(pod *v1.Pod) error {
+	statuses := append(append([]v1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+	for _, status := range statuses {
+		if waiting := status.State.Waiting; waiting != nil && startupFailureReasons[waiting.Reason] {
+			return fmt.Errorf("container '%s' cannot start: %s: %s", status.Name, waiting.Reason, waiting.Message)
+		}
+	}
+	return nil
+}
+
+// podWaitStatus summarizes why the pod is not running yet, like the STATUS
+// column of kubectl get pods.
+func podWaitStatus(pod *v1.Pod) string {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodScheduled && condition.Status == v1.ConditionFalse && condition.Reason != "" {
+			return condition.Reason
+		}
+	}
+	for _, status := range pod.Status.InitContainerStatuses {
+		if status.State.Waiting != nil && status.State.Waiting.Reason != "" {
+			return "Init:" + status.State.Waiting.Reason
+		}
+		if status.State.Running != nil {
+			return "Init:" + status.Name
+		}
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Waiting != nil && status.State.Waiting.Reason != "" {
+			return status.State.Waiting.Reason
+		}
+	}
+	return string(pod.Status.Phase)
+}
+
+// waitWithProgress runs wait in the background, sending the pods it watches
+// and the pod's events to the TUI as podProgressMsgs, then wait's result.
+func waitWithProgress(clientset *kubernetes.Clientset, namespace, podName string, wait func(report func(*v1.Pod)) tea.Msg) tea.Cmd {
+	updates := make(chan tea.Msg, 16)
+	// Progress is dropped rather than blocking the wait when the TUI is
+	// behind; only the result has to arrive.
+	offer := func(msg podProgressMsg) {
+		select {
+		case updates <- msg:
+		default:
+		}
+	}
+	go func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		go watchPodEvents(ctx, clientset, namespace, podName, func(event *v1.Event) {
+			text := fmt.Sprintf("%s: %s", event.Reason, strings.TrimSpace(event.Message))
+			if event.Type == v1.EventTypeWarning {
+				offer(podProgressMsg{warning: text})
+			} else {
+				offer(podProgressMsg{event: text})
+			}
+		})
+		result := wait(func(pod *v1.Pod) {
+			offer(podProgressMsg{status: podWaitStatus(pod)})
+		})
+		cancel()
+		updates <- result
+	}()
+	return nextPodProgress(updates)
+}
+
+func nextPodProgress(updates chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		msg := <-updates
+		if progress, ok := msg.(podProgressMsg); ok {
+			progress.next = nextPodProgress(updates)
+			return progress
+		}
+		return msg
+	}
+}
+
+// watchPodEvents reports the pod's events, including the ones it already
+// has, until ctx is done.
+func watchPodEvents(ctx context.Context, clientset *kubernetes.Clientset, namespace, podName string, report func(*v1.Event)) {
+	watcher, err := clientset.CoreV1().Events(namespace).Watch(ctx, metav1.ListOptions{
+		FieldSelector: fields.Set{"involvedObject.kind": "Pod", "involvedObject.name": podName}.String(),
+	})
+	if err != nil {
+		return
+	}
+	defer watcher.Stop()
+	for {
+		select {
+		case e, ok := <-watcher.ResultChan():
+			if !ok {
+				return
+			}
+			if event, ok := e.Object.(*v1.Event); ok {
+				report(event)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// podWaitCmd waits up to timeout for the pod to start, reporting its
+// progress. check decides, like the done function of waitForPod, when it has.
+func podWaitCmd(clientset *kubernetes.Clientset, namespace, podName, state string, timeout time.Duration, check func(*v1.Pod) (bool, error), result tea.Msg) tea.Cmd {
+	return waitWithProgress(clientset, namespace, podName, func(report func(*v1.Pod)) tea.Msg {
+		time.Sleep(1 * time.Second)
+		err := waitForPod(clientset, namespace, podName, state, timeout, func(pod *v1.Pod) (bool, error) {
+			report(pod)
+			return check(pod)
+		})
+		if err != nil {
+			return errorMsg{err}
+		}
+		return result
+	})
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// copySpec pairs a local path with a path in the clone, for --copy-in and
+// --collect.
+type copySpec struct {
+	local  string
+	remote string
+}
+
+// copiedInMsg and collectedMsg report the --copy-in and --collect paths
+// that could not be copied.
+type (
+	copiedInMsg  struct{ warnings []string }
+	collectedMsg struct{ warnings []string }
+)
+
+// parseCopyIn parses --copy-in values, local:remote. The remote path comes
+// after the last colon, so Windows drive letters survive.
+func parseCopyIn(values []string) ([]copySpec, error) {
+	var specs []copySpec
+	for _, value := range values {
+		i := strings.LastIndex(value, ":")
+		if i <= 0 || i == len(value)-1 {
+			return nil, fmt.Errorf("invalid value %q, expected <local path>:<path in the pod>", value)
+		}
+		spec := copySpec{local: value[:i], remote: value[i+1:]}
+		if _, err := os.Stat(spec.local); err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// copyInCmd copies the --copy-in paths into the container before the
+// session starts. Failures are only warned about, so the session still opens.
+func copyInCmd(clientset *kubernetes.Clientset, config *rest.Config, namespace, podName, container string, specs []copySpec) tea.Cmd {
+	return func() tea.Msg {
+		var warnings []string
+		for _, spec := range specs {
+			if err := copyToPod(clientset, config, namespace, podName, container, spec.local, spec.remote); err != nil {
+				warnings = append(warnings, fmt.Sprintf("--copy-in %s: %v", spec.local, err))
+			}
+		}
+		return copiedInMsg{warnings: warnings}
+	}
+}
+
+// parseCollect parses --collect values, remote:local. The local path comes
+// after the first colon, so Windows drive letters survive.
+func parseCollect(values []string) ([]copySpec, error) {
+	var specs []copySpec
+	for _, value := range values {
+		remote, local, found := strings.Cut(value, ":")
+		if !found || remote == "" || local == "" {
+			return nil, fmt.Errorf("invalid value %q, expected <path in the pod>:<local path>", value)
+		}
+		specs = append(specs, copySpec{local: local, remote: remote})
+	}
+	return specs, nil
+}
+
+// collectArtifacts downloads the --collect paths from the container,
+// returning a warning for each one that failed.
+func collectArtifacts(clientset *kubernetes.Clientset, config *rest.Config, namespace, podName, container string, specs []copySpec) []string {
+	var warnings []string
+	for _, spec := range specs {
+		if err := copyFromPod(clientset, config, namespace, podName, container, spec.remote, spec.local); err != nil {
+			warnings = append(warnings, fmt.Sprintf("--collect %s: %v", spec.remote, err))
+		}
+	}
+	return warnings
+}
+
+func collectCmd(clientset *kubernetes.Clientset, config *rest.Config, namespace, podName, container string, specs []copySpec) tea.Cmd {
+	return func() tea.Msg {
+		return collectedMsg{warnings: collectArtifacts(clientset, config, namespace, podName, container, specs)}
+	}
+}
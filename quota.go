@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+type quotaShortfall struct {
+	quota     string
+	resource  v1.ResourceName
+	needed    resource.Quantity
+	available resource.Quantity
+}
+
+func (s quotaShortfall) String() string {
+	return fmt.Sprintf("%s: %s needs %s but only %s is left", s.quota, s.resource, s.needed.String(), s.available.String())
+}
+
+// checkQuota compares what the pod would consume against the remaining
+// headroom of every unscoped ResourceQuota in its namespace.
+func checkQuota(clientset *kubernetes.Clientset, pod *v1.Pod) ([]quotaShortfall, error) {
+	quotas, err := clientset.CoreV1().ResourceQuotas(pod.Namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resource quotas in namespace '%s': %w", pod.Namespace, err)
+	}
+
+	usage := podQuotaUsage(pod)
+	var shortfalls []quotaShortfall
+	for _, quota := range quotas.Items {
+		if len(quota.Spec.Scopes) > 0 || quota.Spec.ScopeSelector != nil {
+			continue
+		}
+		for name, hard := range quota.Status.Hard {
+			needed, ok := usage[name]
+			if !ok {
+				continue
+			}
+			available := hard.DeepCopy()
+			if used, ok := quota.Status.Used[name]; ok {
+				available.Sub(used)
+			}
+			if needed.Cmp(available) > 0 {
+				shortfalls = append(shortfalls, quotaShortfall{
+					quota:     quota.Name,
+					resource:  name,
+					needed:    needed,
+					available: available,
+				})
+			}
+		}
+	}
+	return shortfalls, nil
+}
+
+// podQuotaUsage returns the pod's consumption keyed by the resource names
+// ResourceQuotas use, e.g. "requests.cpu", "cpu" and "limits.memory".
+func podQuotaUsage(pod *v1.Pod) v1.ResourceList {
+	usage := v1.ResourceList{v1.ResourcePods: resource.MustParse("1")}
+	add := func(name v1.ResourceName, q resource.Quantity) {
+		total := usage[name]
+		total.Add(q)
+		usage[name] = total
+	}
+
+	for _, c := range pod.Spec.Containers {
+		for name, q := range c.Resources.Requests {
+			add(v1.ResourceName("requests."+string(name)), q)
+			if name == v1.ResourceCPU || name == v1.ResourceMemory || name == v1.ResourceEphemeralStorage {
+				add(name, q)
+			}
+		}
+		for name, q := range c.Resources.Limits {
+			add(v1.ResourceName("limits."+string(name)), q)
+		}
+	}
+	return usage
+}
+
+// reduceRequestsToFit scales the containers' requests and limits down
+// proportionally so that every shortfall fits the remaining headroom.
+func reduceRequestsToFit(pod *v1.Pod, shortfalls []quotaShortfall) ([]string, error) {
+	var adjustments []string
+	for _, s := range shortfalls {
+		kind, name := splitQuotaResource(s.resource)
+		if kind == "" {
+			return nil, fmt.Errorf("cannot reduce %s to fit quota %s", s.resource, s.quota)
+		}
+		if s.available.Sign() <= 0 {
+			return nil, fmt.Errorf("quota %s has no %s left", s.quota, s.resource)
+		}
+
+		// Several quotas may constrain the same resource, so measure against
+		// what is left after the previous adjustments.
+		current := podQuotaUsage(pod)[s.resource]
+		if current.Cmp(s.available) <= 0 {
+			continue
+		}
+
+		ratio := quantityValue(name, s.available) / quantityValue(name, current)
+		for i := range pod.Spec.Containers {
+			resources := &pod.Spec.Containers[i].Resources
+			list := resources.Requests
+			if kind == "limits" {
+				list = resources.Limits
+			}
+			q, ok := list[name]
+			if !ok {
+				continue
+			}
+			list[name] = scaleQuantity(name, q, ratio)
+
+			// Requests may never exceed limits.
+			if limit, ok := resources.Limits[name]; ok {
+				if request, ok := resources.Requests[name]; ok && request.Cmp(limit) > 0 {
+					resources.Requests[name] = limit.DeepCopy()
+				}
+			}
+		}
+		adjustments = append(adjustments, fmt.Sprintf("reduced %s from %s to %s to fit quota %s", s.resource, current.String(), s.available.String(), s.quota))
+	}
+	return adjustments, nil
+}
+
+func splitQuotaResource(name v1.ResourceName) (string, v1.ResourceName) {
+	switch {
+	case strings.HasPrefix(string(name), "requests."):
+		return "requests", v1.ResourceName(strings.TrimPrefix(string(name), "requests."))
+	case strings.HasPrefix(string(name), "limits."):
+		return "limits", v1.ResourceName(strings.TrimPrefix(string(name), "limits."))
+	case name == v1.ResourceCPU || name == v1.ResourceMemory || name == v1.ResourceEphemeralStorage:
+		return "requests", name
+	}
+	return "", name
+}
+
+func quantityValue(name v1.ResourceName, q resource.Quantity) float64 {
+	if name == v1.ResourceCPU {
+		return float64(q.MilliValue())
+	}
+	return float64(q.Value())
+}
+
+func scaleQuantity(name v1.ResourceName, q resource.Quantity, ratio float64) resource.Quantity {
+	scaled := int64(quantityValue(name, q) * ratio)
+	if name == v1.ResourceCPU {
+		return *resource.NewMilliQuantity(scaled, q.Format)
+	}
+	return *resource.NewQuantity(scaled, q.Format)
+}
+
+// moveToNamespace moves the clone to namespace, for the debug namespace
+// remediation. The ServiceAccount, ConfigMaps, Secrets and
+// PersistentVolumeClaims the pod references are looked up there: a missing
+// ServiceAccount falls back to the default one, and the volumes, env vars
+// and image pull secrets referencing other missing objects are removed.
+// Each change is returned, as the pod would otherwise fail to start.
+func moveToNamespace(clientset *kubernetes.Clientset, pod *v1.Pod, namespace string) ([]string, error) {
+	from := pod.Namespace
+	pod.Namespace = namespace
+	adjustments := []string{fmt.Sprintf("scheduled in debug namespace %s due to insufficient quota in %s", namespace, from)}
+	found := map[string]bool{}
+	exists := func(kind, name string) (bool, error) {
+		key := kind + "/" + name
+		if ok, seen := found[key]; seen {
+			return ok, nil
+		}
+		var err error
+		switch kind {
+		case "serviceaccount":
+			_, err = clientset.CoreV1().ServiceAccounts(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		case "configmap":
+			_, err = clientset.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		case "secret":
+			_, err = clientset.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		case "persistentvolumeclaim":
+			_, err = clientset.CoreV1().PersistentVolumeClaims(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		}
+		if k8serrors.IsNotFound(err) {
+			found[key] = false
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to get %s '%s' in namespace '%s': %w", kind, name, namespace, err)
+		}
+		found[key] = true
+		return true, nil
+	}
+	missing := func(kind, name string, optional *bool) (bool, error) {
+		if optional != nil && *optional {
+			return false, nil
+		}
+		ok, err := exists(kind, name)
+		return !ok, err
+	}
+
+	if account := pod.Spec.ServiceAccountName; account != "" && account != "default" {
+		ok, err := exists("serviceaccount", account)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			pod.Spec.ServiceAccountName = ""
+			pod.Spec.DeprecatedServiceAccount = ""
+			adjustments = append(adjustments, fmt.Sprintf("used the default service account, %s does not exist in %s", account, namespace))
+		}
+	}
+
+	var pullSecrets []v1.LocalObjectReference
+	for _, ref := range pod.Spec.ImagePullSecrets {
+		gone, err := missing("secret", ref.Name, nil)
+		if err != nil {
+			return nil, err
+		}
+		if gone {
+			adjustments = append(adjustments, fmt.Sprintf("removed image pull secret %s, it does not exist in %s", ref.Name, namespace))
+			continue
+		}
+		pullSecrets = append(pullSecrets, ref)
+	}
+	pod.Spec.ImagePullSecrets = pullSecrets
+
+	var volumes []string
+	for _, vol := range pod.Spec.Volumes {
+		refs := volumeReferences(vol)
+		for _, ref := range refs {
+			gone, err := missing(ref.kind, ref.name, ref.optional)
+			if err != nil {
+				return nil, err
+			}
+			if gone {
+				volumes = append(volumes, vol.Name)
+				adjustments = append(adjustments, fmt.Sprintf("removed volume %s, %s %s does not exist in %s", vol.Name, ref.kind, ref.name, namespace))
+				break
+			}
+		}
+	}
+	stripVolumes(pod, volumes, false)
+
+	for _, containers := range [][]v1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for i := range containers {
+			c := &containers[i]
+			var envFrom []v1.EnvFromSource
+			for _, source := range c.EnvFrom {
+				kind, name, optional := "configmap", "", (*bool)(nil)
+				switch {
+				case source.ConfigMapRef != nil:
+					name, optional = source.ConfigMapRef.Name, source.ConfigMapRef.Optional
+				case source.SecretRef != nil:
+					kind, name, optional = "secret", source.SecretRef.Name, source.SecretRef.Optional
+				}
+				if name != "" {
+					gone, err := missing(kind, name, optional)
+					if err != nil {
+						return nil, err
+					}
+					if gone {
+						adjustments = append(adjustments, fmt.Sprintf("removed envFrom %s %s of container %s, it does not exist in %s", kind, name, c.Name, namespace))
+						continue
+					}
+				}
+				envFrom = append(envFrom, source)
+			}
+			c.EnvFrom = envFrom
+
+			var env []v1.EnvVar
+			for _, e := range c.Env {
+				kind, name, optional := "configmap", "", (*bool)(nil)
+				if e.ValueFrom != nil {
+					switch {
+					case e.ValueFrom.ConfigMapKeyRef != nil:
+						name, optional = e.ValueFrom.ConfigMapKeyRef.Name, e.ValueFrom.ConfigMapKeyRef.Optional
+					case e.ValueFrom.SecretKeyRef != nil:
+						kind, name, optional = "secret", e.ValueFrom.SecretKeyRef.Name, e.ValueFrom.SecretKeyRef.Optional
+					}
+				}
+				if name != "" {
+					gone, err := missing(kind, name, optional)
+					if err != nil {
+						return nil, err
+					}
+					if gone {
+						adjustments = append(adjustments, fmt.Sprintf("removed env var %s of container %s, %s %s does not exist in %s", e.Name, c.Name, kind, name, namespace))
+						continue
+					}
+				}
+				env = append(env, e)
+			}
+			c.Env = env
+		}
+	}
+	return adjustments, nil
+}
+
+// objectReference is a namespaced object a volume needs to exist.
+type objectReference struct {
+	kind, name string
+	optional   *bool
+}
+
+// volumeReferences lists the ConfigMaps, Secrets and claims the volume
+// reads from.
+func volumeReferences(vol v1.Volume) []objectReference {
+	var refs []objectReference
+	switch {
+	case vol.ConfigMap != nil:
+		refs = append(refs, objectReference{"configmap", vol.ConfigMap.Name, vol.ConfigMap.Optional})
+	case vol.Secret != nil:
+		refs = append(refs, objectReference{"secret", vol.Secret.SecretName, vol.Secret.Optional})
+	case vol.PersistentVolumeClaim != nil:
+		refs = append(refs, objectReference{"persistentvolumeclaim", vol.PersistentVolumeClaim.ClaimName, nil})
+	case vol.Projected != nil:
+		for _, source := range vol.Projected.Sources {
+			if source.ConfigMap != nil {
+				refs = append(refs, objectReference{"configmap", source.ConfigMap.Name, source.ConfigMap.Optional})
+			}
+			if source.Secret != nil {
+				refs = append(refs, objectReference{"secret", source.Secret.Name, source.Secret.Optional})
+			}
+		}
+	}
+	return refs
+}
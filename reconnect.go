@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/kubernetes"
+)
+
+// reconnectMsg reports whether the clone can be attached to again after
+// its stream dropped.
+type reconnectMsg struct{ err error }
+
+// stableSession is how long a session has to last for a later drop to get
+// the full set of reconnect attempts again.
+const stableSession = time.Minute
+
+// defaultReconnectAttempts is how often a dropped session is reattached
+// unless --reconnect-attempts says otherwise.
+const defaultReconnectAttempts = 5
+
+// reconnect reattaches after the session's stream broke, waiting twice as
+// long before each attempt. Once the attempts run out the session failed,
+// and --on-failure decides what happens to the clone.
+func (m model) reconnect(err error) (tea.Model, tea.Cmd) {
+	if m.reconnects >= m.params.reconnectAttempts {
+		return m.failed(fmt.Errorf("the connection was lost: %w", err))
+	}
+	delay := time.Second << m.reconnects
+	m.reconnects++
+	m.statusText = fmt.Sprintf("Connection lost, reconnecting in %s (attempt %d of %d)...", delay, m.reconnects, m.params.reconnectAttempts)
+	return m, reconnectCmd(m.clientset, m.namespace, m.newPodName, delay)
+}
+
+// connectionLost reports whether a session stream failed because the
+// connection to the API server or the node dropped, which reattaching can
+// fix. Denied requests, failures to set up the local terminal and other
+// errors are not retried.
+func connectionLost(err error) bool {
+	if err == nil {
+		return false
+	}
+	if k8serrors.IsForbidden(err) || k8serrors.IsUnauthorized(err) {
+		return false
+	}
+	if k8serrors.IsTimeout(err) || k8serrors.IsServerTimeout(err) || k8serrors.IsServiceUnavailable(err) || k8serrors.IsTooManyRequests(err) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	// The SPDY and websocket executors report stream failures as text.
+	message := err.Error()
+	for _, s := range []string{"connection reset", "broken pipe", "unexpected EOF", "use of closed network connection", "i/o timeout", "error reading from error stream", "stream error", "connection refused"} {
+		if strings.Contains(message, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// reconnectCmd waits for delay, then checks that the clone can still be
+// attached to. Failing to read it counts as another drop, since the API
+// server may be what went away.
+func reconnectCmd(clientset *kubernetes.Clientset, namespace, podName string, delay time.Duration) tea.Cmd {
+	return func() tea.Msg {
+		time.Sleep(delay)
+		pod, err := getPod(clientset, namespace, podName)
+		if k8serrors.IsNotFound(err) {
+			return errorMsg{fmt.Errorf("pod '%s' was deleted while reconnecting", podName)}
+		}
+		if err != nil {
+			return reconnectMsg{err}
+		}
+		if shellErr := missingShellError(pod); shellErr != nil {
+			return errorMsg{shellErr}
+		}
+		// The command exited while the stream was down.
+		if pod.Status.Phase == v1.PodFailed {
+			return errorMsg{podFailure(pod)}
+		}
+		if pod.Status.Phase == v1.PodSucceeded {
+			return podAttachedMsg{}
+		}
+		return reconnectMsg{checkAttachable(pod)}
+	}
+}
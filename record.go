@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// sessionOptions control an interactive session's local terminal.
+type sessionOptions struct {
+	// detachKeys end the stream with errDetached when typed.
+	detachKeys []byte
+	// recorder, when set, captures the session.
+	recorder *sessionRecorder
+	// outputLog, when set, gets a copy of everything written to the
+	// terminal.
+	outputLog io.Writer
+	// idleTimeout ends the stream with errIdleTimeout after that long
+	// without input or output.
+	idleTimeout time.Duration
+}
+
+// sessionRecorder writes a session as an asciinema v2 recording: a JSON
+// header line followed by one [time, type, data] event per line.
+type sessionRecorder struct {
+	mu    sync.Mutex
+	file  *os.File
+	enc   *json.Encoder
+	start time.Time
+	// pending holds an incomplete UTF-8 sequence per stream, since events
+	// must be valid strings.
+	pending map[string][]byte
+}
+
+// startRecording records a session, sized like the local terminal, to path.
+func startRecording(path string, command []string) (*sessionRecorder, error) {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		width, height = 80, 24
+	}
+	return newSessionRecorder(path, width, height, command)
+}
+
+// newSessionRecorder creates the recording readable by the owner only, like
+// the output log, as it holds everything typed and shown in the session.
+func newSessionRecorder(path string, width, height int, command []string) (*sessionRecorder, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("could not create recording: %w", err)
+	}
+	r := &sessionRecorder{file: file, enc: json.NewEncoder(file), start: time.Now(), pending: map[string][]byte{}}
+	header := map[string]any{
+		"version":   2,
+		"width":     width,
+		"height":    height,
+		"timestamp": r.start.Unix(),
+		"command":   strings.Join(command, " "),
+		"env":       map[string]string{"TERM": os.Getenv("TERM"), "SHELL": os.Getenv("SHELL")},
+	}
+	if err := r.enc.Encode(header); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("could not write recording: %w", err)
+	}
+	return r, nil
+}
+
+// openOutputLog opens the --log-output file, appending so a reattached
+// session continues the same log.
+func openOutputLog(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("could not open output log: %w", err)
+	}
+	return file, nil
+}
+
+func (r *sessionRecorder) event(kind string, data []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data = append(r.pending[kind], data...)
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	r.pending[kind] = append([]byte(nil), data[cut:]...)
+	if cut == 0 {
+		return
+	}
+	elapsed := time.Since(r.start).Seconds()
+	r.enc.Encode([]any{elapsed, kind, string(data[:cut])})
+}
+
+func (r *sessionRecorder) resize(width, height int) {
+	r.event("r", []byte(fmt.Sprintf("%dx%d", width, height)))
+}
+
+func (r *sessionRecorder) Close() error {
+	return r.file.Close()
+}
+
+// recordingReader records what is read as input events.
+type recordingReader struct {
+	r        io.Reader
+	recorder *sessionRecorder
+}
+
+func (rr recordingReader) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	if n > 0 {
+		rr.recorder.event("i", p[:n])
+	}
+	return n, err
+}
+
+// recordingWriter records what is written as output events.
+type recordingWriter struct {
+	w        io.Writer
+	recorder *sessionRecorder
+}
+
+func (rw recordingWriter) Write(p []byte) (int, error) {
+	rw.recorder.event("o", p)
+	return rw.w.Write(p)
+}
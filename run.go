@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run [source-pod] -- [command]",
+	Short: "Runs a command in a clone to completion without attaching to it.",
+	Long: `run creates the clone like kmime does, but instead of attaching a terminal it
+streams the command's output to stdout, waits for it to finish, removes the
+clone and exits with the command's exit code. It is the same as kmime
+--no-attach and takes the same flags.
+
+ctrl-c and ctrl-\ are forwarded to the command as SIGINT and SIGQUIT on a
+best-effort basis: the image needs kill or sh, and nothing is forwarded when
+the pod shares its process namespace.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if script, _ := cmd.Flags().GetString("script"); len(args) < 2 && script == "" {
+			log.Fatalf("Error processing arguments: a command to run or --script is required")
+		}
+		cmd.Flags().Set("no-attach", "true")
+		rootCmd.Run(cmd, args)
+	},
+}
+
+// addRunFlags shares every root flag with runCmd. It must run after the
+// root flags are defined.
+func addRunFlags() {
+	rootCmd.Flags().VisitAll(func(f *pflag.Flag) {
+		runCmd.Flags().AddFlag(f)
+	})
+}
+
+// waitForPodStarted waits for the pod's first container to run or for the
+// pod to finish, successfully or not, so its logs can be read.
+func waitForPodStarted(clientset *kubernetes.Clientset, namespace, podName string, timeout time.Duration) error {
+	return waitForPod(clientset, namespace, podName, "started", timeout, podStarted)
+}
+
+// podStarted is the waitForPod check for a pod whose output is streamed. A
+// command that already exited counts, even while a sidecar keeps the pod
+// Running.
+func podStarted(pod *v1.Pod) (bool, error) {
+	switch pod.Status.Phase {
+	case v1.PodRunning:
+		return containerStarted(pod) || containerExited(pod), nil
+	case v1.PodSucceeded, v1.PodFailed:
+		return true, nil
+	}
+	return false, startupError(pod)
+}
+
+func waitForPodStartedCmd(clientset *kubernetes.Clientset, namespace, podName string, timeout time.Duration) tea.Cmd {
+	return podWaitCmd(clientset, namespace, podName, "started", timeout, podStarted, podStartedMsg{podName: podName})
+}
+
+// containerExitCode waits for the pod's first container to terminate and
+// returns its exit code.
+func containerExitCode(clientset *kubernetes.Clientset, namespace, podName string) (int, error) {
+	exitCode := 0
+	err := waitForPod(clientset, namespace, podName, "finished", time.Minute, func(pod *v1.Pod) (bool, error) {
+		if len(pod.Spec.Containers) == 0 {
+			return true, nil
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Name == pod.Spec.Containers[0].Name && status.State.Terminated != nil {
+				exitCode = int(status.State.Terminated.ExitCode)
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	return exitCode, err
+}
+
+// runToCompletion runs stream, which follows the clone's command, until the
+// command exits, collects the --collect paths, then deletes the clone
+// unless --keep is set and returns the command's exit code. With
+// --keepalive, stream execs the command and its error carries the exit
+// code. ctrl-c and ctrl-\ are forwarded to the command; a second ctrl-c, or
+// SIGTERM, stops the run early, still removing the clone.
+func runToCompletion(clientset *kubernetes.Clientset, config *rest.Config, namespace, podName, container string, params *kmimeParams, stream func(context.Context) error) int {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGQUIT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	var interrupted atomic.Bool
+	go func() {
+		interrupts := 0
+		for {
+			select {
+			case sig := <-signals:
+				if sig == os.Interrupt {
+					interrupts++
+				}
+				if sig == syscall.SIGTERM || interrupts > 1 {
+					interrupted.Store(true)
+					cancel()
+					return
+				}
+				if sig == os.Interrupt {
+					fmt.Fprintln(os.Stderr, "Interrupting the command, press ctrl-c again to stop waiting and remove the clone.")
+				}
+				if err := signalRemote(clientset, config, namespace, podName, container, sig, params.keepalive); err != nil {
+					log.Printf("Warning: %v", err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	exitCode := 0
+	err := stream(ctx)
+	cancel()
+	switch {
+	case interrupted.Load():
+		fmt.Fprintln(os.Stderr, "Interrupted.")
+		exitCode = 130
+	case params.keepalive:
+		var exitErr utilexec.CodeExitError
+		if errors.As(err, &exitErr) {
+			exitCode = exitErr.Code
+		} else if err != nil {
+			log.Printf("Warning: %v", err)
+			exitCode = 1
+		}
+	case err != nil:
+		log.Printf("Warning: %v", err)
+		fallthrough
+	default:
+		exitCode, err = containerExitCode(clientset, namespace, podName)
+		if err != nil {
+			log.Printf("Warning: could not read the exit code: %v", err)
+			exitCode = 1
+		}
+	}
+
+	for _, warning := range collectArtifacts(clientset, config, namespace, podName, container, params.collect) {
+		log.Printf("Warning: %s", warning)
+	}
+	if params.keep {
+		releaseLease(clientset, namespace, podName)
+		fmt.Fprintln(os.Stderr, keptMessage(namespace, podName))
+		return exitCode
+	}
+	if err := deleteClone(clientset, namespace, podName, params); err != nil {
+		log.Printf("Warning: failed to clean up pod '%s': %v", podName, err)
+	}
+	return exitCode
+}
+
+// attachPiped attaches the local stdin, stdout and stderr to the clone's
+// first container without a terminal, for piped input. The container closes
+// its stdin when ours reaches EOF.
+func attachPiped(ctx context.Context, clientset *kubernetes.Clientset, config *rest.Config, namespace, podName string) error {
+	req := clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(podName).
+		Namespace(namespace).
+		SubResource("attach")
+	req.VersionedParams(&v1.PodAttachOptions{
+		Stdin:  true,
+		Stdout: true,
+		Stderr: true,
+	}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(config, http.MethodPost, req.URL())
+	if err != nil {
+		return fmt.Errorf("failed to create SPDY executor: %w", err)
+	}
+	return exec.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	})
+}
+
+// execPiped runs command in the container without a terminal, with the
+// local stdout and stderr and, if given, stdin.
+func execPiped(ctx context.Context, clientset *kubernetes.Clientset, config *rest.Config, namespace, podName, container string, command []string, stdin io.Reader) error {
+	req := clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(podName).
+		Namespace(namespace).
+		SubResource("exec")
+	req.VersionedParams(&v1.PodExecOptions{
+		Container: container,
+		Command:   command,
+		Stdin:     stdin != nil,
+		Stdout:    true,
+		Stderr:    true,
+	}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(config, http.MethodPost, req.URL())
+	if err != nil {
+		return fmt.Errorf("failed to create SPDY executor: %w", err)
+	}
+	return exec.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	})
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// controllerLabels are set by workload controllers on the pods they own and
+// would let those controllers adopt or count the clone.
+var controllerLabels = []string{
+	"pod-template-hash",
+	"pod-template-generation",
+	"controller-revision-hash",
+	"controller-uid",
+	"job-name",
+	"statefulset.kubernetes.io/pod-name",
+	"apps.kubernetes.io/pod-index",
+	"batch.kubernetes.io/controller-uid",
+	"batch.kubernetes.io/job-name",
+	"batch.kubernetes.io/job-completion-index",
+}
+
+// inheritedAnnotations are written by tooling, the kubelet, admission
+// plugins or the network plugin for one specific pod and are stale or
+// misleading on a clone, or make admission treat the clone as that pod, like
+// a fixed Calico address. Injection markers such as sidecar.istio.io/status
+// are kept: the injected containers are copied too, and the marker stops
+// the webhook from injecting them twice.
+var inheritedAnnotations = []string{
+	"kubectl.kubernetes.io/last-applied-configuration",
+	"kubectl.kubernetes.io/restartedAt",
+	"kubernetes.io/config.seen",
+	"kubernetes.io/config.source",
+	"kubernetes.io/limit-ranger",
+	"kubernetes.io/psp",
+	"openshift.io/scc",
+	"policies.kyverno.io/last-applied-patches",
+	"cni.projectcalico.org/containerID",
+	"cni.projectcalico.org/podIP",
+	"cni.projectcalico.org/podIPs",
+	"cni.projectcalico.org/ipAddrs",
+	"cni.projectcalico.org/ipAddrsNoIpam",
+	"k8s.v1.cni.cncf.io/network-status",
+	"k8s.v1.cni.cncf.io/networks-status",
+}
+
+// sanitizeMetadata strips controller labels and per-pod annotations copied
+// from the source, keeping anything the user set explicitly.
+func sanitizeMetadata(pod *v1.Pod, params *kmimeParams) {
+	for _, key := range controllerLabels {
+		if _, explicit := params.labels[key]; !explicit {
+			delete(pod.Labels, key)
+		}
+	}
+	for _, key := range inheritedAnnotations {
+		if _, explicit := params.annotations[key]; !explicit {
+			delete(pod.Annotations, key)
+		}
+	}
+}
+
+// sanitizeWarnings returns a warning for every label and annotation of the
+// source that sanitizeMetadata leaves off the clone.
+func sanitizeWarnings(source *v1.Pod, params *kmimeParams) []string {
+	var warnings []string
+	for _, key := range controllerLabels {
+		if _, explicit := params.labels[key]; !explicit {
+			if _, ok := source.Labels[key]; ok {
+				warnings = append(warnings, fmt.Sprintf("removed controller label %s inherited from the source pod", key))
+			}
+		}
+	}
+	for _, key := range inheritedAnnotations {
+		if _, explicit := params.annotations[key]; !explicit {
+			if _, ok := source.Annotations[key]; ok {
+				warnings = append(warnings, fmt.Sprintf("removed annotation %s inherited from the source pod", key))
+			}
+		}
+	}
+	return warnings
+}
+
+// sanitizeClone is the metadata check every path runs on the clone before
+// it is created or shown: it warns about what sanitizeMetadata removed from
+// source, which is nil when there is none, and strips the labels Services
+// and controllers select on. Failing to list the selectors is a warning, as
+// it is in the TUI: the clone is still created, with its labels unchecked.
+// --inherit-all skips all of it.
+func sanitizeClone(clientset *kubernetes.Clientset, source, pod *v1.Pod, params *kmimeParams) []string {
+	if params.inheritAll {
+		return nil
+	}
+	var warnings []string
+	if source != nil {
+		warnings = sanitizeWarnings(source, params)
+	}
+	selectorWarnings, err := stripSelectorLabels(clientset, pod, params.labels)
+	if err != nil {
+		return append(warnings, fmt.Sprintf("could not check selectors, the clone may receive Service traffic: %v", err))
+	}
+	return append(warnings, selectorWarnings...)
+}
+
+// stripSelectorLabels removes inherited labels that would make a Service
+// route traffic to the clone or a controller adopt it. It returns a warning
+// for every selector that matched.
+func stripSelectorLabels(clientset *kubernetes.Clientset, pod *v1.Pod, explicit map[string]string) ([]string, error) {
+	selectors, err := namespaceSelectors(clientset, pod.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []string
+	for _, owner := range sortedKeys(selectors) {
+		selector := selectors[owner]
+		if !selector.selector.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+
+		var removed []string
+		for _, key := range selector.keys {
+			if _, ok := explicit[key]; ok {
+				continue
+			}
+			if _, ok := pod.Labels[key]; ok {
+				delete(pod.Labels, key)
+				removed = append(removed, key)
+			}
+		}
+		if len(removed) > 0 {
+			warnings = append(warnings, fmt.Sprintf("removed labels %s so %s does not select the clone", strings.Join(removed, ", "), owner))
+		} else {
+			warnings = append(warnings, fmt.Sprintf("%s selects the clone through labels set with -l", owner))
+		}
+	}
+	return warnings, nil
+}
+
+type labelSelector struct {
+	selector labels.Selector
+	keys     []string
+}
+
+func namespaceSelectors(clientset *kubernetes.Clientset, namespace string) (map[string]labelSelector, error) {
+	ctx := context.TODO()
+	selectors := make(map[string]labelSelector)
+
+	services, err := clientset.CoreV1().Services(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services in namespace '%s': %w", namespace, err)
+	}
+	for _, svc := range services.Items {
+		if len(svc.Spec.Selector) == 0 {
+			continue
+		}
+		selectors["Service '"+svc.Name+"'"] = labelSelector{
+			selector: labels.SelectorFromSet(svc.Spec.Selector),
+			keys:     sortedKeys(svc.Spec.Selector),
+		}
+	}
+
+	addWorkload := func(kind, name string, s *metav1.LabelSelector) {
+		if s == nil {
+			return
+		}
+		selector, err := metav1.LabelSelectorAsSelector(s)
+		if err != nil || selector.Empty() {
+			return
+		}
+		keys := sortedKeys(s.MatchLabels)
+		for _, expr := range s.MatchExpressions {
+			keys = append(keys, expr.Key)
+		}
+		selectors[kind+" '"+name+"'"] = labelSelector{selector: selector, keys: keys}
+	}
+
+	replicaSets, err := clientset.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replicasets in namespace '%s': %w", namespace, err)
+	}
+	for _, rs := range replicaSets.Items {
+		addWorkload("ReplicaSet", rs.Name, rs.Spec.Selector)
+	}
+
+	statefulSets, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list statefulsets in namespace '%s': %w", namespace, err)
+	}
+	for _, sts := range statefulSets.Items {
+		addWorkload("StatefulSet", sts.Name, sts.Spec.Selector)
+	}
+
+	daemonSets, err := clientset.AppsV1().DaemonSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list daemonsets in namespace '%s': %w", namespace, err)
+	}
+	for _, ds := range daemonSets.Items {
+		addWorkload("DaemonSet", ds.Name, ds.Spec.Selector)
+	}
+
+	return selectors, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
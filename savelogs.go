@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// defaultLogsDir is where --save-logs writes without a directory.
+const defaultLogsDir = "kmime-logs"
+
+// savedLogPath is the timestamped file a clone's logs are saved to.
+func savedLogPath(dir, podName string, now time.Time) string {
+	return filepath.Join(dir, fmt.Sprintf("%s-%s.log", podName, now.UTC().Format("20060102T150405Z")))
+}
+
+// saveLogs writes the logs of every container of the pod to path, each
+// under a header when there are several.
+func saveLogs(clientset *kubernetes.Clientset, namespace, podName, path string) error {
+	pod, err := getPod(clientset, namespace, podName)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("could not create logs directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("could not create log file: %w", err)
+	}
+	defer file.Close()
+
+	containers := append(append([]v1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, container := range containers {
+		if len(containers) > 1 {
+			fmt.Fprintf(file, "==> container %s <==\n", container.Name)
+		}
+		stream, err := clientset.CoreV1().Pods(namespace).GetLogs(podName, &v1.PodLogOptions{Container: container.Name}).Stream(context.TODO())
+		if err != nil {
+			fmt.Fprintf(file, "(could not read logs: %v)\n", err)
+			continue
+		}
+		_, err = io.Copy(file, stream)
+		stream.Close()
+		if err != nil {
+			return fmt.Errorf("could not write log file: %w", err)
+		}
+	}
+	return nil
+}
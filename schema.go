@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+)
+
+const podSchemaName = "io.k8s.api.core.v1.Pod"
+
+// errSchemaUnavailable is returned when no schema could be loaded, in which
+// case validation is skipped rather than blocking the session.
+var errSchemaUnavailable = errors.New("OpenAPI schema unavailable")
+
+// podSchema holds the core/v1 component schemas of an OpenAPI v3 document.
+type podSchema struct {
+	schemas map[string]*spec.Schema
+}
+
+// loadPodSchema reads the core/v1 OpenAPI v3 document from schemaFile or,
+// without one, from the cluster. The cluster's document is cached per server
+// version, so later runs against the same version validate offline.
+func loadPodSchema(clientset *kubernetes.Clientset, schemaFile string) (*podSchema, error) {
+	var data []byte
+	var err error
+	if schemaFile != "" {
+		data, err = os.ReadFile(schemaFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read schema file: %w", err)
+		}
+	} else {
+		data, err = clusterPodSchema(clientset)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errSchemaUnavailable, err)
+		}
+	}
+
+	var doc struct {
+		Components struct {
+			Schemas map[string]*spec.Schema `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI v3 document: %w", err)
+	}
+	if doc.Components.Schemas[podSchemaName] == nil {
+		return nil, fmt.Errorf("OpenAPI document has no %s schema", podSchemaName)
+	}
+	return &podSchema{schemas: doc.Components.Schemas}, nil
+}
+
+func clusterPodSchema(clientset *kubernetes.Clientset) ([]byte, error) {
+	version, err := clientset.Discovery().ServerVersion()
+	if err != nil {
+		return nil, err
+	}
+	cacheFile := ""
+	if cacheDir, err := os.UserCacheDir(); err == nil {
+		name := strings.NewReplacer("/", "_", "+", "_").Replace(version.GitVersion)
+		cacheFile = filepath.Join(cacheDir, "kmime", "openapi", name, "api-v1.json")
+		if data, err := os.ReadFile(cacheFile); err == nil {
+			return data, nil
+		}
+	}
+
+	paths, err := clientset.Discovery().OpenAPIV3().Paths()
+	if err != nil {
+		return nil, err
+	}
+	groupVersion, ok := paths["api/v1"]
+	if !ok {
+		return nil, fmt.Errorf("the server does not publish an OpenAPI v3 schema for api/v1")
+	}
+	data, err := groupVersion.Schema("application/json")
+	if err != nil {
+		return nil, err
+	}
+	if cacheFile != "" {
+		if err := os.MkdirAll(filepath.Dir(cacheFile), 0755); err == nil {
+			os.WriteFile(cacheFile, data, 0644)
+		}
+	}
+	return data, nil
+}
+
+// validate checks the pod against the schema: unknown fields, types,
+// required fields and enum values. It returns every violation found.
+func (s *podSchema) validate(pod *v1.Pod) error {
+	withoutStatus := pod.DeepCopy()
+	withoutStatus.APIVersion = "v1"
+	withoutStatus.Kind = "Pod"
+	withoutStatus.Status = v1.PodStatus{}
+	data, err := json.Marshal(withoutStatus)
+	if err != nil {
+		return err
+	}
+	var value map[string]any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	delete(value, "status")
+
+	var problems []string
+	s.walk("", value, s.schemas[podSchemaName], &problems)
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("pod does not match the cluster's schema:\n  %s", strings.Join(problems, "\n  "))
+}
+
+// checkSchema validates the pod against the cluster's schema unless
+// validation is disabled. When no schema can be loaded, validation is
+// skipped and the reason returned as a warning.
+func checkSchema(clientset *kubernetes.Clientset, pod *v1.Pod, params *kmimeParams) (string, error) {
+	if params.noValidate {
+		return "", nil
+	}
+	schema, err := loadPodSchema(clientset, params.schemaFile)
+	if errors.Is(err, errSchemaUnavailable) {
+		return fmt.Sprintf("schema validation skipped: %v", err), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return "", schema.validate(pod)
+}
+
+// resolve follows $ref and the single-element allOf wrappers Kubernetes
+// uses to attach defaults to a reference.
+func (s *podSchema) resolve(schema *spec.Schema) *spec.Schema {
+	for schema != nil {
+		if ref := schema.Ref.String(); ref != "" {
+			schema = s.schemas[strings.TrimPrefix(ref, "#/components/schemas/")]
+			continue
+		}
+		if len(schema.AllOf) == 1 && len(schema.Properties) == 0 && len(schema.Type) == 0 {
+			schema = &schema.AllOf[0]
+			continue
+		}
+		return schema
+	}
+	return nil
+}
+
+func (s *podSchema) walk(path string, value any, schema *spec.Schema, problems *[]string) {
+	schema = s.resolve(schema)
+	if schema == nil || value == nil {
+		return
+	}
+	field := strings.TrimPrefix(path, ".")
+	if intOrString, _ := schema.Extensions.GetBool("x-kubernetes-int-or-string"); intOrString {
+		return
+	}
+	if len(schema.Type) > 0 && !matchesType(value, schema.Type) {
+		*problems = append(*problems, fmt.Sprintf("%s: expected %s", field, strings.Join(schema.Type, " or ")))
+		return
+	}
+	if len(schema.Enum) > 0 && !inEnum(value, schema.Enum) {
+		*problems = append(*problems, fmt.Sprintf("%s: unsupported value %v", field, value))
+	}
+
+	switch value := value.(type) {
+	case map[string]any:
+		for _, required := range schema.Required {
+			if _, ok := value[required]; !ok {
+				*problems = append(*problems, fmt.Sprintf("%s.%s: required field is missing", field, required))
+			}
+		}
+		preserveUnknown, _ := schema.Extensions.GetBool("x-kubernetes-preserve-unknown-fields")
+		for _, key := range sortedKeys(value) {
+			if prop, ok := schema.Properties[key]; ok {
+				s.walk(path+"."+key, value[key], &prop, problems)
+				continue
+			}
+			switch {
+			case schema.AdditionalProperties != nil && schema.AdditionalProperties.Schema != nil:
+				s.walk(path+"."+key, value[key], schema.AdditionalProperties.Schema, problems)
+			case schema.AdditionalProperties != nil && schema.AdditionalProperties.Allows,
+				preserveUnknown, len(schema.Properties) == 0:
+			default:
+				*problems = append(*problems, fmt.Sprintf("%s.%s: unknown field", field, key))
+			}
+		}
+	case []any:
+		if schema.Items == nil || schema.Items.Schema == nil {
+			return
+		}
+		for i, item := range value {
+			s.walk(fmt.Sprintf("%s[%d]", path, i), item, schema.Items.Schema, problems)
+		}
+	}
+}
+
+func matchesType(value any, types spec.StringOrArray) bool {
+	for _, t := range types {
+		switch v := value.(type) {
+		case map[string]any:
+			if t == "object" {
+				return true
+			}
+		case []any:
+			if t == "array" {
+				return true
+			}
+		case string:
+			if t == "string" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case float64:
+			if t == "number" || t == "integer" && v == float64(int64(v)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func inEnum(value any, enum []any) bool {
+	for _, allowed := range enum {
+		if fmt.Sprint(allowed) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
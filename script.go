@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	scriptVolumeName = "kmime-script"
+	scriptMountPath  = "/kmime/script"
+)
+
+// localScript is a --script file, shipped into the clone in a ConfigMap.
+type localScript struct {
+	name string
+	data []byte
+	// path is the absolute path the script was read from, for the
+	// history; empty when it came from a preview file.
+	path string
+}
+
+func readScript(path string) (*localScript, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(path)
+	if len(validation.IsConfigMapKey(name)) > 0 {
+		name = "script"
+	}
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	return &localScript{name: name, data: data, path: absolute}, nil
+}
+
+// command runs the script with args: directly when it starts with a
+// shebang, which the kernel honours, or with sh otherwise.
+func (s *localScript) command(args []string) []string {
+	path := scriptMountPath + "/" + s.name
+	if bytes.HasPrefix(s.data, []byte("#!")) {
+		return append([]string{path}, args...)
+	}
+	return append([]string{"/bin/sh", path}, args...)
+}
+
+// scriptConfigMapName is the ConfigMap holding a clone's --script.
+func scriptConfigMapName(podName string) string {
+	return podName + "-script"
+}
+
+// addScriptVolume mounts the clone's script ConfigMap, executable, into the
+// first container. A script volume already in the pod, as in a --preview
+// file, is replaced, so it always points at the pod's current name.
+func addScriptVolume(pod *v1.Pod) {
+	stripVolumes(pod, []string{scriptVolumeName}, false)
+	mode := int32(0755)
+	pod.Spec.Volumes = append(pod.Spec.Volumes, v1.Volume{
+		Name: scriptVolumeName,
+		VolumeSource: v1.VolumeSource{
+			ConfigMap: &v1.ConfigMapVolumeSource{
+				LocalObjectReference: v1.LocalObjectReference{Name: scriptConfigMapName(pod.Name)},
+				DefaultMode:          &mode,
+			},
+		},
+	})
+	pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, v1.VolumeMount{
+		Name:      scriptVolumeName,
+		MountPath: scriptMountPath,
+		ReadOnly:  true,
+	})
+}
+
+// scriptConfigMap builds the ConfigMap the clone's script volume points at.
+func scriptConfigMap(pod *v1.Pod, script *localScript) *v1.ConfigMap {
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      scriptConfigMapName(pod.Name),
+			Namespace: pod.Namespace,
+			Labels:    auxiliaryLabels(pod),
+		},
+	}
+	if utf8.Valid(script.data) {
+		cm.Data = map[string]string{script.name: string(script.data)}
+	} else {
+		cm.BinaryData = map[string][]byte{script.name: script.data}
+	}
+	return cm
+}
+
+func createConfigMap(clientset *kubernetes.Clientset, cm *v1.ConfigMap) (*v1.ConfigMap, error) {
+	created, err := clientset.CoreV1().ConfigMaps(cm.Namespace).Create(context.TODO(), cm, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create configmap '%s': %w", cm.Name, err)
+	}
+	return created, nil
+}
+
+// adoptConfigMap makes the clone own the ConfigMap so it is garbage
+// collected with it.
+func adoptConfigMap(clientset *kubernetes.Clientset, cm *v1.ConfigMap, owner metav1.OwnerReference) error {
+	cm.OwnerReferences = []metav1.OwnerReference{owner}
+	_, err := clientset.CoreV1().ConfigMaps(cm.Namespace).Update(context.TODO(), cm, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to set owner of configmap '%s': %w", cm.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// secretProvider resolves an external secret reference, without its scheme
+// prefix, to the secret's value.
+type secretProvider func(ctx context.Context, ref string) (string, error)
+
+// secretProviders maps a reference prefix to its provider. The built-in
+// providers shell out to the vendor CLIs, so they use whatever credentials
+// those are logged in with.
+var secretProviders = map[string]secretProvider{
+	"vault:": resolveVaultSecret,
+	"awssm:": resolveAWSSecret,
+	"sm://":  resolveGCPSecret,
+	"gcpsm:": resolveGCPSecret,
+}
+
+// registerCommandProviders adds the providers defined in the config. Each
+// command runs through sh with the reference in $KMIME_SECRET_REF and must
+// print the value on stdout.
+func registerCommandProviders(commands map[string]string) {
+	for scheme, command := range commands {
+		secretProviders[scheme+":"] = func(ctx context.Context, ref string) (string, error) {
+			cmd := exec.CommandContext(ctx, "sh", "-c", command)
+			cmd.Env = append(cmd.Environ(), "KMIME_SECRET_REF="+ref)
+			return runSecretCommand(cmd)
+		}
+	}
+}
+
+// secretRef is an env var whose value is fetched from an external store
+// when the clone is created.
+type secretRef struct {
+	name     string
+	ref      string
+	provider secretProvider
+}
+
+// extractSecretRefs splits env vars whose values reference an external
+// secret from the plain ones.
+func extractSecretRefs(envs []v1.EnvVar) ([]v1.EnvVar, []secretRef) {
+	var plain []v1.EnvVar
+	var refs []secretRef
+	for _, env := range envs {
+		if provider, ref, ok := lookupSecretProvider(env.Value); ok {
+			refs = append(refs, secretRef{name: env.Name, ref: ref, provider: provider})
+			continue
+		}
+		plain = append(plain, env)
+	}
+	return plain, refs
+}
+
+func lookupSecretProvider(value string) (secretProvider, string, bool) {
+	for _, scheme := range sortedKeys(secretProviders) {
+		if ref, ok := strings.CutPrefix(value, scheme); ok && ref != "" {
+			return secretProviders[scheme], ref, true
+		}
+	}
+	return nil, "", false
+}
+
+// envSecretName is the Secret holding a clone's resolved secret refs.
+func envSecretName(podName string) string {
+	return podName + "-env"
+}
+
+// secretRefEnvVars points each reference at its key in the clone's Secret.
+func secretRefEnvVars(podName string, refs []secretRef) []v1.EnvVar {
+	var envs []v1.EnvVar
+	for _, r := range refs {
+		envs = append(envs, v1.EnvVar{
+			Name: r.name,
+			ValueFrom: &v1.EnvVarSource{
+				SecretKeyRef: &v1.SecretKeySelector{
+					LocalObjectReference: v1.LocalObjectReference{Name: envSecretName(podName)},
+					Key:                  r.name,
+				},
+			},
+		})
+	}
+	return envs
+}
+
+// envSecret builds the Secret the clone's env vars point at. Without
+// resolve, no provider is called and the values are masked, for previews.
+func envSecret(pod *v1.Pod, refs []secretRef, resolve bool) (*v1.Secret, error) {
+	data := make(map[string]string)
+	for _, r := range refs {
+		if !resolve {
+			data[r.name] = maskedValue
+			continue
+		}
+		value, err := r.provider(context.TODO(), r.ref)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve secret for %s: %w", r.name, err)
+		}
+		data[r.name] = value
+	}
+
+	return &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      envSecretName(pod.Name),
+			Namespace: pod.Namespace,
+			Labels:    auxiliaryLabels(pod),
+		},
+		Type:       v1.SecretTypeOpaque,
+		StringData: data,
+	}, nil
+}
+
+// createEnvSecret resolves the references and stores them in the Secret the
+// clone's env vars point at.
+func createEnvSecret(clientset *kubernetes.Clientset, pod *v1.Pod, refs []secretRef) (*v1.Secret, error) {
+	secret, err := envSecret(pod, refs, true)
+	if err != nil {
+		return nil, err
+	}
+	return createSecret(clientset, secret)
+}
+
+func createSecret(clientset *kubernetes.Clientset, secret *v1.Secret) (*v1.Secret, error) {
+	created, err := clientset.CoreV1().Secrets(secret.Namespace).Create(context.TODO(), secret, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create secret '%s': %w", secret.Name, err)
+	}
+	return created, nil
+}
+
+// adoptSecret makes the clone, a pod or a Job, own the secret so it is
+// garbage collected with it.
+func adoptSecret(clientset *kubernetes.Clientset, secret *v1.Secret, owner metav1.OwnerReference) error {
+	secret.OwnerReferences = []metav1.OwnerReference{owner}
+	_, err := clientset.CoreV1().Secrets(secret.Namespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to set owner of secret '%s': %w", secret.Name, err)
+	}
+	return nil
+}
+
+// podOwnerReference makes an object garbage collected with the pod.
+func podOwnerReference(pod *v1.Pod) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Name:       pod.Name,
+		UID:        pod.UID,
+	}
+}
+
+// resolveVaultSecret reads path#field from a KV engine. A "data" segment
+// after the mount, as in the KV v2 API path, is accepted and dropped.
+func resolveVaultSecret(ctx context.Context, ref string) (string, error) {
+	path, field, ok := strings.Cut(ref, "#")
+	if !ok || field == "" {
+		return "", fmt.Errorf("invalid vault reference %s, expected vault:<path>#<field>", ref)
+	}
+	if mount, rest, found := strings.Cut(path, "/"); found {
+		if after, isV2 := strings.CutPrefix(rest, "data/"); isV2 {
+			path = mount + "/" + after
+		}
+	}
+	return runSecretCommand(exec.CommandContext(ctx, "vault", "kv", "get", "-field="+field, path))
+}
+
+// resolveAWSSecret reads <secret-id>[#json-key] from AWS Secrets Manager.
+func resolveAWSSecret(ctx context.Context, ref string) (string, error) {
+	id, key, _ := strings.Cut(ref, "#")
+	value, err := runSecretCommand(exec.CommandContext(ctx, "aws", "secretsmanager", "get-secret-value",
+		"--secret-id", id, "--query", "SecretString", "--output", "text"))
+	if err != nil || key == "" {
+		return value, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return "", fmt.Errorf("secret %s is not a JSON object: %w", id, err)
+	}
+	field, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no key %s", id, key)
+	}
+	return fmt.Sprint(field), nil
+}
+
+// resolveGCPSecret reads projects/<p>/secrets/<s>[/versions/<v>] from GCP
+// Secret Manager.
+func resolveGCPSecret(ctx context.Context, ref string) (string, error) {
+	parts := strings.Split(strings.TrimPrefix(ref, "//"), "/")
+	if len(parts) != 4 && len(parts) != 6 || parts[0] != "projects" || parts[2] != "secrets" {
+		return "", fmt.Errorf("invalid GCP secret reference %s, expected projects/<project>/secrets/<secret>[/versions/<version>]", ref)
+	}
+	version := "latest"
+	if len(parts) == 6 {
+		version = parts[5]
+	}
+	return runSecretCommand(exec.CommandContext(ctx, "gcloud", "secrets", "versions", "access", version,
+		"--secret="+parts[3], "--project="+parts[1]))
+}
+
+func runSecretCommand(cmd *exec.Cmd) (string, error) {
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %w: %s", cmd.Args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(string(out), "\n"), nil
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+type createSessionRequest struct {
+	SourcePod          string            `json:"sourcePod"`
+	Namespace          string            `json:"namespace"`
+	Command            []string          `json:"command,omitempty"`
+	Prefix             string            `json:"prefix,omitempty"`
+	Suffix             string            `json:"suffix,omitempty"`
+	Labels             map[string]string `json:"labels,omitempty"`
+	Annotations        map[string]string `json:"annotations,omitempty"`
+	Env                map[string]string `json:"env,omitempty"`
+	SkipIdentification bool              `json:"skipIdentification,omitempty"`
+}
+
+type serveSession struct {
+	Name      string    `json:"name"`
+	Namespace string    `json:"namespace"`
+	SourcePod string    `json:"sourcePod"`
+	User      string    `json:"user,omitempty"`
+	Command   []string  `json:"command"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type resizeMessage struct {
+	Width  uint16 `json:"width"`
+	Height uint16 `json:"height"`
+}
+
+type sessionServer struct {
+	clientset *kubernetes.Clientset
+	config    *rest.Config
+	cfg       *kmimeConfig
+	history   *historyStore
+	// token is the bearer token every request must carry.
+	token string
+	// listen is the address the server listens on, the one Host header
+	// besides loopback names that requests may carry.
+	listen string
+
+	mu       sync.Mutex
+	sessions map[string]*serveSession
+}
+
+// upgrader keeps gorilla's default same-origin check so that arbitrary web
+// pages open in a browser cannot drive the local API.
+var upgrader = websocket.Upgrader{}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Runs a local API server to create, list, attach to and delete kmime sessions.",
+	Long: `serve exposes kmime's clone/attach pipeline over a small HTTP API so editor
+plugins and internal portals can drive it without shelling out to the TUI.
+
+Endpoints:
+  POST   /sessions                         create a clone and wait for it to run
+  GET    /sessions                         list sessions created by this server
+  GET    /sessions/{namespace}/{name}/attach attach via websocket
+  DELETE /sessions/{namespace}/{name}      delete a session's pod
+
+Every request needs an "Authorization: Bearer <token>" header. The token is
+--token, or $KMIME_SERVE_TOKEN, or else a random one generated and printed at
+startup. Requests must also be addressed to a loopback name or the exact
+--listen address, come from the server's own origin when sent by a browser,
+and send POST bodies as application/json, so web pages cannot drive the API,
+not even through DNS rebinding.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		listen, _ := cmd.Flags().GetString("listen")
+		token, _ := cmd.Flags().GetString("token")
+		if token == "" {
+			token = os.Getenv(serveTokenEnvVar)
+		}
+		generated := token == ""
+		if generated {
+			var err error
+			token, err = generateServeToken()
+			if err != nil {
+				log.Fatalf("Could not generate an API token: %v", err)
+			}
+		}
+		cfg, history := loadCommandConfig(cmd)
+
+		clientset, config, err := getKubeConfig()
+		if err != nil {
+			log.Fatalf("Could not get Kubernetes config: %v", err)
+		}
+
+		server := &sessionServer{
+			clientset: clientset,
+			config:    config,
+			cfg:       cfg,
+			history:   history,
+			token:     token,
+			listen:    listen,
+			sessions:  make(map[string]*serveSession),
+		}
+
+		fmt.Printf("kmime API listening on http://%s\n", listen)
+		if generated {
+			fmt.Printf("API token (send as \"Authorization: Bearer <token>\"): %s\n", token)
+		}
+		if err := http.ListenAndServe(listen, server.routes()); err != nil {
+			log.Fatalf("API server stopped: %v", err)
+		}
+	},
+}
+
+func (s *sessionServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /sessions", s.handleCreate)
+	mux.HandleFunc("GET /sessions", s.handleList)
+	mux.HandleFunc("GET /sessions/{namespace}/{name}/attach", s.handleAttach)
+	mux.HandleFunc("DELETE /sessions/{namespace}/{name}", s.handleDelete)
+	return s.guard(mux)
+}
+
+const serveTokenEnvVar = "KMIME_SERVE_TOKEN"
+
+// generateServeToken returns a random token for a server started without
+// one.
+func generateServeToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// guard rejects requests a web page could forge: those addressed to a
+// host other than loopback or the listen address, as a DNS rebinding page
+// would, those from another origin, and those without the token. Browsers
+// always send Origin on cross-origin POST and DELETE requests.
+func (s *sessionServer) guard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.allowedHost(r.Host) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("requests for host %q are not allowed", r.Host))
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			u, err := url.Parse(origin)
+			if err != nil || !strings.EqualFold(u.Host, r.Host) {
+				writeError(w, http.StatusForbidden, fmt.Errorf("cross-origin requests are not allowed"))
+				return
+			}
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid bearer token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// allowedHost reports whether a request's Host header is the listen
+// address or a loopback name, whatever the port.
+func (s *sessionServer) allowedHost(host string) bool {
+	if strings.EqualFold(host, s.listen) {
+		return true
+	}
+	name := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		name = h
+	}
+	name = strings.Trim(name, "[]")
+	if strings.EqualFold(name, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(name)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (s *sessionServer) handleCreate(w http.ResponseWriter, r *http.Request) {
+	// A form or text/plain body is what a cross-site form can send without
+	// a preflight.
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("request body must be application/json"))
+		return
+	}
+	var req createSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %w", err))
+		return
+	}
+	if req.SourcePod == "" || req.Namespace == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("sourcePod and namespace are required"))
+		return
+	}
+
+	params := newDefaultParams(s.cfg)
+	if len(req.Command) > 0 {
+		params.commandToRun = req.Command
+	}
+
+	var envs []v1.EnvVar
+	for name, value := range req.Env {
+		envs = append(envs, v1.EnvVar{Name: name, Value: value})
+	}
+
+	var user string
+	if !req.SkipIdentification {
+		var err error
+		user, err = getUserIdentifier()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	params.sourcePod = req.SourcePod
+	params.namespace = req.Namespace
+	params.prefix = req.Prefix
+	params.suffix = req.Suffix
+	params.labels = mergeStringMaps(params.labels, req.Labels)
+	params.annotations = mergeStringMaps(params.annotations, req.Annotations)
+	params.envs = envs
+	params.user = user
+	params.history = s.history
+
+	originalPod, err := getPod(s.clientset, params.namespace, params.sourcePod)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	newPod, err := clonePod(originalPod, params)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for _, warning := range sanitizeClone(s.clientset, originalPod, newPod, params) {
+		log.Printf("Warning: %s", warning)
+	}
+
+	tracker := &cleanupTracker{}
+	clone, err := createClone(s.clientset, newPod, params, tracker)
+	if err != nil {
+		tracker.cleanup(params)
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	createdPod := clone.pod
+	if err := s.history.append(newLogEntry(params, createdPod.Name)); err != nil {
+		log.Printf("Warning: could not write to log file: %v", err)
+	}
+
+	if err := waitForPodRunning(s.clientset, createdPod.Namespace, createdPod.Name, params.startupTimeout); err != nil {
+		if delErr := deletePod(s.clientset, createdPod.Namespace, createdPod.Name, nil); delErr != nil {
+			log.Printf("Warning: %v", delErr)
+		}
+		writeError(w, http.StatusGatewayTimeout, err)
+		return
+	}
+
+	session := &serveSession{
+		Name:      createdPod.Name,
+		Namespace: createdPod.Namespace,
+		SourcePod: params.sourcePod,
+		User:      user,
+		Command:   params.commandToRun,
+		CreatedAt: time.Now(),
+	}
+	s.mu.Lock()
+	s.sessions[sessionKey(session.Namespace, session.Name)] = session
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, session)
+}
+
+func (s *sessionServer) handleList(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	sessions := make([]*serveSession, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+func (s *sessionServer) handleDelete(w http.ResponseWriter, r *http.Request) {
+	namespace, name := r.PathValue("namespace"), r.PathValue("name")
+	if _, ok := s.lookup(namespace, name); !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("session %s/%s not found", namespace, name))
+		return
+	}
+
+	if err := deletePod(s.clientset, namespace, name, nil); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	s.mu.Lock()
+	delete(s.sessions, sessionKey(namespace, name))
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleAttach bridges a websocket to the pod's attach stream. Binary
+// messages are written to the remote stdin and text messages carry JSON
+// resize events; remote output is sent back as binary messages.
+func (s *sessionServer) handleAttach(w http.ResponseWriter, r *http.Request) {
+	namespace, name := r.PathValue("namespace"), r.PathValue("name")
+	if _, ok := s.lookup(namespace, name); !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("session %s/%s not found", namespace, name))
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("Warning: websocket upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	stdinReader, stdinWriter := io.Pipe()
+	resizeChan := make(chan remotecommand.TerminalSize, 1)
+	sizeQueue := &terminalSizeQueue{resizeChan: resizeChan}
+
+	go func() {
+		defer close(resizeChan)
+		defer stdinWriter.Close()
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			switch messageType {
+			case websocket.BinaryMessage:
+				if _, err := stdinWriter.Write(data); err != nil {
+					return
+				}
+			case websocket.TextMessage:
+				var resize resizeMessage
+				if err := json.Unmarshal(data, &resize); err == nil && resize.Width > 0 && resize.Height > 0 {
+					resizeChan <- remotecommand.TerminalSize{Width: resize.Width, Height: resize.Height}
+				}
+			}
+		}
+	}()
+
+	err = streamAttach(r.Context(), s.clientset, s.config, namespace, name, "", stdinReader, &websocketWriter{conn: conn}, sizeQueue)
+	if err != nil {
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, err.Error()))
+		return
+	}
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+}
+
+func (s *sessionServer) lookup(namespace, name string) (*serveSession, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[sessionKey(namespace, name)]
+	return session, ok
+}
+
+func sessionKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+type websocketWriter struct {
+	mu   sync.Mutex
+	conn *websocket.Conn
+}
+
+func (w *websocketWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.conn.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Warning: could not encode response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func init() {
+	serveCmd.Flags().String("listen", "127.0.0.1:7878", "Address for the API server to listen on")
+	serveCmd.Flags().String("token", "", "Bearer token every request must carry (defaults to $"+serveTokenEnvVar+", or a random token printed at startup)")
+}
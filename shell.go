@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+var defaultShellFallback = []string{"bash", "sh", "ash"}
+
+// noShellExitCode is what the shell wrapper exits with when none of the
+// candidates exist; it matches the conventional "command not found" code.
+const noShellExitCode = 127
+
+// shellPath is the shell that runs the fallback probe of shellCommand.
+const shellPath = "/bin/sh"
+
+// noShellMessage starts what the shell wrapper prints when it finds none of
+// the candidates, and tells its command apart from the user's.
+const noShellMessage = "kmime: no shell found"
+
+// startFailureReasons are the container reasons the runtimes give when the
+// command could not be executed at all.
+var startFailureReasons = map[string]bool{
+	"StartError":           true,
+	"CreateContainerError": true,
+	"RunContainerError":    true,
+}
+
+// shellCommand builds the default command used when none is given. It
+// probes the fallback chain with /bin/sh inside the container and execs the
+// first shell found, so images whose sh is not the shell you want, such as
+// alpine, work without extra flags. Images without /bin/sh, such as
+// distroless ones, cannot run it; missingShellError reports them.
+func shellCommand(chain []string) []string {
+	if len(chain) == 0 {
+		chain = defaultShellFallback
+	}
+	script := fmt.Sprintf(
+		`for s in %s; do if command -v "$s" >/dev/null 2>&1; then exec "$s"; fi; done; echo "%s (tried: %s)" >&2; exit %d`,
+		strings.Join(chain, " "), noShellMessage, strings.Join(chain, ", "), noShellExitCode,
+	)
+	return []string{shellPath, "-c", script}
+}
+
+// isShellCommand reports whether command is one built by shellCommand.
+func isShellCommand(command []string) bool {
+	return len(command) == 3 && command[0] == shellPath && strings.Contains(command[2], noShellMessage)
+}
+
+// missingShellError explains a container that could not start or exited
+// because the image has no usable shell, or returns nil otherwise. Only the
+// runtime failing to execute a shell, or the shell wrapper exiting with
+// noShellExitCode, count: other start failures and exit codes of the
+// user's own commands are left to the caller.
+func missingShellError(pod *v1.Pod) error {
+	commands := map[string][]string{}
+	for _, c := range pod.Spec.Containers {
+		commands[c.Name] = c.Command
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		command := commands[status.Name]
+		if len(command) == 0 {
+			continue
+		}
+		var reason, message string
+		switch {
+		case status.State.Terminated != nil:
+			if status.State.Terminated.ExitCode == noShellExitCode && isShellCommand(command) {
+				return noShellError(pod, status)
+			}
+			reason, message = status.State.Terminated.Reason, status.State.Terminated.Message
+		case status.State.Waiting != nil:
+			reason, message = status.State.Waiting.Reason, status.State.Waiting.Message
+		default:
+			continue
+		}
+		if startFailureReasons[reason] && isShellPath(command[0]) && execNotFound(message, command[0]) {
+			return noShellError(pod, status)
+		}
+	}
+	return nil
+}
+
+// noShellError is the error missingShellError returns for the container.
+func noShellError(pod *v1.Pod, status v1.ContainerStatus) error {
+	if pod.Annotations[keepaliveAnnotation] == "true" && len(pod.Spec.Containers) > 0 && pod.Spec.Containers[0].Name == status.Name {
+		return fmt.Errorf("container '%s' has no %s to idle on (image %s); --keepalive, and --collect and --tmux which use it, need a shell in the image, run without them or use --debug-sidecar or kmime debug to bring your own tools", status.Name, shellPath, status.Image)
+	}
+	return fmt.Errorf("container '%s' has no usable shell (image %s); pass a command explicitly, or use --debug-sidecar or kmime debug to bring your own tools", status.Name, status.Image)
+}
+
+// isShellPath reports whether executable names a shell kmime may run.
+func isShellPath(executable string) bool {
+	name := executable[strings.LastIndex(executable, "/")+1:]
+	return name == "sh" || slices.Contains(defaultShellFallback, name)
+}
+
+// execNotFound reports whether a start failure message says executable
+// itself could not be found, as opposed to, say, a missing mount source.
+func execNotFound(message, executable string) bool {
+	if !strings.Contains(message, executable) {
+		return false
+	}
+	return strings.Contains(message, "executable file not found") ||
+		strings.Contains(message, fmt.Sprintf("stat %s: no such file or directory", executable)) ||
+		strings.Contains(message, fmt.Sprintf("exec: %q: no such file or directory", executable))
+}
+
+// keepaliveAnnotation marks a clone whose first container idles while its
+// sessions are exec'd into it.
+const keepaliveAnnotation = "kmime-keepalive"
+
+// keepaliveCommand idles until the pod is deleted, on sleep infinity or,
+// where sleep does not support it, a loop of long sleeps. Images without
+// /bin/sh cannot run it, which missingShellError reports.
+var keepaliveCommand = []string{shellPath, "-c", "trap 'exit 0' TERM INT; sleep infinity & wait $!; while :; do sleep 3600 & wait $!; done"}
+
+// tmuxAnnotation marks a clone whose sessions run inside tmux, so attaching
+// again resumes the same tmux session.
+const tmuxAnnotation = "kmime-tmux"
+
+// tmuxSessionName is the tmux session --tmux creates and reattaches to.
+const tmuxSessionName = "kmime"
+
+// tmuxCommand runs command in the clone's tmux session, attaching to the
+// session if it already exists. Images without tmux run the command as is.
+func tmuxCommand(command []string) []string {
+	script := fmt.Sprintf(
+		`if command -v tmux >/dev/null 2>&1; then exec tmux new-session -A -s %s -- "$@"; fi; echo "kmime: tmux not found, running without it" >&2; exec "$@"`,
+		tmuxSessionName,
+	)
+	return append([]string{shellPath, "-c", script, "kmime"}, command...)
+}
+
+// isTmuxCommand reports whether command is one built by tmuxCommand.
+func isTmuxCommand(command []string) bool {
+	return len(command) >= 4 && command[0] == shellPath && command[3] == "kmime" && strings.Contains(command[2], "tmux new-session -A -s "+tmuxSessionName)
+}
+
+// sessionEnded reports whether an attach or exec stream ended because the
+// command exited, as opposed to the connection failing.
+func sessionEnded(err error) bool {
+	var exitErr utilexec.CodeExitError
+	return err == nil || strings.Contains(err.Error(), "exit status") || errors.As(err, &exitErr)
+}
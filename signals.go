@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// forwardedSignals are relayed to the clone's command when it runs without
+// a terminal. With one, the keys reach the remote terminal instead, which
+// raises the signals itself.
+var forwardedSignals = map[os.Signal]string{
+	os.Interrupt:    "INT",
+	syscall.SIGQUIT: "QUIT",
+}
+
+// signalRemote sends sig to the container's main process. Like any PID 1,
+// it only reacts to the signals it installed a handler for. With keepalive
+// the command was exec'd next to the idle PID 1 instead, so every process
+// but PID 1 gets the signal. Forwarding is best effort: it needs a kill
+// binary or a shell in the image, and does nothing when the pod shares its
+// process namespace, where PID 1 is the pause process and the command's PID
+// is unknown.
+func signalRemote(clientset *kubernetes.Clientset, config *rest.Config, namespace, podName, container string, sig os.Signal, keepalive bool) error {
+	name := forwardedSignals[sig]
+	pod, err := clientset.CoreV1().Pods(namespace).Get(context.TODO(), podName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("could not send SIG%s to the command: %w", name, err)
+	}
+	if pod.Spec.ShareProcessNamespace != nil && *pod.Spec.ShareProcessNamespace {
+		return fmt.Errorf("SIG%s was not forwarded: the pod shares its process namespace, so PID 1 is not the command", name)
+	}
+	target := "1"
+	if keepalive {
+		target = "-1"
+	}
+	// The kill binary works without a shell; the shell's builtin covers
+	// images that only have that.
+	var stderr strings.Builder
+	err = execInPod(clientset, config, namespace, podName, container, []string{"kill", "-s", name, "--", target}, nil, io.Discard, &stderr)
+	if err == nil {
+		return nil
+	}
+	stderr.Reset()
+	command := []string{"sh", "-c", `kill -s "$1" -- "$2"`, "sh", name, target}
+	if err := execInPod(clientset, config, namespace, podName, container, command, nil, io.Discard, &stderr); err != nil {
+		return fmt.Errorf("could not send SIG%s to the command, the image needs kill or sh: %w: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
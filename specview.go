@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	yamlKeyStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("69"))
+	yamlStringStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("10"))
+	yamlLiteralStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("13"))
+	yamlPunctStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+)
+
+// defaultSpecViewerHeight is used until the terminal reports its size.
+const defaultSpecViewerHeight = 20
+
+// yamlLine splits a YAML line into indentation, list marker, key and value.
+var yamlLine = regexp.MustCompile(`^(\s*)(- )?(?:([^\s'"#-][^:]*|"[^"]*"|'[^']*'):(?: |$))?(.*)$`)
+
+// specViewer is a scrollable, highlighted view of the generated pod YAML.
+type specViewer struct {
+	lines  []string
+	offset int
+	height int
+}
+
+func newSpecViewer(yaml []byte, height int) *specViewer {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(string(yaml), "\n"), "\n") {
+		lines = append(lines, highlightYAMLLine(line))
+	}
+	v := &specViewer{lines: lines}
+	v.setHeight(height)
+	return v
+}
+
+// setHeight fits the view to the terminal, leaving room for the title and
+// help lines.
+func (v *specViewer) setHeight(terminalHeight int) {
+	v.height = defaultSpecViewerHeight
+	if terminalHeight > 0 {
+		v.height = max(terminalHeight-5, 1)
+	}
+	v.scroll(0)
+}
+
+func (v *specViewer) scroll(delta int) {
+	v.offset = min(max(v.offset+delta, 0), max(len(v.lines)-v.height, 0))
+}
+
+// update handles a key press and reports whether the viewer was closed.
+func (v *specViewer) update(msg tea.KeyMsg) (closed bool) {
+	switch msg.String() {
+	case "up", "k":
+		v.scroll(-1)
+	case "down", "j":
+		v.scroll(1)
+	case "pgup", "b":
+		v.scroll(-v.height)
+	case "pgdown", "f", " ":
+		v.scroll(v.height)
+	case "home", "g":
+		v.scroll(-len(v.lines))
+	case "end", "G":
+		v.scroll(len(v.lines))
+	case "q", "esc", "s":
+		return true
+	}
+	return false
+}
+
+func (v *specViewer) view() string {
+	var b strings.Builder
+	end := min(v.offset+v.height, len(v.lines))
+	b.WriteString(fmt.Sprintf("\n Generated pod spec (lines %d-%d of %d)\n\n", v.offset+1, end, len(v.lines)))
+	for _, line := range v.lines[v.offset:end] {
+		b.WriteString(" " + line + "\n")
+	}
+	b.WriteString(helpStyle.Render("\n ↑/↓ scroll • pgup/pgdn page • g/G top/bottom • q close") + "\n")
+	return b.String()
+}
+
+// highlightYAMLLine colors the keys and values of a line of the YAML
+// produced by podYAML. It is not a general YAML highlighter: block scalars
+// and flow collections spanning lines are shown as plain values.
+func highlightYAMLLine(line string) string {
+	if strings.HasPrefix(strings.TrimSpace(line), "#") {
+		return yamlPunctStyle.Render(line)
+	}
+	m := yamlLine.FindStringSubmatch(line)
+	if m == nil {
+		return line
+	}
+	indent, dash, key, value := m[1], m[2], m[3], m[4]
+
+	var b strings.Builder
+	b.WriteString(indent)
+	if dash != "" {
+		b.WriteString(yamlPunctStyle.Render(dash))
+	}
+	if key != "" {
+		b.WriteString(yamlKeyStyle.Render(key) + yamlPunctStyle.Render(":"))
+		if value != "" {
+			b.WriteString(" ")
+		}
+	}
+	b.WriteString(highlightYAMLValue(value))
+	return b.String()
+}
+
+func highlightYAMLValue(value string) string {
+	switch {
+	case value == "":
+		return ""
+	case strings.HasPrefix(value, `"`), strings.HasPrefix(value, "'"):
+		return yamlStringStyle.Render(value)
+	case value == "true", value == "false", value == "null", value == "{}", value == "[]",
+		value == "|", value == "|-", value == ">", value == ">-":
+		return yamlLiteralStyle.Render(value)
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return yamlLiteralStyle.Render(value)
+	}
+	return value
+}
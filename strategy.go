@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	strategyFull       = "full"
+	strategyNoSidecars = "no-sidecars"
+	strategyMinimal    = "minimal"
+)
+
+var cloneStrategies = []string{strategyFull, strategyNoSidecars, strategyMinimal}
+
+func validateStrategy(strategy string) error {
+	for _, s := range cloneStrategies {
+		if s == strategy {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown strategy %q, expected one of: %s", strategy, strings.Join(cloneStrategies, ", "))
+}
+
+// applyStrategy trims the cloned spec down according to the strategy. The
+// target container is always the first one, so later steps can keep
+// addressing it as Containers[0].
+func applyStrategy(pod *v1.Pod, strategy string) {
+	if len(pod.Spec.Containers) == 0 {
+		return
+	}
+
+	switch strategy {
+	case strategyNoSidecars:
+		pod.Spec.Containers = pod.Spec.Containers[:1]
+	case strategyMinimal:
+		pod.Spec.Containers = pod.Spec.Containers[:1]
+		pod.Spec.InitContainers = nil
+
+		used := make(map[string]bool)
+		for _, m := range pod.Spec.Containers[0].VolumeMounts {
+			used[m.Name] = true
+		}
+		for _, d := range pod.Spec.Containers[0].VolumeDevices {
+			used[d.Name] = true
+		}
+		var volumes []v1.Volume
+		for _, vol := range pod.Spec.Volumes {
+			if used[vol.Name] {
+				volumes = append(volumes, vol)
+			}
+		}
+		pod.Spec.Volumes = volumes
+	}
+}
+
+var compareStrategiesCmd = &cobra.Command{
+	Use:   "compare-strategies [source-pod]",
+	Short: "Compares what each clone strategy would produce for a source pod.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		namespace, _ := cmd.Flags().GetString("namespace")
+		cfg, _ := loadCommandConfig(cmd)
+
+		clientset, _, err := getKubeConfig()
+		if err != nil {
+			log.Fatalf("Could not get Kubernetes config: %v", err)
+		}
+		originalPod, err := getPod(clientset, namespace, args[0])
+		if err != nil {
+			log.Fatalf("Could not get source pod: %v", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "STRATEGY\tCONTAINERS\tINIT CONTAINERS\tVOLUMES\tCPU REQUEST\tMEMORY REQUEST\tENV VARS")
+		for _, strategy := range cloneStrategies {
+			params := newDefaultParams(cfg)
+			params.sourcePod = args[0]
+			params.namespace = namespace
+			params.strategy = strategy
+			pod, err := clonePod(originalPod, params)
+			if err != nil {
+				log.Fatalf("Could not clone pod: %v", err)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%d\n",
+				strategy,
+				containerNames(pod.Spec.Containers),
+				containerNames(pod.Spec.InitContainers),
+				len(pod.Spec.Volumes),
+				totalRequest(pod, v1.ResourceCPU),
+				totalRequest(pod, v1.ResourceMemory),
+				len(pod.Spec.Containers[0].Env),
+			)
+		}
+		w.Flush()
+	},
+}
+
+func containerNames(containers []v1.Container) string {
+	if len(containers) == 0 {
+		return "-"
+	}
+	var names []string
+	for _, c := range containers {
+		names = append(names, c.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func totalRequest(pod *v1.Pod, name v1.ResourceName) string {
+	total := resource.Quantity{}
+	for _, c := range pod.Spec.Containers {
+		if q, ok := c.Resources.Requests[name]; ok {
+			total.Add(q)
+		}
+	}
+	if total.IsZero() {
+		return "-"
+	}
+	return total.String()
+}
+
+func init() {
+	compareStrategiesCmd.Flags().StringP("namespace", "n", "", "Namespace of the source pod (required)")
+	compareStrategiesCmd.MarkFlagRequired("namespace")
+}
@@ -1,15 +1,22 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/charmbracelet/bubbles/spinner"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	jsonpatch "gopkg.in/evanphx/json-patch.v4"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
@@ -19,6 +26,7 @@ var (
 	statusStyle  = lipgloss.NewStyle().MarginLeft(1)
 	errorStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
 	successStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("10"))
+	warningStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
 )
 
 type (
@@ -28,10 +36,29 @@ type (
 		clientset *kubernetes.Clientset
 		config    *rest.Config
 	}
-	podFetchedMsg   struct{}
-	podCreatedMsg   struct{ podName string }
+	podFetchedMsg struct{ pod *v1.Pod }
+	preflightMsg  struct {
+		warnings   []string
+		shortfalls []quotaShortfall
+	}
+	specEditedMsg struct {
+		path string
+		err  error
+	}
+	namespaceMovedMsg struct {
+		pod         *v1.Pod
+		adjustments []string
+		err         error
+	}
+	podCreatedMsg struct {
+		podName   string
+		namespace string
+	}
 	podRunningMsg   struct{ podName string }
+	podStartedMsg   struct{ podName string }
+	toolingMsg      struct{ warnings []string }
 	attachMsg       struct{}
+	sessionEndedMsg struct{ err error }
 	podAttachedMsg  struct{}
 	podCleanedUpMsg struct{ podName string }
 	finalSuccessMsg struct{ message string }
@@ -39,6 +66,8 @@ type (
 
 type model struct {
 	params *kmimeParams
+	// cleanup removes the clone if the TUI ends before the session does.
+	cleanup *cleanupTracker
 
 	spinner    spinner.Model
 	statusText string
@@ -47,8 +76,60 @@ type model struct {
 
 	clientset  *kubernetes.Clientset
 	config     *rest.Config
+	sourcePod  *v1.Pod
+	newPod     *v1.Pod
 	newPodName string
 	namespace  string
+	// jobName is the Job created with --as-job, whose pods replace
+	// newPodName one after the other.
+	jobName string
+
+	warnings    []string
+	quotaPrompt bool
+	shortfalls  []quotaShortfall
+	adjustments []string
+
+	envEditor *envEditor
+	envEdited bool
+
+	// editRequested is set by ctrl+e in a prompt; specEdited once the
+	// YAML was edited.
+	editRequested bool
+	specEdited    bool
+
+	confirmPrompt bool
+	specViewer    *specViewer
+	height        int
+
+	// sessionPrompt, when set, asks what to do with a clone that is still
+	// running after the session ended.
+	sessionPrompt string
+
+	// podStatus and podEvent tell what the new pod is waiting on while it
+	// starts.
+	podStatus string
+	podEvent  string
+	// waitDeadline is when waiting for the new pod times out, for the
+	// countdown.
+	waitDeadline time.Time
+
+	// sessionStart is when the current session was attached, and
+	// reconnects how often it was reattached after its stream dropped.
+	sessionStart time.Time
+	reconnects   int
+	// sessionErr is reported once the clone is cleaned up after its
+	// session failed.
+	sessionErr error
+	// failurePrompt is the failure the user is asked to keep the clone
+	// for, and failureLogs the clone's log printed after the TUI exits.
+	failurePrompt error
+	failureLogs   string
+	// removing is set once the clone is being deleted.
+	removing bool
+	// collected is set once the --collect paths were downloaded.
+	collected bool
+	// portForwardStop ends the --port-forward listeners.
+	portForwardStop chan struct{}
 }
 
 type kmimeParams struct {
@@ -58,9 +139,133 @@ type kmimeParams struct {
 	prefix       string
 	suffix       string
 	labels       map[string]string
+	annotations  map[string]string
 	envs         []v1.EnvVar
+	envFrom      []v1.EnvFromSource
+	secretRefs   []secretRef
+	editEnv      bool
+	edit         bool
+	confirm      bool
+	showSecrets  bool
+	nameOutput   io.Writer
+	envSecret    *v1.Secret
+	noValidate   bool
+	schemaFile   string
+	events       *eventWriter
+	headless     bool
+	noAttach     bool
+	keep         bool
+	forceDelete  bool
+	keepalive    bool
+	container    string
+	copyIn       []copySpec
+	collect      []copySpec
+	script       *localScript
+	tmux         bool
+	inPlace      bool
+	onFailure    string
+	logsDir      string
+	logFile      string
+	session      sessionOptions
+	portForwards []string
+	pipedStdin   bool
 	user         string
-	envFile      string
+	// userCommand is the command as given after the pod name, the
+	// script's arguments with --script, and empty for the default shell;
+	// commandToRun wraps it. nil when the caller only set commandToRun.
+	userCommand []string
+	// envFiles are the --env-file paths made absolute, "-" for stdin.
+	envFiles []string
+	history  *historyStore
+
+	nameTemplate           string
+	strategy               string
+	stripLabels            []string
+	inheritAll             bool
+	noInheritLabels        bool
+	noInheritEnvFrom       bool
+	dropEnvFrom            []string
+	overrides              []byte
+	patchFiles             []string
+	patches                [][]byte
+	jsonPatchFiles         []string
+	jsonPatches            []jsonpatch.Patch
+	stripLifecycleHooks    bool
+	keepReadinessGates     bool
+	runAsUser              *int64
+	runAsRoot              bool
+	fsGroup                *int64
+	addCapabilities        []v1.Capability
+	hostNetwork            *bool
+	hostPID                *bool
+	hostIPC                *bool
+	shareProcessNamespace  *bool
+	noLimits               bool
+	noRequests             bool
+	stripExtendedResources bool
+	keepResources          []string
+	smallProfile           v1.ResourceList
+	ephemeralRequest       *resource.Quantity
+	ephemeralLimit         *resource.Quantity
+	tolerations            []v1.Toleration
+	nodeSelector           map[string]string
+	hostAliases            []v1.HostAlias
+	stripAffinity          bool
+	stripNodeSelector      bool
+	stripTopologySpread    bool
+	priorityClass          *string
+	runtimeClass           *string
+	terminationGracePeriod *int64
+	deleteGracePeriod      *int64
+	startupTimeout         time.Duration
+	reconnectAttempts      int
+	ttl                    time.Duration
+	serviceAccount         string
+	mountSAToken           *bool
+	debugSidecarImage      string
+	extraVolumes           []extraVolume
+	stripVolumes           []string
+	stripPVCVolumes        bool
+	debugNamespace         string
+	mutationPlugins        []string
+	asJob                  bool
+	backoffLimit           int32
+	completions            int32
+	ttlAfterFinished       *int32
+	// podSpec, when set, is created as is instead of cloning sourcePod.
+	podSpec *v1.Pod
+}
+
+// defaultTerminationGracePeriod is the clone's terminationGracePeriodSeconds
+// unless --termination-grace-period says otherwise.
+const defaultTerminationGracePeriod = 5 * time.Second
+
+// newDefaultParams returns params matching the root command's flag
+// defaults, for callers that build a clone without parsing those flags.
+func newDefaultParams(cfg *kmimeConfig) *kmimeParams {
+	params := &kmimeParams{
+		commandToRun:           shellCommand(cfg.ShellFallback),
+		labels:                 mergeStringMaps(cfg.DefaultLabels),
+		annotations:            mergeStringMaps(cfg.DefaultAnnotations),
+		strategy:               strategyFull,
+		stripAffinity:          true,
+		stripTopologySpread:    true,
+		mountSAToken:           cfg.MountServiceAccountToken,
+		debugNamespace:         cfg.DebugNamespace,
+		mutationPlugins:        cfg.MutationPlugins,
+		terminationGracePeriod: durationSeconds(defaultTerminationGracePeriod),
+		startupTimeout:         defaultStartupTimeout,
+		reconnectAttempts:      defaultReconnectAttempts,
+		logsDir:                cfg.LogsDir,
+		nameTemplate:           cfg.NameTemplate,
+	}
+	if timeout, err := time.ParseDuration(cfg.StartupTimeout); err == nil {
+		params.startupTimeout = timeout
+	}
+	if cfg.DefaultPriorityClass != "" {
+		params.priorityClass = &cfg.DefaultPriorityClass
+	}
+	return params
 }
 
 func NewModel(params *kmimeParams) model {
@@ -69,8 +274,10 @@ func NewModel(params *kmimeParams) model {
 	s.Style = spinnerStyle
 	return model{
 		params:     params,
+		cleanup:    &cleanupTracker{},
 		spinner:    s,
 		statusText: "Connecting to Kubernetes cluster...",
+		warnings:   cloneWarnings(params),
 	}
 }
 
@@ -79,11 +286,42 @@ func (m model) Init() tea.Cmd {
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if m.params.events != nil {
+		m.params.events.observe(m, msg)
+	}
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		if msg.Type == tea.KeyCtrlC {
 			return m, tea.Quit
 		}
+		if m.failurePrompt != nil {
+			return m.handleFailurePrompt(msg)
+		}
+		if m.specViewer != nil {
+			if m.specViewer.update(msg) {
+				m.specViewer = nil
+			}
+			return m, nil
+		}
+		if m.confirmPrompt {
+			return m.handleConfirmPrompt(msg)
+		}
+		if m.sessionPrompt != "" {
+			return m.handleSessionPrompt(msg)
+		}
+		if m.quotaPrompt {
+			return m.handleQuotaPrompt(msg)
+		}
+		if m.envEditor != nil && !m.envEdited {
+			return m.handleEnvEditor(msg)
+		}
+		return m, nil
+
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+		if m.specViewer != nil {
+			m.specViewer.setHeight(msg.Height)
+		}
 		return m, nil
 
 	case spinner.TickMsg:
@@ -92,55 +330,251 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, cmd
 
 	case errorMsg:
+		// Once the clone exists, --on-failure decides whether it stays
+		// for inspection.
+		if m.newPodName != "" && !m.params.asJob && !m.removing && m.sessionErr == nil && m.cleanup.pending() {
+			return m.failed(msg.err)
+		}
+		if m.removing {
+			// The cleanup already retried and reported what is left.
+			m.cleanup.release()
+		}
 		m.err = msg.err
 		return m, tea.Quit
 
+	case failureLogsMsg:
+		if msg.err != nil {
+			m.warnings = append(m.warnings, fmt.Sprintf("could not read the logs: %v", msg.err))
+		}
+		m.failureLogs = msg.logs
+		return m.removeClone()
+
 	case kubeConnectedMsg:
 		m.clientset = msg.clientset
 		m.config = msg.config
+		if m.params.podSpec != nil {
+			m.newPod = m.params.podSpec.DeepCopy()
+			m.statusText = "Checking Services, controllers and resource quotas..."
+			return m, preflightCmd(m.clientset, nil, m.newPod, m.params)
+		}
 		m.statusText = fmt.Sprintf("Fetching source pod '%s'...", m.params.sourcePod)
 		return m, fetchPodCmd(m.clientset, m.params.namespace, m.params.sourcePod)
 
 	case podFetchedMsg:
-		m.statusText = "Generating new pod specification..."
-		return m, createPodCmd(m)
+		m.sourcePod = msg.pod
+		newPod, err := clonePod(msg.pod, m.params)
+		if err != nil {
+			return m.Update(errorMsg{err})
+		}
+		newPod, err = customizePod(newPod, m.params)
+		if err != nil {
+			return m.Update(errorMsg{err})
+		}
+		m.newPod = newPod
+		if err := checkContainer(m.newPod, m.params.container); err != nil {
+			return m.Update(errorMsg{err})
+		}
+		m.statusText = "Checking Services, controllers and resource quotas..."
+		return m, preflightCmd(m.clientset, m.sourcePod, m.newPod, m.params)
+
+	case preflightMsg:
+		m.warnings = append(m.warnings, msg.warnings...)
+		// Without the TUI there is nobody to answer the prompt; the
+		// API server has the last word on the quota.
+		if len(msg.shortfalls) > 0 && !m.params.headless {
+			m.quotaPrompt = true
+			m.shortfalls = msg.shortfalls
+			return m, nil
+		}
+		if m.params.confirm {
+			m.confirmPrompt = true
+			return m, nil
+		}
+		return m.startCreate()
+
+	case namespaceMovedMsg:
+		if msg.err != nil {
+			return m.Update(errorMsg{msg.err})
+		}
+		// The quota of the debug namespace is checked again, and the
+		// selectors of its Services.
+		m.newPod = msg.pod
+		m.adjustments = append(m.adjustments, msg.adjustments...)
+		m.statusText = "Checking Services, controllers and resource quotas..."
+		return m, preflightCmd(m.clientset, nil, m.newPod, m.params)
+
+	case specEditedMsg:
+		if msg.err != nil {
+			os.Remove(msg.path)
+			m.err = fmt.Errorf("editor failed: %w", msg.err)
+			return m, tea.Quit
+		}
+		pod, body, err := loadEditedPod(msg.path)
+		os.Remove(msg.path)
+		if err == errEditAborted {
+			m.err = err
+			return m, tea.Quit
+		}
+		if err != nil {
+			return m, openSpecEditorCmd(body, err)
+		}
+		m.newPod = pod
+		m.specEdited = true
+		m.adjustments = append(m.adjustments, "pod spec edited before creation")
+		return m.startCreate()
 
 	case podCreatedMsg:
 		m.newPodName = msg.podName
+		m.namespace = msg.namespace
+		// The countdown starts a second early, like the wait itself.
+		m.waitDeadline = time.Now().Add(time.Second + m.params.startupTimeout)
+		if m.params.asJob {
+			m.jobName = msg.podName
+			m.statusText = fmt.Sprintf("Waiting for job '%s' to start a pod...", m.newPodName)
+			return m, waitForJobPodCmd(m.clientset, m.namespace, m.newPodName, m.params.startupTimeout)
+		}
+		if m.params.noAttach || m.params.pipedStdin {
+			m.statusText = fmt.Sprintf("Waiting for pod '%s' to start...", m.newPodName)
+			return m, waitForPodStartedCmd(m.clientset, m.namespace, m.newPodName, m.params.startupTimeout)
+		}
 		m.statusText = fmt.Sprintf("Waiting for pod '%s' to start...", m.newPodName)
-		return m, waitForPodCmd(m.clientset, m.params.namespace, m.newPodName)
+		return m, waitForPodCmd(m.clientset, m.namespace, m.newPodName, m.params.startupTimeout)
+
+	case podProgressMsg:
+		if msg.status != "" {
+			m.podStatus = msg.status
+		}
+		if msg.event != "" {
+			m.podEvent = msg.event
+		}
+		if msg.warning != "" && !slices.Contains(m.warnings, msg.warning) {
+			m.warnings = append(m.warnings, msg.warning)
+		}
+		return m, msg.next
 
 	case podRunningMsg:
 		m.newPodName = msg.podName
+		m.podStatus, m.podEvent = "", ""
+		m.waitDeadline = time.Time{}
+		if len(m.params.portForwards) > 0 {
+			m.statusText = "Starting port-forward..."
+			return m, startPortForwardCmd(m.clientset, m.config, m.namespace, m.newPodName, m.params.portForwards)
+		}
+		return m.copyIn()
+
+	case portForwardMsg:
+		if msg.err != nil {
+			m.warnings = append(m.warnings, msg.err.Error())
+		}
+		m.portForwardStop = msg.stop
+		return m.copyIn()
+
+	case copiedInMsg:
+		m.warnings = append(m.warnings, msg.warnings...)
+		return m.checkTooling()
+
+	case collectedMsg:
+		m.warnings = append(m.warnings, msg.warnings...)
+		m.collected = true
+		return m.endSession()
+
+	case toolingMsg:
+		m.warnings = append(m.warnings, msg.warnings...)
 		m.statusText = fmt.Sprintf("Attaching to pod '%s'...", m.newPodName)
+		if m.portForwardStop != nil {
+			m.statusText = fmt.Sprintf("Attaching to pod '%s' (forwarding %s)...", m.newPodName, describePortForwards(m.params.portForwards))
+		}
+		// Give the user a moment to read new warnings before the shell
+		// takes over the screen.
+		var pause time.Duration
+		if len(msg.warnings) > 0 {
+			pause = 3 * time.Second
+		}
 		return m, tea.Sequence(
-			tea.EnterAltScreen,
+			tea.Tick(pause, func(time.Time) tea.Msg { return nil }),
 			func() tea.Msg { return attachMsg{} },
 		)
 
 	case attachMsg:
-		time.Sleep(1 * time.Second)
-		err := attachToPod(m.clientset, m.config, m.params.namespace, m.newPodName, m.params.commandToRun)
-		if err != nil && !strings.Contains(err.Error(), "exit status") {
-			return m, func() tea.Msg { return errorMsg{err} }
+		m.sessionStart = time.Now()
+		return m, tea.Exec(sessionExec{run: m.runSession}, func(err error) tea.Msg {
+			return sessionEndedMsg{err}
+		})
+
+	case sessionEndedMsg:
+		err := msg.err
+		if errors.Is(err, errDetached) {
+			m.sessionPrompt = fmt.Sprintf("Detached; pod '%s' is still running.", m.newPodName)
+			return m, nil
 		}
-		return m, tea.Sequence(
-			tea.ExitAltScreen,
-			func() tea.Msg { return podAttachedMsg{} },
-		)
+		if errors.Is(err, errIdleTimeout) {
+			// A forgotten session is removed even with --keep.
+			m.warnings = append(m.warnings, fmt.Sprintf("the session was idle for %s and was ended", m.params.session.idleTimeout))
+			m.statusText = fmt.Sprintf("Cleaning up pod '%s'...", m.newPodName)
+			m.removing = true
+			return m, tea.Sequence(
+				m.stopPortForward,
+				cleanupPodCmd(m.clientset, m.namespace, m.newPodName, m.params),
+			)
+		}
+		if !sessionEnded(err) {
+			if !connectionLost(err) {
+				return m.failed(err)
+			}
+			if m.params.keepalive && !m.params.tmux {
+				// Reattaching execs the command again, which the user has
+				// to ask for; tmux instead resumes the same session.
+				if m.params.headless {
+					return m.failed(fmt.Errorf("the connection was lost: %w", err))
+				}
+				m.sessionPrompt = fmt.Sprintf("The connection was lost; pod '%s' is still running. Reattaching runs the command again.", m.newPodName)
+				return m, nil
+			}
+			if time.Since(m.sessionStart) > stableSession {
+				m.reconnects = 0
+			}
+			return m.reconnect(err)
+		}
+		return m.Update(podAttachedMsg{})
+
+	case reconnectMsg:
+		if msg.err != nil {
+			return m.reconnect(msg.err)
+		}
+		m.statusText = fmt.Sprintf("Reattaching to pod '%s'...", m.newPodName)
+		return m, func() tea.Msg { return attachMsg{} }
 
 	case podAttachedMsg:
-		m.statusText = fmt.Sprintf("Cleaning up pod '%s'...", m.newPodName)
-		return m, cleanupPodCmd(m.clientset, m.params.namespace, m.newPodName)
+		if m.params.keepalive && !m.params.headless {
+			m.sessionPrompt = fmt.Sprintf("The command exited; pod '%s' is still running.", m.newPodName)
+			return m, nil
+		}
+		return m.endSession()
 
 	case podCleanedUpMsg:
+		// What is left of the manifest is removed once the TUI exits.
+		m.cleanup.forget("pod", m.namespace, msg.podName)
+		if m.sessionErr != nil {
+			return m.Update(errorMsg{fmt.Errorf("%w; pod '%s' was removed", m.sessionErr, m.newPodName)})
+		}
 		m.statusText = fmt.Sprintf("Pod '%s' removed successfully.", m.newPodName)
 		return m, func() tea.Msg {
 			time.Sleep(1 * time.Second)
 			return finalSuccessMsg{message: "Session finished successfully!"}
 		}
 
+	case podStartedMsg:
+		// Jobs, --no-attach runs and piped stdin are not attached to from
+		// the TUI: the pod is streamed once it exits.
+		m.newPodName = msg.podName
+		m.podStatus, m.podEvent = "", ""
+		m.waitDeadline = time.Time{}
+		m.cleanup.release()
+		return m.Update(finalSuccessMsg{message: fmt.Sprintf("Pod '%s' started, streaming its output.", msg.podName)})
+
 	case finalSuccessMsg:
+		// The clone was removed, kept or is handed over to whatever
+		// streams it next.
 		m.statusText = msg.message
 		m.done = true
 		return m, tea.Quit
@@ -149,16 +583,255 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// handleQuotaPrompt applies the remediation the user picked after the quota
+// preflight found the clone would not fit in its namespace.
+func (m model) handleQuotaPrompt(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "r":
+		adjustments, err := reduceRequestsToFit(m.newPod, m.shortfalls)
+		if err != nil {
+			m.err = err
+			return m, tea.Quit
+		}
+		m.adjustments = append(m.adjustments, adjustments...)
+	case "d":
+		if m.params.debugNamespace == "" || m.newPod.Namespace == m.params.debugNamespace {
+			return m, nil
+		}
+		m.quotaPrompt = false
+		m.statusText = fmt.Sprintf("Moving the clone to namespace '%s'...", m.params.debugNamespace)
+		return m, moveNamespaceCmd(m.clientset, m.newPod, m.params.debugNamespace)
+	case "c":
+		m.adjustments = append(m.adjustments, "ignored insufficient quota headroom")
+	case "s":
+		return m.openSpecViewer()
+	case "ctrl+e":
+		m.editRequested = !m.editRequested
+		return m, nil
+	case "q", "esc":
+		m.err = fmt.Errorf("aborted: insufficient quota in namespace '%s'", m.newPod.Namespace)
+		return m, tea.Quit
+	default:
+		return m, nil
+	}
+
+	m.quotaPrompt = false
+	return m.startCreate()
+}
+
+// handleConfirmPrompt handles the --confirm step shown before creation.
+func (m model) handleConfirmPrompt(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "enter", "y":
+		m.confirmPrompt = false
+		return m.startCreate()
+	case "s":
+		return m.openSpecViewer()
+	case "ctrl+e":
+		m.editRequested = !m.editRequested
+	case "q", "n", "esc":
+		m.err = fmt.Errorf("aborted before creating the pod")
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
+// openSpecViewer shows the pod as it would be created, with secret-looking
+// values masked unless --show-secrets was given.
+func (m model) openSpecViewer() (tea.Model, tea.Cmd) {
+	pod := m.newPod
+	if !m.params.showSecrets {
+		pod = maskSecrets(pod)
+	}
+	body, err := podYAML(pod)
+	if err != nil {
+		m.err = err
+		return m, tea.Quit
+	}
+	m.specViewer = newSpecViewer(body, m.height)
+	return m, nil
+}
+
+// startCreate creates the pod, first opening the environment editor when
+// --edit-env was given.
+func (m model) startCreate() (tea.Model, tea.Cmd) {
+	if m.params.editEnv && !m.envEdited && len(m.newPod.Spec.Containers) > 0 {
+		source := v1.Container{}
+		if len(m.sourcePod.Spec.Containers) > 0 {
+			source = m.sourcePod.Spec.Containers[0]
+		}
+		m.envEditor = newEnvEditor(source, m.newPod.Spec.Containers[0])
+		return m, nil
+	}
+	if (m.params.edit || m.editRequested) && !m.specEdited {
+		body, err := podYAML(m.newPod)
+		if err != nil {
+			m.err = err
+			return m, tea.Quit
+		}
+		m.statusText = "Waiting for the editor to close..."
+		return m, openSpecEditorCmd(body, nil)
+	}
+	if m.params.logsDir != "" && !m.params.asJob {
+		m.params.logFile = savedLogPath(m.params.logsDir, m.newPod.Name, time.Now())
+	}
+	m.statusText = "Generating new pod specification..."
+	// Marked here rather than in the command, so a ctrl-c that arrives
+	// before the command starts still waits for the clone it creates.
+	m.cleanup.begin()
+	return m, createPodCmd(m)
+}
+
+// runSession attaches the terminal to the clone, or with --keepalive runs
+// the command in it, until the session ends. A --container other than the
+// one running the command gets the command exec'd into it instead, since
+// it has no terminal to attach to.
+func (m model) runSession() error {
+	time.Sleep(1 * time.Second)
+	target := m.newPod.Spec.Containers[0].Name
+	if m.params.container != "" && m.params.container != target {
+		return execInteractive(m.clientset, m.config, m.namespace, m.newPodName, m.params.container, m.params.commandToRun, m.params.session)
+	}
+	if m.params.keepalive {
+		return execInteractive(m.clientset, m.config, m.namespace, m.newPodName, target, m.params.commandToRun, m.params.session)
+	}
+	return attachToPod(m.clientset, m.config, m.namespace, m.newPodName, target, m.params.session)
+}
+
+// sessionExec runs a session through tea.Exec, which stops the TUI from
+// reading the terminal and handling signals until it returns. Every key,
+// ctrl-c, ctrl-z and ctrl-\ included, then reaches the remote terminal,
+// which turns them into signals for the remote process.
+type sessionExec struct {
+	run func() error
+}
+
+func (sessionExec) SetStdin(io.Reader)  {}
+func (sessionExec) SetStdout(io.Writer) {}
+func (sessionExec) SetStderr(io.Writer) {}
+
+// Run shows the session on the alternate screen, leaving the TUI's output
+// in place for when it returns.
+func (s sessionExec) Run() error {
+	fmt.Fprint(os.Stdout, "\x1b[?1049h\x1b[H")
+	defer fmt.Fprint(os.Stdout, "\x1b[?1049l")
+	return s.run()
+}
+
+// openSpecEditorCmd suspends the TUI while the YAML is edited.
+func openSpecEditorCmd(body []byte, previousErr error) tea.Cmd {
+	path, err := writeEditFile(body, previousErr)
+	if err != nil {
+		return func() tea.Msg { return errorMsg{err} }
+	}
+	return tea.ExecProcess(editorCommand(path), func(err error) tea.Msg {
+		return specEditedMsg{path: path, err: err}
+	})
+}
+
+func (m model) handleEnvEditor(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	done, aborted := false, false
+	if msg.String() == "ctrl+e" && !m.envEditor.editing {
+		m.editRequested = true
+		done = true
+	} else {
+		done, aborted = m.envEditor.update(msg)
+	}
+	if aborted {
+		m.err = fmt.Errorf("aborted in the environment editor")
+		return m, tea.Quit
+	}
+	if !done {
+		return m, nil
+	}
+	envs, summary := m.envEditor.result()
+	m.newPod.Spec.Containers[0].Env = envs
+	m.adjustments = append(m.adjustments, summary...)
+	m.envEdited = true
+	return m.startCreate()
+}
+
 func (m model) View() string {
 	if m.err != nil {
 		return errorStyle.Render(fmt.Sprintf("\nError: %v\n", m.err))
 	}
 
+	if m.specViewer != nil {
+		return m.specViewer.view()
+	}
+
+	if m.confirmPrompt {
+		var b strings.Builder
+		b.WriteString(fmt.Sprintf("\n Create pod '%s' in namespace '%s'?\n\n", m.newPod.Name, m.newPod.Namespace))
+		b.WriteString("  [enter] create\n  [s] view the pod spec\n  [q] abort\n")
+		if m.editRequested {
+			b.WriteString(helpStyle.Render("\n  The pod YAML will open in your editor before creation (ctrl+e to cancel).") + "\n")
+		} else {
+			b.WriteString(helpStyle.Render("\n  ctrl+e: edit the pod YAML before creation") + "\n")
+		}
+		return b.String()
+	}
+
+	if m.failurePrompt != nil {
+		var b strings.Builder
+		b.WriteString(errorStyle.Render(fmt.Sprintf("\nError: %v", m.failurePrompt)))
+		b.WriteString(fmt.Sprintf("\n\n Keep pod '%s' for inspection?\n\n", m.newPodName))
+		b.WriteString("  [k] keep the pod and quit\n  [l] print its logs, then delete it\n  [enter] delete it\n")
+		return b.String()
+	}
+
+	if m.sessionPrompt != "" {
+		var b strings.Builder
+		b.WriteString(fmt.Sprintf("\n %s\n\n", m.sessionPrompt))
+		b.WriteString("  [r] reattach\n  [k] keep the pod and quit\n  [enter] finish the session\n")
+		return b.String()
+	}
+
+	if m.quotaPrompt {
+		var b strings.Builder
+		b.WriteString(errorStyle.Render(fmt.Sprintf("\nThe clone does not fit the resource quota of namespace '%s':", m.newPod.Namespace)))
+		b.WriteString("\n")
+		for _, s := range m.shortfalls {
+			b.WriteString(fmt.Sprintf("  - %s\n", s))
+		}
+		b.WriteString("\n  [r] reduce requests to fit\n")
+		if m.params.debugNamespace != "" && m.newPod.Namespace != m.params.debugNamespace {
+			b.WriteString(fmt.Sprintf("  [d] schedule in debug namespace '%s'\n", m.params.debugNamespace))
+		}
+		b.WriteString("  [c] continue anyway\n  [s] view the pod spec\n  [q] abort\n")
+		if m.editRequested {
+			b.WriteString(helpStyle.Render("\n  The pod YAML will open in your editor before creation (ctrl+e to cancel).") + "\n")
+		} else {
+			b.WriteString(helpStyle.Render("\n  ctrl+e: edit the pod YAML before creation") + "\n")
+		}
+		return b.String()
+	}
+
+	if m.envEditor != nil && !m.envEdited {
+		return m.envEditor.view()
+	}
+
 	if m.done {
 		return successStyle.Render(fmt.Sprintf("\n%s\n", m.statusText))
 	}
 
-	return fmt.Sprintf("\n %s %s\n", m.spinner.View(), statusStyle.Render(m.statusText))
+	var warnings string
+	for _, w := range m.warnings {
+		warnings += warningStyle.Render(fmt.Sprintf(" Warning: %s", w)) + "\n"
+	}
+	status := statusStyle.Render(m.statusText)
+	details := m.podStatus
+	if m.podEvent != "" {
+		details = strings.TrimPrefix(details+" · "+m.podEvent, " · ")
+	}
+	if !m.waitDeadline.IsZero() {
+		left := max(time.Until(m.waitDeadline), 0).Round(time.Second)
+		details = strings.TrimPrefix(details+" · "+left.String()+" left", " · ")
+	}
+	if details != "" {
+		status += " " + helpStyle.Render(details)
+	}
+	return fmt.Sprintf("\n%s %s %s\n", warnings, m.spinner.View(), status)
 }
 
 func connectToKubeCmd() tea.Msg {
@@ -173,60 +846,200 @@ func connectToKubeCmd() tea.Msg {
 func fetchPodCmd(clientset *kubernetes.Clientset, namespace, sourcePod string) tea.Cmd {
 	return func() tea.Msg {
 		time.Sleep(1 * time.Second)
-		_, err := getPod(clientset, namespace, sourcePod)
+		pod, err := getPod(clientset, namespace, sourcePod)
 		if err != nil {
 			return errorMsg{err}
 		}
-		return podFetchedMsg{}
+		return podFetchedMsg{pod: pod}
 	}
 }
 
+// preflightCmd runs the cluster-side checks on the generated spec, source
+// being the pod it was cloned from or nil. Both are advisory: lacking
+// permission to list Services or quotas should not block the session.
+func preflightCmd(clientset *kubernetes.Clientset, source, pod *v1.Pod, params *kmimeParams) tea.Cmd {
+	return func() tea.Msg {
+		msg := preflightMsg{warnings: sanitizeClone(clientset, source, pod, params)}
+		if shortfalls, err := checkQuota(clientset, pod); err == nil {
+			msg.shortfalls = shortfalls
+		}
+		return msg
+	}
+}
+
+// moveNamespaceCmd moves a copy of the clone to namespace.
+func moveNamespaceCmd(clientset *kubernetes.Clientset, pod *v1.Pod, namespace string) tea.Cmd {
+	return func() tea.Msg {
+		moved := pod.DeepCopy()
+		adjustments, err := moveToNamespace(clientset, moved, namespace)
+		return namespaceMovedMsg{pod: moved, adjustments: adjustments, err: err}
+	}
+}
+
+// createPodCmd creates the clone. The caller marks the creation in flight
+// with m.cleanup.begin(); the command ends it.
 func createPodCmd(m model) tea.Cmd {
 	return func() tea.Msg {
+		defer m.cleanup.end()
 		time.Sleep(1 * time.Second)
-		originalPod, _ := getPod(m.clientset, m.params.namespace, m.params.sourcePod)
-		newPodSpec := clonePod(originalPod, m.params.user, m.params.commandToRun, m.params.prefix, m.params.suffix, m.params.labels, m.params.envs)
+		if m.params.serviceAccount != "" {
+			if err := checkServiceAccount(m.clientset, m.newPod.Namespace, m.params.serviceAccount); err != nil {
+				return errorMsg{err}
+			}
+		}
 
-		createdPod, err := createPod(m.clientset, newPodSpec)
+		warning, err := checkSchema(m.clientset, m.newPod, m.params)
 		if err != nil {
 			return errorMsg{err}
 		}
+		if warning != "" {
+			log.Printf("Warning: %s", warning)
+		}
 
-		entry := logEntry{
-			Timestamp:  time.Now(),
-			NewPodName: createdPod.Name,
-			SourcePod:  m.params.sourcePod,
-			Namespace:  m.params.namespace,
-			User:       m.params.user,
-			Command:    m.params.commandToRun,
-			Prefix:     m.params.prefix,
-			Suffix:     m.params.suffix,
-			Labels:     m.params.labels,
-			EnvFile:    m.params.envFile,
+		// Everything created from here on is tracked, so it is removed if
+		// the clone cannot be created or kmime is interrupted; otherwise the
+		// clone owns it.
+		clone, err := createClone(m.clientset, m.newPod, m.params, m.cleanup)
+		if err != nil {
+			return errorMsg{err}
+		}
+		if clone.pod != nil {
+			lease, err := startLease(context.Background(), m.clientset, clone.pod)
+			if lease != nil {
+				m.cleanup.track(m.clientset, "lease", lease.Namespace, lease.Name)
+			}
+			if err != nil {
+				log.Printf("Warning: %v", err)
+			}
+		}
+
+		entry := newLogEntry(m.params, clone.name)
+		if clone.namespace != entry.Namespace {
+			entry.CloneNamespace = clone.namespace
 		}
-		if err := appendLog(entry); err != nil {
+		entry.Adjustments = append(slices.Clone(m.adjustments), clone.adjustments...)
+		if err := m.params.history.append(entry); err != nil {
 			log.Printf("Warning: could not write to log file: %v", err)
 		}
 
-		return podCreatedMsg{podName: createdPod.Name}
+		if m.params.nameOutput != nil {
+			fmt.Fprintf(m.params.nameOutput, "%s/%s\n", clone.kind, clone.name)
+		}
+		return podCreatedMsg{podName: clone.name, namespace: clone.namespace}
 	}
 }
 
-func waitForPodCmd(clientset *kubernetes.Clientset, namespace, podName string) tea.Cmd {
+func waitForPodCmd(clientset *kubernetes.Clientset, namespace, podName string, timeout time.Duration) tea.Cmd {
+	return podWaitCmd(clientset, namespace, podName, "running", timeout, podRunning, podRunningMsg{podName: podName})
+}
+
+// processTools are the executables a shared process namespace is usually
+// enabled for.
+var processTools = []string{"ps", "top", "strace", "gdb"}
+
+// checkToolingCmd warns about process debugging tools missing from the
+// attached container.
+func checkToolingCmd(clientset *kubernetes.Clientset, config *rest.Config, namespace, podName string) tea.Cmd {
 	return func() tea.Msg {
-		time.Sleep(1 * time.Second)
-		err := waitForPodRunning(clientset, namespace, podName, time.Minute*2)
+		missing, err := missingTools(clientset, config, namespace, podName, "", processTools)
 		if err != nil {
-			return errorMsg{err}
+			return toolingMsg{warnings: []string{fmt.Sprintf("could not check for process debugging tools: %v", err)}}
+		}
+		if len(missing) == 0 {
+			return toolingMsg{}
 		}
-		return podRunningMsg{podName: podName}
+		return toolingMsg{warnings: []string{fmt.Sprintf("the process namespace is shared but the image lacks %s; consider --debug-sidecar", strings.Join(missing, ", "))}}
 	}
 }
 
-func cleanupPodCmd(clientset *kubernetes.Clientset, namespace, podName string) tea.Cmd {
+// stopPortForward ends the --port-forward listeners, if any. It has the
+// signature of a tea.Cmd so it can be sequenced.
+func (m model) stopPortForward() tea.Msg {
+	if m.portForwardStop != nil {
+		close(m.portForwardStop)
+	}
+	return nil
+}
+
+// copyIn copies the --copy-in paths into the session's container.
+func (m model) copyIn() (tea.Model, tea.Cmd) {
+	if len(m.params.copyIn) == 0 {
+		return m.checkTooling()
+	}
+	m.statusText = fmt.Sprintf("Copying files into pod '%s'...", m.newPodName)
+	return m, copyInCmd(m.clientset, m.config, m.namespace, m.newPodName, m.sessionContainer(), m.params.copyIn)
+}
+
+// sessionContainer is the container the session opens in.
+func (m model) sessionContainer() string {
+	if m.params.container != "" {
+		return m.params.container
+	}
+	return m.newPod.Spec.Containers[0].Name
+}
+
+// checkTooling looks for process debugging tools when the process
+// namespace is shared, before attaching.
+func (m model) checkTooling() (tea.Model, tea.Cmd) {
+	if m.params.shareProcessNamespace != nil && *m.params.shareProcessNamespace {
+		m.statusText = "Checking process debugging tools..."
+		return m, checkToolingCmd(m.clientset, m.config, m.namespace, m.newPodName)
+	}
+	return m.Update(toolingMsg{})
+}
+
+// endSession removes the clone, or leaves it with --keep, once the user is
+// done with it.
+func (m model) endSession() (tea.Model, tea.Cmd) {
+	m.stopPortForward()
+	m.portForwardStop = nil
+	if len(m.params.collect) > 0 && !m.collected {
+		m.statusText = fmt.Sprintf("Collecting files from pod '%s'...", m.newPodName)
+		return m, collectCmd(m.clientset, m.config, m.namespace, m.newPodName, m.sessionContainer(), m.params.collect)
+	}
+	if m.params.keep {
+		m.cleanup.keep()
+		return m.Update(finalSuccessMsg{message: keptMessage(m.namespace, m.newPodName)})
+	}
+	return m.removeClone()
+}
+
+// removeClone deletes the clone; failing to do so is not a session failure.
+func (m model) removeClone() (tea.Model, tea.Cmd) {
+	m.removing = true
+	m.statusText = fmt.Sprintf("Cleaning up pod '%s'...", m.newPodName)
+	return m, cleanupPodCmd(m.clientset, m.namespace, m.newPodName, m.params)
+}
+
+// handleSessionPrompt lets the user go back into a clone that outlived the
+// session, after detaching or when the command of a keepalive clone exited,
+// instead of ending it.
+func (m model) handleSessionPrompt(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "r":
+		m.sessionPrompt = ""
+		m.statusText = fmt.Sprintf("Attaching to pod '%s'...", m.newPodName)
+		return m, func() tea.Msg { return attachMsg{} }
+	case "k":
+		m.sessionPrompt = ""
+		m.params.keep = true
+		return m.endSession()
+	case "enter", "q":
+		m.sessionPrompt = ""
+		return m.endSession()
+	}
+	return m, nil
+}
+
+// keptMessage tells where a clone kept with --keep is and how to remove it.
+func keptMessage(namespace, podName string) string {
+	return fmt.Sprintf("Pod '%s' was kept. Delete it with: kubectl delete pod %s -n %s", podName, podName, namespace)
+}
+
+func cleanupPodCmd(clientset *kubernetes.Clientset, namespace, podName string, params *kmimeParams) tea.Cmd {
 	return func() tea.Msg {
 		time.Sleep(1 * time.Second)
-		if err := deletePod(clientset, namespace, podName); err != nil {
+		if err := deleteClone(clientset, namespace, podName, params); err != nil {
 			return errorMsg{fmt.Errorf("failed to clean up pod '%s': %w", podName, err)}
 		}
 		return podCleanedUpMsg{podName: podName}